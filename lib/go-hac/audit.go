@@ -0,0 +1,166 @@
+package hac
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AuditRecord describes one HAC request handled by Middleware.
+type AuditRecord struct {
+	Time   time.Time
+	Caller string
+
+	Method string
+	Path   string
+	Query  string
+
+	// Route is the resolved route pattern, and Rel the rel of the action the
+	// request invokes. Either is empty if unknown.
+	Route string
+	Rel   string
+
+	// Mutability, BlastRadius and Cost come from the invoked action's safety
+	// metadata.
+	Mutability  Mutability
+	BlastRadius BlastRadius
+	Cost        *Cost
+
+	Status  int
+	Latency time.Duration
+
+	// ConfirmationToken reports whether the request carried a confirmation
+	// token, and Confirmed whether a valid one was accepted.
+	ConfirmationToken bool
+	Confirmed         bool
+
+	DryRun bool
+}
+
+// Attrs returns the record as slog attributes. Empty fields are omitted.
+func (rec AuditRecord) Attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Time("time", rec.Time),
+		slog.String("caller", rec.Caller),
+		slog.String("method", rec.Method),
+		slog.String("path", rec.Path),
+	}
+	if rec.Query != "" {
+		attrs = append(attrs, slog.String("query", rec.Query))
+	}
+	if rec.Route != "" {
+		attrs = append(attrs, slog.String("route", rec.Route))
+	}
+	if rec.Rel != "" {
+		attrs = append(attrs, slog.String("rel", rec.Rel))
+	}
+	if rec.Mutability != "" {
+		attrs = append(attrs, slog.String("mutability", string(rec.Mutability)))
+	}
+	if rec.BlastRadius != "" {
+		attrs = append(attrs, slog.String("blast_radius", string(rec.BlastRadius)))
+	}
+	if rec.Cost != nil {
+		attrs = append(attrs, slog.Group("cost",
+			slog.Float64("amount", rec.Cost.Amount),
+			slog.String("currency", rec.Cost.Currency)))
+	}
+	attrs = append(attrs,
+		slog.Int("status", rec.Status),
+		slog.Duration("latency", rec.Latency),
+		slog.Bool("confirmation_token", rec.ConfirmationToken),
+		slog.Bool("confirmed", rec.Confirmed),
+	)
+	if rec.DryRun {
+		attrs = append(attrs, slog.Bool("dry_run", true))
+	}
+	return attrs
+}
+
+// AuditSink receives audit records. Audit is called synchronously after the
+// response is written, so implementations should not block for long.
+type AuditSink interface {
+	Audit(ctx context.Context, rec AuditRecord)
+}
+
+// AuditFunc adapts a function to an AuditSink.
+type AuditFunc func(ctx context.Context, rec AuditRecord)
+
+// Audit implements AuditSink.
+func (f AuditFunc) Audit(ctx context.Context, rec AuditRecord) {
+	f(ctx, rec)
+}
+
+// SlogAuditSink writes audit records to a slog.Logger.
+type SlogAuditSink struct {
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Level defaults to slog.LevelInfo.
+	Level slog.Level
+}
+
+// Audit implements AuditSink.
+func (s SlogAuditSink) Audit(ctx context.Context, rec AuditRecord) {
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(ctx, s.Level, "hac audit", rec.Attrs()...)
+}
+
+// Redacted replaces values removed by RedactAudit.
+const Redacted = "[REDACTED]"
+
+// RedactAudit returns an Options.AuditRedact function that replaces the
+// named fields of a record with Redacted. The names are those used by
+// Attrs: "caller", "path" and "query".
+func RedactAudit(fields ...string) func(AuditRecord) AuditRecord {
+	return func(rec AuditRecord) AuditRecord {
+		for _, f := range fields {
+			switch f {
+			case "caller":
+				rec.Caller = Redacted
+			case "path":
+				rec.Path = Redacted
+			case "query":
+				if rec.Query != "" {
+					rec.Query = Redacted
+				}
+			}
+		}
+		return rec
+	}
+}
+
+// auditRequest emits the audit record for a HAC request.
+func auditRequest(opts Options, r *http.Request, route string, status int, dryRun bool, start time.Time) {
+	rec := AuditRecord{
+		Time:              start,
+		Method:            r.Method,
+		Path:              r.URL.Path,
+		Query:             r.URL.RawQuery,
+		Route:             route,
+		Status:            status,
+		Latency:           time.Since(start),
+		ConfirmationToken: r.Header.Get(ConfirmationHeader) != "",
+		Confirmed:         IsConfirmed(r),
+		DryRun:            dryRun,
+	}
+	if opts.Caller != nil {
+		rec.Caller = opts.Caller(r)
+	}
+	if a, ok := opts.Registry.MatchAction(r.Method, r.URL.Path); ok {
+		rec.Rel = a.Rel
+		if s := a.Safety; s != nil {
+			rec.Mutability = s.Mutability
+			rec.BlastRadius = s.BlastRadius
+			rec.Cost = s.Cost
+		}
+	}
+	if opts.AuditRedact != nil {
+		rec = opts.AuditRedact(rec)
+	}
+	opts.Audit.Audit(r.Context(), rec)
+}
@@ -0,0 +1,118 @@
+package hac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newAuditTestHandler(records *[]AuditRecord, redact func(AuditRecord) AuditRecord) http.Handler {
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Description("A user account.").
+		Actions(Action{
+			Rel: "delete", Method: "DELETE", Href: "/users/{id}",
+			Description: "Permanently delete this user.",
+			Fields:      []Field{{Name: "id", Type: "string"}},
+			Safety: &Safety{
+				Mutability:              Irreversible,
+				BlastRadius:             SelfAndAssociated,
+				ConfirmationRecommended: true,
+				Cost:                    &Cost{Amount: 1, Currency: "USD"},
+			},
+		}).
+		MustRegister()
+	reg.Delete("DELETE /users/{id}").Description("Deleted user.").MustRegister()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"deleted":true}`))
+	})
+	return Middleware(Options{
+		Registry:        reg,
+		PathResolver:    MuxPathResolver(mux),
+		ConfirmationKey: []byte("test-key"),
+		Caller:          func(r *http.Request) string { return r.Header.Get("X-Caller") },
+		Audit: AuditFunc(func(_ context.Context, rec AuditRecord) {
+			*records = append(*records, rec)
+		}),
+		AuditRedact: redact,
+	})(mux)
+}
+
+func TestAuditRecords(t *testing.T) {
+	var records []AuditRecord
+	h := newAuditTestHandler(&records, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, confirmRequest("/users/1?reason=spam", "", "alice", ""))
+	var env ErrorEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	token := env.Error.Recovery.Actions[0].Headers[ConfirmationHeader]
+
+	h.ServeHTTP(httptest.NewRecorder(), confirmRequest("/users/1?reason=spam", "", "alice", token))
+
+	// Non-HAC requests are not audited.
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/users/1", nil))
+
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	first, second := records[0], records[1]
+	if first.Status != http.StatusPreconditionRequired || first.ConfirmationToken || first.Confirmed {
+		t.Errorf("unconfirmed record = %+v", first)
+	}
+	if second.Status != http.StatusOK || !second.ConfirmationToken || !second.Confirmed {
+		t.Errorf("confirmed record = %+v", second)
+	}
+	if second.Caller != "alice" || second.Route != "DELETE /users/{id}" || second.Rel != "delete" ||
+		second.Mutability != Irreversible || second.BlastRadius != SelfAndAssociated ||
+		second.Cost == nil || second.Cost.Amount != 1 ||
+		second.Path != "/users/1" || second.Query != "reason=spam" || second.Time.IsZero() {
+		t.Errorf("record = %+v", second)
+	}
+}
+
+func TestAuditRedact(t *testing.T) {
+	var records []AuditRecord
+	h := newAuditTestHandler(&records, RedactAudit("caller", "query"))
+	h.ServeHTTP(httptest.NewRecorder(), confirmRequest("/users/1?email=a@example.com", "", "alice", ""))
+
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if r := records[0]; r.Caller != Redacted || r.Query != Redacted || r.Path != "/users/1" {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestSlogAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := SlogAuditSink{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+	sink.Audit(context.Background(), AuditRecord{
+		Caller:     "alice",
+		Method:     "DELETE",
+		Path:       "/users/1",
+		Rel:        "delete",
+		Mutability: Irreversible,
+		Cost:       &Cost{Amount: 2.5, Currency: "USD"},
+		Status:     200,
+	})
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log output %q: %v", buf.String(), err)
+	}
+	if line["msg"] != "hac audit" || line["caller"] != "alice" || line["mutability"] != "irreversible" ||
+		line["status"] != float64(200) || line["cost"].(map[string]any)["amount"] != 2.5 {
+		t.Errorf("log line = %v", line)
+	}
+	if strings.Contains(buf.String(), "blast_radius") || strings.Contains(buf.String(), "dry_run") {
+		t.Errorf("empty fields logged: %s", buf.String())
+	}
+}
@@ -0,0 +1,310 @@
+package hac
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BudgetLimit caps the spending of one caller in one currency over a sliding
+// window.
+type BudgetLimit struct {
+	Currency string
+	Amount   float64
+	Window   time.Duration
+}
+
+// BudgetUsage describes a caller's spending against one limit.
+type BudgetUsage struct {
+	Limit BudgetLimit
+
+	// Spent is the total charged within the window.
+	Spent float64
+
+	// ResetAt is when enough earlier charges leave the window for the
+	// rejected charge to fit. It is zero if the charge can never fit.
+	ResetAt time.Time
+}
+
+// Remaining is the allowance left within the window.
+func (u BudgetUsage) Remaining() float64 {
+	return math.Max(0, u.Limit.Amount-u.Spent)
+}
+
+// Ledger records charges against callers' budgets. Implementations must be
+// safe for concurrent use, and Charge must check and record atomically.
+type Ledger interface {
+	// Charge records amount in currency for caller if, for every limit, the
+	// caller's charges within the limit's window plus amount stay within the
+	// limit. On success it returns an ID that Refund accepts. Otherwise it
+	// returns the usage of a limit that would be exceeded and records
+	// nothing.
+	Charge(ctx context.Context, caller, currency string, amount float64, limits []BudgetLimit) (id string, exceeded *BudgetUsage, err error)
+
+	// Refund removes a charge recorded by Charge.
+	Refund(ctx context.Context, caller, id string) error
+}
+
+// BudgetOptions configures the BudgetGuard middleware.
+type BudgetOptions struct {
+	// Registry is searched for the action a request invokes; its
+	// Safety.Cost is the amount charged.
+	Registry *Registry
+
+	// Source, if set, supplies the registry per request and takes precedence
+	// over Registry, as in Options.
+	Source RegistrySource
+
+	// Limits apply to every caller. A cost in a currency with no limit is
+	// rejected.
+	Limits []BudgetLimit
+
+	// LimitsFor optionally returns per-caller limits, replacing Limits.
+	LimitsFor func(caller string) []BudgetLimit
+
+	// Ledger records charges. Defaults to a new MemoryLedger.
+	Ledger Ledger
+
+	// Caller identifies whose budget a request is charged to. Defaults to a
+	// single shared budget.
+	Caller CallerFunc
+}
+
+// BudgetGuard returns a middleware that caps agent spending on cost-bearing
+// actions. For a request that invokes an action with Safety.Cost, whatever
+// its Accept header, the cost is charged to the caller's budget before the
+// handler runs and refunded if the handler responds with an error status. A
+// request that would exceed a limit is rejected with a 402 HAC error, code
+// "budget_exceeded", whose recovery states the remaining allowance and when
+// it resets; clients that do not ask for HAC get the same text as a plain
+// body. Dry runs are not charged.
+//
+// Place it inside Middleware so that dry runs are recognized:
+//
+//	hac.Middleware(opts)(hac.BudgetGuard(budgetOpts)(mux))
+func BudgetGuard(opts BudgetOptions) func(http.Handler) http.Handler {
+	if opts.Registry == nil {
+		opts.Registry = NewRegistry()
+	}
+	if opts.Ledger == nil {
+		opts.Ledger = NewMemoryLedger()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IsDryRun(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			a, ok := currentRegistry(opts.Source, opts.Registry).MatchAction(r.Method, r.URL.Path)
+			if !ok || a.Safety == nil || a.Safety.Cost == nil || a.Safety.Cost.Amount <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cost := a.Safety.Cost
+
+			caller := ""
+			if opts.Caller != nil {
+				caller = opts.Caller(r)
+			}
+			all := opts.Limits
+			if opts.LimitsFor != nil {
+				all = opts.LimitsFor(caller)
+			}
+			var limits []BudgetLimit
+			for _, l := range all {
+				if l.Currency == cost.Currency {
+					limits = append(limits, l)
+				}
+			}
+			if len(limits) == 0 {
+				writeBudgetExceeded(w, r, *cost, BudgetUsage{Limit: BudgetLimit{Currency: cost.Currency}})
+				return
+			}
+
+			id, exceeded, err := opts.Ledger.Charge(r.Context(), caller, cost.Currency, cost.Amount, limits)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if exceeded != nil {
+				writeBudgetExceeded(w, r, *cost, *exceeded)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			refund := true
+			defer func() {
+				if refund {
+					opts.Ledger.Refund(context.WithoutCancel(r.Context()), caller, id)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+			refund = sw.code >= 400
+		})
+	}
+}
+
+// writeBudgetExceeded rejects a charge that does not fit the budget.
+func writeBudgetExceeded(w http.ResponseWriter, r *http.Request, cost Cost, u BudgetUsage) {
+	amount := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64) + " " + cost.Currency
+	}
+	hacErr := &HACError{Code: "budget_exceeded"}
+	if u.Limit.Window == 0 {
+		hacErr.Message = "No spending budget is configured for " + cost.Currency + "."
+		hacErr.Recovery = &Recovery{
+			Description: "This action costs " + amount(cost.Amount) + ", which cannot be charged to your budget. Ask the user to arrange a budget in " + cost.Currency + ".",
+		}
+		writeBudgetError(w, r, hacErr)
+		return
+	}
+
+	hacErr.Message = fmt.Sprintf("This action costs %s, which exceeds the remaining budget of %s.",
+		amount(cost.Amount), amount(u.Remaining()))
+	desc := fmt.Sprintf("Spent %s of %s allowed per %s; %s remaining.",
+		amount(u.Spent), amount(u.Limit.Amount), u.Limit.Window, amount(u.Remaining()))
+	if u.ResetAt.IsZero() {
+		desc += " The cost exceeds the whole allowance, so waiting will not help; ask the user to raise the budget."
+	} else {
+		hacErr.Retryable = true
+		hacErr.RetryAfter = int(math.Ceil(time.Until(u.ResetAt).Seconds()))
+		if hacErr.RetryAfter < 1 {
+			hacErr.RetryAfter = 1
+		}
+		desc += fmt.Sprintf(" Enough allowance frees up at %s; retry then, or ask the user to raise the budget.",
+			u.ResetAt.UTC().Format(time.RFC3339))
+	}
+	hacErr.Recovery = &Recovery{Description: desc}
+	writeBudgetError(w, r, hacErr)
+}
+
+// writeBudgetError writes hacErr as a HAC error, or as plain text to
+// clients that do not ask for HAC.
+func writeBudgetError(w http.ResponseWriter, r *http.Request, hacErr *HACError) {
+	if wantsHAC(r.Header.Get("Accept")) {
+		writeHACError(w, r, http.StatusPaymentRequired, hacErr)
+		return
+	}
+	if hacErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(hacErr.RetryAfter))
+	}
+	http.Error(w, hacErr.Message+" "+hacErr.Recovery.Description, http.StatusPaymentRequired)
+}
+
+// statusWriter records the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code  int
+	wrote bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.code = code
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MemoryLedger is an in-memory Ledger.
+type MemoryLedger struct {
+	mu      sync.Mutex
+	charges map[string][]ledgerCharge // by caller, oldest first
+	nextID  uint64
+	now     func() time.Time
+}
+
+type ledgerCharge struct {
+	id       string
+	currency string
+	amount   float64
+	at       time.Time
+}
+
+// NewMemoryLedger creates an empty MemoryLedger.
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{
+		charges: make(map[string][]ledgerCharge),
+		now:     time.Now,
+	}
+}
+
+// Charge implements Ledger.
+func (l *MemoryLedger) Charge(_ context.Context, caller, currency string, amount float64, limits []BudgetLimit) (string, *BudgetUsage, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	// Forget charges in this currency that no limit covers any more. Charges
+	// in other currencies are kept: their limits are not known here.
+	var longest time.Duration
+	for _, lim := range limits {
+		if lim.Currency == currency {
+			longest = max(longest, lim.Window)
+		}
+	}
+	charges := slices.DeleteFunc(l.charges[caller], func(c ledgerCharge) bool {
+		return c.currency == currency && now.Sub(c.at) >= longest
+	})
+	l.charges[caller] = charges
+
+	for _, lim := range limits {
+		var window []ledgerCharge
+		spent := 0.0
+		for _, c := range charges {
+			if c.currency == lim.Currency && now.Sub(c.at) < lim.Window {
+				window = append(window, c)
+				spent += c.amount
+			}
+		}
+		if spent+amount <= lim.Amount {
+			continue
+		}
+		u := &BudgetUsage{Limit: lim, Spent: spent}
+		if amount <= lim.Amount {
+			freed := 0.0
+			for _, c := range window {
+				freed += c.amount
+				if spent-freed+amount <= lim.Amount {
+					u.ResetAt = c.at.Add(lim.Window)
+					break
+				}
+			}
+		}
+		return "", u, nil
+	}
+
+	l.nextID++
+	id := strconv.FormatUint(l.nextID, 10)
+	l.charges[caller] = append(charges, ledgerCharge{id: id, currency: currency, amount: amount, at: now})
+	return id, nil, nil
+}
+
+// Refund implements Ledger.
+func (l *MemoryLedger) Refund(_ context.Context, caller, id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	charges := l.charges[caller]
+	for i, c := range charges {
+		if c.id == id {
+			l.charges[caller] = append(charges[:i:i], charges[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func budgetRegistry(t *testing.T) *Registry {
+	t.Helper()
+	reg := NewRegistry()
+	reg.Get("/orders").Actions(Action{
+		Rel:         "create",
+		Method:      "POST",
+		Href:        "/orders",
+		Description: "Place an order; the card is charged.",
+		Safety:      &Safety{Mutability: Reversible, BlastRadius: Self, Cost: &Cost{Amount: 40, Currency: "USD"}},
+	}).MustRegister()
+	return reg
+}
+
+func budgetRequest(caller string) *http.Request {
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req.Header.Set("Accept", MediaType)
+	req.Header.Set("X-Caller", caller)
+	return req
+}
+
+func TestBudgetGuard(t *testing.T) {
+	ledger := NewMemoryLedger()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	ledger.now = func() time.Time { return now }
+
+	status := http.StatusCreated
+	var calls int
+	h := BudgetGuard(BudgetOptions{
+		Registry: budgetRegistry(t),
+		Limits:   []BudgetLimit{{Currency: "USD", Amount: 100, Window: time.Hour}},
+		Ledger:   ledger,
+		Caller:   func(r *http.Request) string { return r.Header.Get("X-Caller") },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+	}))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, budgetRequest("alice"))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("call %d: status = %d", i, rec.Code)
+		}
+		now = now.Add(10 * time.Minute)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, budgetRequest("alice"))
+	if rec.Code != http.StatusPaymentRequired || calls != 2 {
+		t.Fatalf("over budget: status = %d, calls = %d", rec.Code, calls)
+	}
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Error.Code != "budget_exceeded" {
+		t.Fatalf("body = %s", rec.Body)
+	}
+	if !env.Error.Retryable || env.Error.Recovery == nil ||
+		!strings.Contains(env.Error.Recovery.Description, "20 USD remaining") ||
+		!strings.Contains(env.Error.Recovery.Description, "2026-01-01T13:00:00Z") {
+		t.Errorf("error = %+v", env.Error)
+	}
+
+	// Other callers have their own budget.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, budgetRequest("bob"))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("bob: status = %d", rec.Code)
+	}
+
+	// Failed calls are refunded.
+	status = http.StatusBadRequest
+	h.ServeHTTP(httptest.NewRecorder(), budgetRequest("bob"))
+	status = http.StatusCreated
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, budgetRequest("bob"))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("after refund: status = %d", rec.Code)
+	}
+
+	// The oldest charge leaves the window an hour after it was made.
+	now = time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, budgetRequest("alice"))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("after reset: status = %d", rec.Code)
+	}
+}
+
+func TestBudgetGuardSkips(t *testing.T) {
+	h := BudgetGuard(BudgetOptions{
+		Registry: budgetRegistry(t),
+		Limits:   []BudgetLimit{{Currency: "USD", Amount: 10, Window: time.Hour}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Dry runs are not charged.
+	req := budgetRequest("")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req.WithContext(withDryRun(req.Context())))
+	if rec.Code != http.StatusOK {
+		t.Errorf("dry run: status = %d", rec.Code)
+	}
+
+	// A cost larger than the whole allowance is not retryable.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, budgetRequest(""))
+	var env ErrorEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if rec.Code != http.StatusPaymentRequired || env.Error == nil || env.Error.Retryable {
+		t.Errorf("oversized cost: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBudgetGuardNonHACClient(t *testing.T) {
+	var calls int
+	h := BudgetGuard(BudgetOptions{
+		Registry: budgetRegistry(t),
+		Limits:   []BudgetLimit{{Currency: "USD", Amount: 50, Window: time.Hour}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+
+	for i, want := range []int{http.StatusOK, http.StatusPaymentRequired} {
+		req := httptest.NewRequest("POST", "/orders", nil)
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("call %d: status = %d, want %d", i, rec.Code, want)
+		}
+		if want == http.StatusPaymentRequired {
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") ||
+				!strings.Contains(rec.Body.String(), "exceeds the remaining budget") || rec.Header().Get("Retry-After") == "" {
+				t.Errorf("plain rejection: %s %v %s", ct, rec.Header(), rec.Body)
+			}
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler calls = %d, want 1", calls)
+	}
+}
+
+func TestBudgetGuardUnbudgetedCurrency(t *testing.T) {
+	h := BudgetGuard(BudgetOptions{
+		Registry: budgetRegistry(t),
+		Limits:   []BudgetLimit{{Currency: "EUR", Amount: 100, Window: time.Hour}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, budgetRequest(""))
+	if rec.Code != http.StatusPaymentRequired || !strings.Contains(rec.Body.String(), "budget_exceeded") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestMemoryLedgerMultipleLimits(t *testing.T) {
+	ledger := NewMemoryLedger()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ledger.now = func() time.Time { return now }
+	ctx := context.Background()
+	limits := []BudgetLimit{
+		{Currency: "USD", Amount: 10, Window: time.Minute},
+		{Currency: "USD", Amount: 15, Window: time.Hour},
+	}
+
+	for _, amount := range []float64{5, 5} {
+		if _, u, _ := ledger.Charge(ctx, "a", "USD", amount, limits); u != nil {
+			t.Fatalf("charge %v rejected: %+v", amount, u)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	if _, u, _ := ledger.Charge(ctx, "a", "USD", 6, limits); u == nil || u.Limit.Window != time.Hour || u.Spent != 10 {
+		t.Errorf("hourly limit not enforced: %+v", u)
+	}
+	id, u, _ := ledger.Charge(ctx, "a", "USD", 5, limits)
+	if u != nil {
+		t.Fatalf("charge within both limits rejected: %+v", u)
+	}
+	ledger.Refund(ctx, "a", id)
+	if _, u, _ := ledger.Charge(ctx, "a", "USD", 5, limits); u != nil {
+		t.Errorf("refunded charge still counted: %+v", u)
+	}
+}
+
+func TestMemoryLedgerCurrencies(t *testing.T) {
+	ledger := NewMemoryLedger()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ledger.now = func() time.Time { return now }
+	ctx := context.Background()
+	eur := []BudgetLimit{{Currency: "EUR", Amount: 100, Window: 30 * 24 * time.Hour}}
+	usd := []BudgetLimit{{Currency: "USD", Amount: 10, Window: time.Hour}}
+
+	if _, u, _ := ledger.Charge(ctx, "a", "EUR", 90, eur); u != nil {
+		t.Fatalf("EUR charge rejected: %+v", u)
+	}
+	now = now.Add(2 * time.Hour)
+	// A USD charge must not prune the EUR charge, which is still within
+	// its 30-day window.
+	if _, u, _ := ledger.Charge(ctx, "a", "USD", 5, usd); u != nil {
+		t.Fatalf("USD charge rejected: %+v", u)
+	}
+	if _, u, _ := ledger.Charge(ctx, "a", "EUR", 20, eur); u == nil || u.Spent != 90 {
+		t.Errorf("EUR limit not enforced after a USD charge: %+v", u)
+	}
+}
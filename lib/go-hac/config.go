@@ -1,8 +1,16 @@
 package hac
 
 import (
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // PathResolver extracts the route pattern from a request. The middleware uses
@@ -16,11 +24,32 @@ func StdlibPathResolver(r *http.Request) string {
 	return r.Pattern
 }
 
+// MuxPathResolver resolves the route pattern by asking mux which pattern
+// matches the request. Use it when the middleware wraps the ServeMux itself:
+// r.Pattern is only set once the mux has routed the request, so
+// StdlibPathResolver sees an empty pattern outside the mux.
+func MuxPathResolver(mux *http.ServeMux) PathResolver {
+	return func(r *http.Request) string {
+		if r.Pattern != "" {
+			return r.Pattern
+		}
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+}
+
 // RouteConfig holds HAC metadata for a specific route.
 type RouteConfig struct {
 	Description string
 	Actions     []Action
 	Related     []RelatedResource
+
+	// Tags group related routes, as OpenAPI tags do.
+	Tags []string
+
+	// DryRun marks the route as able to preview a mutation when the agent
+	// sends Prefer: dry-run. See IsDryRun.
+	DryRun bool
 }
 
 // routeKey identifies a route by method and pattern.
@@ -31,29 +60,44 @@ type routeKey struct {
 
 // Registry stores HAC metadata for routes. It is safe for concurrent reads
 // after initial configuration; concurrent writes are protected by a mutex.
+// A frozen registry (see Freeze) is immutable and read without locking.
 type Registry struct {
 	mu     sync.RWMutex
 	routes map[routeKey]*RouteConfig
+	errors map[string]HACError
+	frozen atomic.Bool
+
+	// actions caches the action index; registrations reset it.
+	actions atomic.Pointer[actionIndex]
+
+	// inferSafety is set by InferSafety.
+	inferSafety bool
 }
 
 // NewRegistry creates an empty Registry.
 func NewRegistry() *Registry {
 	return &Registry{
 		routes: make(map[routeKey]*RouteConfig),
+		errors: make(map[string]HACError),
 	}
 }
 
 // Lookup returns the RouteConfig for the given method and pattern, or nil.
+// The config is shared with the registry and must not be modified.
 func (reg *Registry) Lookup(method, pattern string) *RouteConfig {
-	reg.mu.RLock()
-	defer reg.mu.RUnlock()
+	if !reg.frozen.Load() {
+		reg.mu.RLock()
+		defer reg.mu.RUnlock()
+	}
 	return reg.routes[routeKey{method: method, pattern: pattern}]
 }
 
 // Routes returns all registered route keys as (method, pattern) pairs.
 func (reg *Registry) Routes() [][2]string {
-	reg.mu.RLock()
-	defer reg.mu.RUnlock()
+	if !reg.frozen.Load() {
+		reg.mu.RLock()
+		defer reg.mu.RUnlock()
+	}
 	pairs := make([][2]string, 0, len(reg.routes))
 	for k := range reg.routes {
 		pairs = append(pairs, [2]string{k.method, k.pattern})
@@ -61,6 +105,101 @@ func (reg *Registry) Routes() [][2]string {
 	return pairs
 }
 
+// Actions returns the distinct actions declared across all registered routes,
+// deduplicated by method and href and sorted by href, then method.
+func (reg *Registry) Actions() []Action {
+	return slices.Clone(reg.actionIndex().actions)
+}
+
+// MatchAction finds the declared action that a request with the given method
+// and concrete path would invoke, matching action hrefs as URI templates. A
+// literal href is preferred over a template, and a template with fewer
+// variables over one with more.
+func (reg *Registry) MatchAction(method, path string) (Action, bool) {
+	for _, a := range reg.actionIndex().byMethod[strings.ToUpper(method)] {
+		if matchTemplate(a.Href, path) {
+			return a, true
+		}
+	}
+	return Action{}, false
+}
+
+// actionIndex holds the registry's actions, built once and reused until the
+// next registration, so per-request lookups such as MatchAction do not walk
+// every route.
+type actionIndex struct {
+	// actions is the result of Actions.
+	actions []Action
+	// byMethod holds the actions by upper-case method, ordered by the
+	// number of template variables in their href.
+	byMethod map[string][]Action
+}
+
+// actionIndex returns the registry's action index, building it if a
+// registration has invalidated it.
+func (reg *Registry) actionIndex() *actionIndex {
+	if idx := reg.actions.Load(); idx != nil {
+		return idx
+	}
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if idx := reg.actions.Load(); idx != nil {
+		return idx
+	}
+
+	keys := make([]routeKey, 0, len(reg.routes))
+	for k := range reg.routes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].pattern != keys[j].pattern {
+			return keys[i].pattern < keys[j].pattern
+		}
+		return keys[i].method < keys[j].method
+	})
+	idx := &actionIndex{byMethod: make(map[string][]Action)}
+	seen := make(map[routeKey]bool)
+	for _, k := range keys {
+		for _, a := range reg.routes[k].Actions {
+			ak := routeKey{method: a.Method, pattern: a.Href}
+			if seen[ak] {
+				continue
+			}
+			seen[ak] = true
+			idx.actions = append(idx.actions, a)
+		}
+	}
+	sort.SliceStable(idx.actions, func(i, j int) bool {
+		if idx.actions[i].Href != idx.actions[j].Href {
+			return idx.actions[i].Href < idx.actions[j].Href
+		}
+		return idx.actions[i].Method < idx.actions[j].Method
+	})
+	for _, a := range idx.actions {
+		m := strings.ToUpper(a.Method)
+		idx.byMethod[m] = append(idx.byMethod[m], a)
+	}
+	for _, actions := range idx.byMethod {
+		sort.SliceStable(actions, func(i, j int) bool {
+			return len(templateVars(actions[i].Href)) < len(templateVars(actions[j].Href))
+		})
+	}
+	reg.actions.Store(idx)
+	return idx
+}
+
+// sortedRoutes returns the registry's routes sorted by pattern, then method.
+func sortedRoutes(reg *Registry) [][2]string {
+	routes := reg.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i][1] != routes[j][1] {
+			return routes[i][1] < routes[j][1]
+		}
+		return routes[i][0] < routes[j][0]
+	})
+	return routes
+}
+
 // Get starts building a route config for a GET route.
 func (reg *Registry) Get(pattern string) *RouteBuilder {
 	return &RouteBuilder{registry: reg, method: "GET", pattern: pattern}
@@ -99,6 +238,9 @@ type RouteBuilder struct {
 	description string
 	actions     []Action
 	related     []RelatedResource
+	tags        []string
+	dryRun      bool
+	group       *RouteGroup
 }
 
 // Description sets the resource description.
@@ -119,14 +261,353 @@ func (b *RouteBuilder) Related(related ...RelatedResource) *RouteBuilder {
 	return b
 }
 
-// Register stores the built route config in the registry.
-func (b *RouteBuilder) Register() {
+// Tags sets the route's tags.
+func (b *RouteBuilder) Tags(tags ...string) *RouteBuilder {
+	b.tags = tags
+	return b
+}
+
+// DryRun declares that the route's handler honors IsDryRun and can preview
+// the mutation without performing it.
+func (b *RouteBuilder) DryRun() *RouteBuilder {
+	b.dryRun = true
+	return b
+}
+
+// Register validates the built route config and stores it in the registry.
+// It returns an error, and leaves the registry unchanged, if the config is
+// invalid (see Registry.Validate) or a route with the same method and pattern
+// is already registered.
+func (b *RouteBuilder) Register() error {
+	pattern := b.pattern
 	cfg := &RouteConfig{
 		Description: b.description,
 		Actions:     b.actions,
 		Related:     b.related,
+		Tags:        b.tags,
+		DryRun:      b.dryRun,
+	}
+	if b.group != nil {
+		pattern = b.group.apply(pattern, cfg)
+	}
+	if err := validateRoute(b.method, pattern, cfg); err != nil {
+		return err
 	}
+	k := routeKey{method: b.method, pattern: pattern}
 	b.registry.mu.Lock()
 	defer b.registry.mu.Unlock()
-	b.registry.routes[routeKey{method: b.method, pattern: b.pattern}] = cfg
+	if b.registry.frozen.Load() {
+		return fmt.Errorf("hac: %s %s: %w", b.method, pattern, ErrRegistryFrozen)
+	}
+	if _, ok := b.registry.routes[k]; ok {
+		return fmt.Errorf("hac: %s %s: %w", b.method, pattern, ErrDuplicateRoute)
+	}
+	if b.registry.inferSafety {
+		cfg.Actions = inferActions(cfg.Actions)
+	}
+	b.registry.routes[k] = cfg
+	b.registry.actions.Store(nil)
+	return nil
+}
+
+// MustRegister is like Register but panics if the route cannot be
+// registered. It is intended for route tables set up at program start.
+func (b *RouteBuilder) MustRegister() {
+	if err := b.Register(); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterError adds e to the registry's error catalog under e.Code. When a
+// wrapped error response carries that code, the middleware fills in the
+// message, retry hints and recovery the response leaves out. It returns an
+// error if the code is empty or already registered.
+func (reg *Registry) RegisterError(e HACError) error {
+	if e.Code == "" {
+		return errors.New("hac: error catalog entry: code is required")
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.frozen.Load() {
+		return fmt.Errorf("hac: error %q: %w", e.Code, ErrRegistryFrozen)
+	}
+	if _, ok := reg.errors[e.Code]; ok {
+		return fmt.Errorf("hac: error %q: %w", e.Code, ErrDuplicateError)
+	}
+	reg.errors[e.Code] = e
+	return nil
+}
+
+// ErrorCatalog returns the registered error catalog entries sorted by code.
+func (reg *Registry) ErrorCatalog() []HACError {
+	if !reg.frozen.Load() {
+		reg.mu.RLock()
+		defer reg.mu.RUnlock()
+	}
+	entries := make([]HACError, 0, len(reg.errors))
+	for _, e := range reg.errors {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Code < entries[j].Code })
+	return entries
+}
+
+// lookupError returns the catalog entry for code.
+func (reg *Registry) lookupError(code string) (HACError, bool) {
+	if !reg.frozen.Load() {
+		reg.mu.RLock()
+		defer reg.mu.RUnlock()
+	}
+	e, ok := reg.errors[code]
+	return e, ok
+}
+
+// ErrDuplicateError is returned by Registry.RegisterError when the code is
+// already in the catalog.
+var ErrDuplicateError = errors.New("error code already registered")
+
+// Freeze makes the registry immutable: later registrations fail with
+// ErrRegistryFrozen, and reads no longer take the lock. Reloader freezes
+// every snapshot it serves.
+//
+// Freeze deep-copies the registered configs, so slices and pointers the
+// caller passed to RouteBuilder may be reused afterwards. Values returned by
+// Lookup and MatchAction still share memory with the registry and must be
+// treated as read-only.
+func (reg *Registry) Freeze() {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.frozen.Load() {
+		return
+	}
+	for k, cfg := range reg.routes {
+		reg.routes[k] = cloneRouteConfig(cfg)
+	}
+	reg.actions.Store(nil)
+	reg.frozen.Store(true)
+}
+
+// clone returns an unfrozen deep copy of reg.
+func (reg *Registry) clone() *Registry {
+	if !reg.frozen.Load() {
+		reg.mu.RLock()
+		defer reg.mu.RUnlock()
+	}
+	c := NewRegistry()
+	for k, cfg := range reg.routes {
+		c.routes[k] = cloneRouteConfig(cfg)
+	}
+	maps.Copy(c.errors, reg.errors)
+	c.inferSafety = reg.inferSafety
+	return c
+}
+
+// cloneRouteConfig returns a deep copy of cfg. Enum and Default values are
+// JSON scalars and are copied shallowly.
+func cloneRouteConfig(cfg *RouteConfig) *RouteConfig {
+	c := *cfg
+	c.Actions = slices.Clone(cfg.Actions)
+	for i := range c.Actions {
+		c.Actions[i] = cloneAction(c.Actions[i])
+	}
+	c.Related = slices.Clone(cfg.Related)
+	c.Tags = slices.Clone(cfg.Tags)
+	return &c
+}
+
+func cloneAction(a Action) Action {
+	if a.Safety != nil {
+		s := *a.Safety
+		if s.Cost != nil {
+			cost := *s.Cost
+			s.Cost = &cost
+		}
+		a.Safety = &s
+	}
+	a.Fields = cloneFields(a.Fields)
+	a.Preconditions = slices.Clone(a.Preconditions)
+	a.Headers = maps.Clone(a.Headers)
+	a.InferredSafety = slices.Clone(a.InferredSafety)
+	return a
+}
+
+func cloneFields(fields []Field) []Field {
+	if fields == nil {
+		return nil
+	}
+	out := make([]Field, len(fields))
+	for i, f := range fields {
+		f.Enum = slices.Clone(f.Enum)
+		f.Minimum = clonePtr(f.Minimum)
+		f.Maximum = clonePtr(f.Maximum)
+		f.MinLength = clonePtr(f.MinLength)
+		f.MaxLength = clonePtr(f.MaxLength)
+		if f.Items != nil {
+			items := cloneFields([]Field{*f.Items})[0]
+			f.Items = &items
+		}
+		f.Properties = cloneFields(f.Properties)
+		out[i] = f
+	}
+	return out
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// ErrRegistryFrozen is returned when registering into a frozen registry.
+var ErrRegistryFrozen = errors.New("registry is frozen")
+
+// ErrDuplicateRoute is returned by RouteBuilder.Register when the method and
+// pattern are already registered.
+var ErrDuplicateRoute = errors.New("route already registered")
+
+// Validate checks every registered route the way Register does and returns
+// all problems found, joined, or nil. Call it at startup to catch configs
+// that were registered before validation existed or modified in place.
+func (reg *Registry) Validate() error {
+	var errs []error
+	for _, pair := range sortedRoutes(reg) {
+		if cfg := reg.Lookup(pair[0], pair[1]); cfg != nil {
+			errs = append(errs, validateRoute(pair[0], pair[1], cfg))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// actionMethods are the HTTP methods the spec allows in actions.
+var actionMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// fieldTypes are the JSON Schema types the spec allows for fields.
+var fieldTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "boolean": true, "array": true, "object": true,
+}
+
+// validateRoute checks a route config against the spec: known HTTP methods,
+// mutability and blast_radius enum values, JSON Schema field types, and
+// required members. A ServeMux pattern's method must match the route method.
+// Softer problems such as malformed durations and currency codes are left to
+// Lint.
+func validateRoute(method, pattern string, cfg *RouteConfig) error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("hac: %s %s: "+format, append([]any{method, pattern}, args...)...))
+	}
+
+	if !actionMethods[method] && method != http.MethodConnect && method != http.MethodTrace {
+		fail("invalid method %q", method)
+	}
+	if pattern == "" {
+		fail("empty pattern")
+	} else if m, _, ok := strings.Cut(pattern, " "); ok && m != method && !strings.HasPrefix(m, "/") {
+		fail("pattern method %q does not match route method", m)
+	}
+
+	for i, a := range cfg.Actions {
+		name := a.Rel
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		for _, msg := range actionProblems(a) {
+			fail("action %s: %s", name, msg)
+		}
+	}
+	for i, rel := range cfg.Related {
+		if rel.Rel == "" || rel.Href == "" {
+			fail("related resource #%d: rel and href are required", i)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// actionProblems returns the spec violations in a.
+func actionProblems(a Action) []string {
+	var problems []string
+	if a.Rel == "" {
+		problems = append(problems, "rel is required")
+	}
+	if a.Href == "" {
+		problems = append(problems, "href is required")
+	}
+	if !actionMethods[a.Method] {
+		problems = append(problems, fmt.Sprintf("invalid method %q", a.Method))
+	}
+
+	if s := a.Safety; s != nil {
+		switch s.Mutability {
+		case "", ReadOnly, Reversible, Irreversible:
+		default:
+			problems = append(problems, fmt.Sprintf("invalid mutability %q", s.Mutability))
+		}
+		switch s.BlastRadius {
+		case "", Self, SelfAndAssociated, Many, All:
+		default:
+			problems = append(problems, fmt.Sprintf("invalid blast_radius %q", s.BlastRadius))
+		}
+	}
+
+	return append(problems, fieldsProblems("", a.Fields)...)
+}
+
+// fieldsProblems checks a list of fields, recursing into items and
+// properties. prefix is the dotted path of the enclosing field, if any.
+func fieldsProblems(prefix string, fields []Field) []string {
+	var problems []string
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		switch {
+		case f.Name == "" && prefix == "":
+			problems = append(problems, "field name is required")
+		case f.Name == "":
+			problems = append(problems, fmt.Sprintf("field %q: property name is required", strings.TrimSuffix(prefix, ".")))
+		case seen[f.Name]:
+			problems = append(problems, fmt.Sprintf("duplicate field %q", prefix+f.Name))
+		}
+		seen[f.Name] = true
+		problems = append(problems, fieldProblems(prefix+f.Name, f)...)
+	}
+	return problems
+}
+
+// fieldProblems checks the type and constraints of the field at path.
+func fieldProblems(path string, f Field) []string {
+	var problems []string
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("field %q: ", path)+fmt.Sprintf(format, args...))
+	}
+	if !fieldTypes[f.Type] {
+		fail("invalid type %q", f.Type)
+	}
+	if f.Pattern != "" {
+		if _, err := compilePattern(f.Pattern); err != nil {
+			fail("invalid pattern: %v", err)
+		}
+	}
+	if f.Minimum != nil && f.Maximum != nil && *f.Minimum > *f.Maximum {
+		fail("minimum %v exceeds maximum %v", *f.Minimum, *f.Maximum)
+	}
+	if f.MinLength != nil && f.MaxLength != nil && *f.MinLength > *f.MaxLength {
+		fail("minLength %d exceeds maxLength %d", *f.MinLength, *f.MaxLength)
+	}
+	if f.Items != nil {
+		if f.Type != "array" {
+			fail("items given for type %q", f.Type)
+		}
+		problems = append(problems, fieldProblems(path+"[]", *f.Items)...)
+	}
+	if len(f.Properties) > 0 {
+		if f.Type != "object" {
+			fail("properties given for type %q", f.Type)
+		}
+		problems = append(problems, fieldsProblems(path+".", f.Properties)...)
+	}
+	return problems
 }
@@ -1,13 +1,19 @@
 package hac
 
-import "testing"
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
 
 func TestRegistryLookup(t *testing.T) {
 	reg := NewRegistry()
 	reg.Get("/users/{id}").
 		Description("A user account.").
 		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"}).
-		Register()
+		MustRegister()
 
 	cfg := reg.Lookup("GET", "/users/{id}")
 	if cfg == nil {
@@ -30,9 +36,9 @@ func TestRegistryLookupMiss(t *testing.T) {
 
 func TestRegistryRoutes(t *testing.T) {
 	reg := NewRegistry()
-	reg.Get("/users").Description("Users list.").Register()
-	reg.Post("/users").Description("Create user.").Register()
-	reg.Delete("/users/{id}").Description("Delete user.").Register()
+	reg.Get("/users").Description("Users list.").MustRegister()
+	reg.Post("/users").Description("Create user.").MustRegister()
+	reg.Delete("/users/{id}").Description("Delete user.").MustRegister()
 
 	routes := reg.Routes()
 	if len(routes) != 3 {
@@ -50,7 +56,7 @@ func TestRouteBuilderFluent(t *testing.T) {
 		Related(
 			RelatedResource{Rel: "items", Href: "/orders/{id}/items"},
 		).
-		Register()
+		MustRegister()
 
 	cfg := reg.Lookup("PUT", "/orders/{id}")
 	if cfg == nil {
@@ -63,7 +69,7 @@ func TestRouteBuilderFluent(t *testing.T) {
 
 func TestRouteMethod(t *testing.T) {
 	reg := NewRegistry()
-	reg.Route("OPTIONS", "/test").Description("Options test.").Register()
+	reg.Route("OPTIONS", "/test").Description("Options test.").MustRegister()
 
 	if cfg := reg.Lookup("OPTIONS", "/test"); cfg == nil {
 		t.Error("expected config for OPTIONS route")
@@ -72,8 +78,291 @@ func TestRouteMethod(t *testing.T) {
 
 func TestPatchBuilder(t *testing.T) {
 	reg := NewRegistry()
-	reg.Patch("/items/{id}").Description("Patch item.").Register()
+	reg.Patch("/items/{id}").Description("Patch item.").MustRegister()
 	if cfg := reg.Lookup("PATCH", "/items/{id}"); cfg == nil {
 		t.Error("expected config for PATCH route")
 	}
 }
+
+func TestRegistryActions(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Actions(
+			Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"},
+			Action{Rel: "edit", Method: "PATCH", Href: "/users/{id}"},
+		).
+		MustRegister()
+	reg.Get("/users").
+		Actions(
+			Action{Rel: "create", Method: "POST", Href: "/users"},
+			Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"},
+		).
+		MustRegister()
+
+	actions := reg.Actions()
+	if len(actions) != 3 {
+		t.Fatalf("actions count = %d, want 3", len(actions))
+	}
+	if actions[0].Href != "/users" || actions[1].Method != "DELETE" || actions[2].Method != "PATCH" {
+		t.Errorf("actions not sorted by href then method: %+v", actions)
+	}
+}
+
+func TestMuxPathResolver(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	resolve := MuxPathResolver(mux)
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	if got := resolve(req); got != "GET /users/{id}" {
+		t.Errorf("pattern = %q, want %q", got, "GET /users/{id}")
+	}
+	req = httptest.NewRequest("GET", "/nope", nil)
+	if got := resolve(req); got != "" {
+		t.Errorf("pattern = %q, want empty", got)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder func(reg *Registry) *RouteBuilder
+		want    string
+	}{
+		{
+			name: "action method typo",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Get("/users/{id}").Actions(Action{Rel: "delete", Method: "DELET", Href: "/users/{id}"})
+			},
+			want: `action delete: invalid method "DELET"`,
+		},
+		{
+			name: "invalid mutability",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Get("/users/{id}").Actions(Action{
+					Rel: "delete", Method: "DELETE", Href: "/users/{id}",
+					Safety: &Safety{Mutability: "destructive"},
+				})
+			},
+			want: `invalid mutability "destructive"`,
+		},
+		{
+			name: "invalid blast radius and duration",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Get("/users/{id}").Actions(Action{
+					Rel: "archive", Method: "POST", Href: "/users/{id}/archive",
+					Safety: &Safety{BlastRadius: "everything", ReversibleWithin: "30d"},
+				})
+			},
+			want: `invalid blast_radius "everything"`,
+		},
+		{
+			name: "invalid field type",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Post("/orders").Actions(Action{
+					Rel: "create", Method: "POST", Href: "/orders",
+					Fields: []Field{{Name: "qty", Type: "int"}, {Name: "qty", Type: "integer"}},
+				})
+			},
+			want: `field "qty": invalid type "int"`,
+		},
+		{
+			name: "invalid nested field",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Post("/orders").Actions(Action{
+					Rel: "create", Method: "POST", Href: "/orders",
+					Fields: []Field{{Name: "lines", Type: "array", Items: &Field{Type: "object", Properties: []Field{
+						{Name: "sku", Type: "string", Pattern: "[a-z"},
+					}}}},
+				})
+			},
+			want: `field "lines[].sku": invalid pattern`,
+		},
+		{
+			name: "inverted bounds",
+			builder: func(reg *Registry) *RouteBuilder {
+				min, max := 10.0, 1.0
+				return reg.Post("/orders").Actions(Action{
+					Rel: "create", Method: "POST", Href: "/orders",
+					Fields: []Field{{Name: "qty", Type: "integer", Minimum: &min, Maximum: &max}},
+				})
+			},
+			want: `field "qty": minimum 10 exceeds maximum 1`,
+		},
+		{
+			name: "items on a scalar",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Post("/orders").Actions(Action{
+					Rel: "create", Method: "POST", Href: "/orders",
+					Fields: []Field{{Name: "qty", Type: "integer", Items: &Field{Type: "integer"}}},
+				})
+			},
+			want: `field "qty": items given for type "integer"`,
+		},
+		{
+			name: "missing rel and href",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Get("/orders").Actions(Action{Method: "GET"})
+			},
+			want: "action #0: rel is required",
+		},
+		{
+			name: "pattern method mismatch",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Get("POST /orders")
+			},
+			want: `pattern method "POST" does not match`,
+		},
+		{
+			name: "invalid route method",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Route("get", "/orders")
+			},
+			want: `invalid method "get"`,
+		},
+		{
+			name: "related without href",
+			builder: func(reg *Registry) *RouteBuilder {
+				return reg.Get("/orders").Related(RelatedResource{Rel: "customer"})
+			},
+			want: "related resource #0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := NewRegistry()
+			err := tt.builder(reg).Register()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Register() = %v, want error containing %q", err, tt.want)
+			}
+			if len(reg.Routes()) != 0 {
+				t.Error("invalid route was registered")
+			}
+		})
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Get("/users").Description("First.").Register(); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	err := reg.Get("/users").Description("Second.").Register()
+	if !errors.Is(err, ErrDuplicateRoute) {
+		t.Fatalf("Register() = %v, want ErrDuplicateRoute", err)
+	}
+	if got := reg.Lookup("GET", "/users").Description; got != "First." {
+		t.Errorf("description = %q, want the first registration", got)
+	}
+	// The same pattern under another method is a different route.
+	if err := reg.Post("/users").Register(); err != nil {
+		t.Errorf("Register POST: %v", err)
+	}
+}
+
+func TestMustRegister(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users").MustRegister()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustRegister did not panic on duplicate")
+		}
+	}()
+	reg.Get("/users").MustRegister()
+}
+
+func TestRegistryValidate(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"}).
+		MustRegister()
+	reg.Get("/orders").MustRegister()
+	if err := reg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	reg.Lookup("GET", "/users/{id}").Actions[0].Method = "REMOVE"
+	reg.Lookup("GET", "/orders").Related = []RelatedResource{{Rel: "users"}}
+	err := reg.Validate()
+	if err == nil {
+		t.Fatal("Validate: want error")
+	}
+	for _, want := range []string{`GET /users/{id}: action delete: invalid method "REMOVE"`, "GET /orders: related resource #0"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+}
+
+func TestRegistryMatchAction(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Actions(
+			Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"},
+			Action{Rel: "search", Method: "POST", Href: "/users/search"},
+			Action{Rel: "update", Method: "POST", Href: "/users/{id}"},
+		).
+		MustRegister()
+
+	if a, ok := reg.MatchAction("DELETE", "/users/42"); !ok || a.Rel != "delete" {
+		t.Errorf("DELETE /users/42 = %+v, %v", a, ok)
+	}
+	if a, ok := reg.MatchAction("POST", "/users/search"); !ok || a.Rel != "search" {
+		t.Errorf("POST /users/search = %+v, %v; want the literal href", a, ok)
+	}
+	if _, ok := reg.MatchAction("PUT", "/users/42"); ok {
+		t.Error("PUT /users/42 matched")
+	}
+
+	// Registering a route refreshes the cached actions.
+	reg.Get("/users").Actions(Action{Rel: "replace", Method: "PUT", Href: "/users/{id}"}).MustRegister()
+	if a, ok := reg.MatchAction("put", "/users/42"); !ok || a.Rel != "replace" {
+		t.Errorf("PUT /users/42 after registration = %+v, %v", a, ok)
+	}
+}
+
+func TestFreezeCopies(t *testing.T) {
+	max := 10
+	actions := []Action{{Rel: "create", Method: "POST", Href: "/orders",
+		Safety: &Safety{Mutability: Reversible, Cost: &Cost{Amount: 1, Currency: "USD"}},
+		Fields: []Field{
+			{Name: "note", Type: "string", MaxLength: &max},
+			{Name: "tags", Type: "array", Items: &Field{Type: "string"}},
+			{Name: "address", Type: "object", Properties: []Field{{Name: "x", Type: "string"}}},
+		},
+		Headers: map[string]string{"X-A": "1"}}}
+	reg := NewRegistry()
+	reg.Get("/orders").Actions(actions...).Tags("orders").MustRegister()
+	reg.Freeze()
+
+	actions[0].Safety.Cost.Amount = 99
+	actions[0].Fields[1].Items.Type = "integer"
+	actions[0].Fields[2].Properties[0].Name = "y"
+	actions[0].Headers["X-A"] = "2"
+	max = 20
+
+	a := reg.Lookup("GET", "/orders").Actions[0]
+	if a.Safety.Cost.Amount != 1 || *a.Fields[0].MaxLength != 10 || a.Fields[1].Items.Type != "string" ||
+		a.Fields[2].Properties[0].Name != "x" || a.Headers["X-A"] != "1" {
+		t.Errorf("frozen action changed through caller references: %+v", a)
+	}
+}
+
+func TestRegisterError(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.RegisterError(HACError{Code: "b", Message: "B."}); err != nil {
+		t.Fatal(err)
+	}
+	reg.RegisterError(HACError{Code: "a", Message: "A."})
+	if err := reg.RegisterError(HACError{Code: "a", Message: "Again."}); !errors.Is(err, ErrDuplicateError) {
+		t.Errorf("duplicate code: err = %v", err)
+	}
+	if err := reg.RegisterError(HACError{Message: "No code."}); err == nil {
+		t.Error("no error for an entry without a code")
+	}
+	if cat := reg.ErrorCatalog(); len(cat) != 2 || cat[0].Code != "a" || cat[0].Message != "A." {
+		t.Errorf("catalog = %+v", cat)
+	}
+}
@@ -0,0 +1,192 @@
+package hac
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfirmationHeader carries the confirmation token when an agent re-sends
+// an action that requires confirmation.
+const ConfirmationHeader = "HAC-Confirmation"
+
+// DefaultConfirmationTTL is how long a confirmation token stays valid when
+// Options.ConfirmationTTL is zero.
+const DefaultConfirmationTTL = 5 * time.Minute
+
+// DefaultMaxConfirmationBody is the largest request body the middleware reads
+// to bind a confirmation token when Options.ConfirmationMaxBody is zero.
+const DefaultMaxConfirmationBody = 1 << 20
+
+// CallerFunc identifies the caller of a request, such as an API key ID or
+// an authenticated user. It returns "" for anonymous callers.
+type CallerFunc func(r *http.Request) string
+
+// requireConfirmation enforces confirmation for an action flagged with
+// confirmation_recommended. If r carries a valid token it returns r with its
+// body restored and the confirmed flag set, and a settle func to call with
+// the response status. Otherwise it writes a 428 HAC error whose recovery
+// action repeats the request with a fresh token, and returns nil.
+func requireConfirmation(w http.ResponseWriter, r *http.Request, a Action, opts Options, spent *spentTokens) (*http.Request, func(status int)) {
+	limit := opts.ConfirmationMaxBody
+	if limit <= 0 {
+		limit = DefaultMaxConfirmationBody
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	r.Body.Close()
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, nil
+	}
+	if int64(len(body)) > limit {
+		writeHACError(w, r, http.StatusRequestEntityTooLarge, &HACError{
+			Code:    "request_too_large",
+			Message: fmt.Sprintf("The request body exceeds %d bytes.", limit),
+		})
+		return nil, nil
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	caller := ""
+	if opts.Caller != nil {
+		caller = opts.Caller(r)
+	}
+	now := time.Now()
+
+	token := r.Header.Get(ConfirmationHeader)
+	if token != "" && verifyConfirmationToken(opts.ConfirmationKey, token, r, body, caller, now) {
+		// Retries of an idempotent action may reuse the token with the same
+		// Idempotency-Key: the Idempotency middleware replays them.
+		key := ""
+		if a.Idempotent {
+			key = r.Header.Get(IdempotencyKeyHeader)
+		}
+		if settle, ok := spent.use(token, key, now); ok {
+			return r.WithContext(withConfirmed(r.Context())), settle
+		}
+	}
+
+	ttl := opts.ConfirmationTTL
+	if ttl <= 0 {
+		ttl = DefaultConfirmationTTL
+	}
+	fresh := confirmationToken(opts.ConfirmationKey, r, body, caller, now.Add(ttl))
+
+	msg := "This action requires confirmation. Confirm with the user before retrying."
+	if token != "" {
+		msg = "The confirmation token is invalid or expired, or was already used. Confirm with the user again before retrying."
+	}
+	desc := a.Description
+	if desc == "" {
+		desc = a.Method + " " + a.Href
+	}
+	writeHACError(w, r, http.StatusPreconditionRequired, &HACError{
+		Code:    "confirmation_required",
+		Message: msg,
+		Recovery: &Recovery{
+			Description: "Describe the action and its consequences to the user (" + desc + "). " +
+				"If they approve, re-send the identical request with the " + ConfirmationHeader +
+				" header within " + ttl.String() + ".",
+			Actions: []Action{{
+				Rel:         "confirm",
+				Method:      r.Method,
+				Href:        r.URL.RequestURI(),
+				Description: desc,
+				Safety:      a.Safety,
+				Headers:     map[string]string{ConfirmationHeader: fresh},
+			}},
+		},
+	})
+	return nil, nil
+}
+
+// spentTokens remembers the confirmation tokens accepted by one middleware
+// until they expire, so each token confirms a single request.
+type spentTokens struct {
+	mu     sync.Mutex
+	tokens map[string]spentToken
+}
+
+type spentToken struct {
+	expires time.Time
+
+	// key is the Idempotency-Key of the request that spent the token, if
+	// its action is idempotent.
+	key string
+}
+
+// use records token as spent by a request with idempotency key key, which
+// may be empty, and reports whether the request may proceed: the token is
+// unspent, or was spent with the same non-empty key. The returned settle
+// func takes the response status and returns the token if the request that
+// spent it failed with a 5xx status, so it can be used again. Expired tokens
+// are forgotten, as verification rejects them anyway.
+func (s *spentTokens) use(token, key string, now time.Time) (settle func(status int), ok bool) {
+	exp, _, _ := strings.Cut(token, ".")
+	unix, _ := strconv.ParseInt(exp, 10, 64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = make(map[string]spentToken)
+	}
+	for t, st := range s.tokens {
+		if now.After(st.expires) {
+			delete(s.tokens, t)
+		}
+	}
+	if st, spent := s.tokens[token]; spent {
+		return func(int) {}, key != "" && st.key == key
+	}
+	s.tokens[token] = spentToken{expires: time.Unix(unix, 0), key: key}
+	return func(status int) {
+		if status >= 500 {
+			s.mu.Lock()
+			delete(s.tokens, token)
+			s.mu.Unlock()
+		}
+	}, true
+}
+
+// confirmationToken signs the request's method, URI, body and caller with
+// key. The token is "<expiry unix seconds>.<base64url HMAC-SHA256>".
+func confirmationToken(key []byte, r *http.Request, body []byte, caller string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + base64.RawURLEncoding.EncodeToString(confirmationMAC(key, r, body, caller, exp))
+}
+
+// verifyConfirmationToken reports whether token was issued by
+// confirmationToken for the same request and caller and has not expired.
+func verifyConfirmationToken(key []byte, token string, r *http.Request, body []byte, caller string, now time.Time) bool {
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || now.Unix() > unix {
+		return false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(got, confirmationMAC(key, r, body, caller, exp))
+}
+
+func confirmationMAC(key []byte, r *http.Request, body []byte, caller, exp string) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, key)
+	for _, part := range []string{r.Method, r.URL.RequestURI(), hex.EncodeToString(sum[:]), caller, exp} {
+		io.WriteString(mac, part)
+		mac.Write([]byte{0})
+	}
+	return mac.Sum(nil)
+}
@@ -0,0 +1,258 @@
+package hac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newConfirmTestHandler returns a handler for DELETE /users/{id}, which
+// requires confirmation. confirmed records IsConfirmed for each call that
+// reached the API handler.
+func newConfirmTestHandler(confirmed *[]bool) http.Handler {
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Description("A user account.").
+		Actions(Action{
+			Rel: "delete", Method: "DELETE", Href: "/users/{id}",
+			Description: "Permanently delete this user.",
+			Safety:      &Safety{Mutability: Irreversible, ConfirmationRecommended: true},
+		}).
+		MustRegister()
+	reg.Delete("/users/{id}").Description("Deleted user.").MustRegister()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		*confirmed = append(*confirmed, IsConfirmed(r))
+		w.Write([]byte(`{"deleted":true}`))
+	})
+	return Middleware(Options{
+		Registry:        reg,
+		PathResolver:    func(r *http.Request) string { return "/users/{id}" },
+		ConfirmationKey: []byte("test-key"),
+		Caller:          func(r *http.Request) string { return r.Header.Get("X-Caller") },
+	})(mux)
+}
+
+func confirmRequest(path, body, caller, token string) *http.Request {
+	req := httptest.NewRequest("DELETE", path, strings.NewReader(body))
+	req.Header.Set("Accept", MediaType)
+	req.Header.Set("X-Caller", caller)
+	if token != "" {
+		req.Header.Set(ConfirmationHeader, token)
+	}
+	return req
+}
+
+func TestConfirmationFlow(t *testing.T) {
+	var confirmed []bool
+	h := newConfirmTestHandler(&confirmed)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, confirmRequest("/users/1", `{"reason":"spam"}`, "alice", ""))
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("status = %d, want 428", rec.Code)
+	}
+	if len(confirmed) != 0 {
+		t.Fatal("handler ran without confirmation")
+	}
+
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if env.Error.Code != "confirmation_required" || env.Error.Recovery == nil || len(env.Error.Recovery.Actions) != 1 {
+		t.Fatalf("error = %+v", env.Error)
+	}
+	confirm := env.Error.Recovery.Actions[0]
+	if confirm.Method != "DELETE" || confirm.Href != "/users/1" {
+		t.Errorf("recovery action = %+v", confirm)
+	}
+	token := confirm.Headers[ConfirmationHeader]
+	if token == "" {
+		t.Fatal("recovery action carries no token")
+	}
+
+	// The token is bound to path, body and caller.
+	for name, req := range map[string]*http.Request{
+		"other path":   confirmRequest("/users/2", `{"reason":"spam"}`, "alice", token),
+		"other body":   confirmRequest("/users/1", `{"reason":"other"}`, "alice", token),
+		"other caller": confirmRequest("/users/1", `{"reason":"spam"}`, "mallory", token),
+		"garbage":      confirmRequest("/users/1", `{"reason":"spam"}`, "alice", "123.abc"),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPreconditionRequired {
+			t.Errorf("%s: status = %d, want 428", name, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "invalid or expired") {
+			t.Errorf("%s: body = %s", name, rec.Body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, confirmRequest("/users/1", `{"reason":"spam"}`, "alice", token))
+	if rec.Code != http.StatusOK || len(confirmed) != 1 || !confirmed[0] {
+		t.Fatalf("confirmed request: status = %d, confirmed = %v, body = %s", rec.Code, confirmed, rec.Body)
+	}
+
+	// A token confirms one request.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, confirmRequest("/users/1", `{"reason":"spam"}`, "alice", token))
+	if rec.Code != http.StatusPreconditionRequired || len(confirmed) != 1 {
+		t.Errorf("replayed token: status = %d, confirmed = %v, want 428", rec.Code, confirmed)
+	}
+}
+
+func TestConfirmationNonHACClient(t *testing.T) {
+	var confirmed []bool
+	h := newConfirmTestHandler(&confirmed)
+
+	req := httptest.NewRequest("DELETE", "/users/1", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var env ErrorEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if rec.Code != http.StatusPreconditionRequired || env.Error == nil || env.Error.Recovery == nil {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set(ConfirmationHeader, env.Error.Recovery.Actions[0].Headers[ConfirmationHeader])
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || len(confirmed) != 1 || !confirmed[0] {
+		t.Errorf("confirmed: status = %d, confirmed = %v, body = %s", rec.Code, confirmed, rec.Body)
+	}
+	if rec.Header().Get("Content-Type") == MediaType {
+		t.Error("non-HAC response was wrapped")
+	}
+}
+
+func TestConfirmationBodyLimit(t *testing.T) {
+	reg := NewRegistry()
+	reg.Delete("/users/{id}").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}", Safety: &Safety{ConfirmationRecommended: true}}).
+		MustRegister()
+	h := Middleware(Options{Registry: reg, ConfirmationKey: []byte("k"), ConfirmationMaxBody: 4})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { t.Error("handler called") }))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, confirmRequest("/users/1", `{"reason":"spam"}`, "", ""))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413", rec.Code)
+	}
+}
+
+func TestConfirmationNotEnforced(t *testing.T) {
+	var confirmed []bool
+	h := newConfirmTestHandler(&confirmed)
+
+	// Leaving out the HAC Accept header does not skip confirmation.
+	req := httptest.NewRequest("DELETE", "/users/1", nil)
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionRequired || len(confirmed) != 0 {
+		t.Errorf("non-HAC request: status = %d, confirmed = %v, want 428", rec.Code, confirmed)
+	}
+
+	// Without a key there is no enforcement.
+	reg := NewRegistry()
+	reg.Delete("/users/{id}").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}", Safety: &Safety{ConfirmationRecommended: true}}).
+		MustRegister()
+	reached := false
+	mw := Middleware(Options{Registry: reg, PathResolver: func(*http.Request) string { return "/users/{id}" }})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+	rec = httptest.NewRecorder()
+	mw.ServeHTTP(rec, confirmRequest("/users/1", "", "", ""))
+	if !reached || rec.Code != http.StatusOK {
+		t.Errorf("without key: reached = %v, status = %d", reached, rec.Code)
+	}
+}
+
+func TestConfirmationTokenExpiry(t *testing.T) {
+	key := []byte("k")
+	req := httptest.NewRequest("POST", "/orders?x=1", nil)
+	now := time.Unix(1_700_000_000, 0)
+	token := confirmationToken(key, req, []byte("{}"), "bob", now.Add(time.Minute))
+
+	if !verifyConfirmationToken(key, token, req, []byte("{}"), "bob", now) {
+		t.Error("fresh token rejected")
+	}
+	if verifyConfirmationToken(key, token, req, []byte("{}"), "bob", now.Add(2*time.Minute)) {
+		t.Error("expired token accepted")
+	}
+	if verifyConfirmationToken([]byte("other"), token, req, []byte("{}"), "bob", now) {
+		t.Error("token accepted under another key")
+	}
+	other := httptest.NewRequest("POST", "/orders?x=2", nil)
+	if verifyConfirmationToken(key, token, other, []byte("{}"), "bob", now) {
+		t.Error("token accepted for another query string")
+	}
+}
+
+func TestConfirmationIdempotentRetry(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/orders/{id}").Actions(Action{
+		Rel: "cancel", Method: "DELETE", Href: "/orders/{id}", Idempotent: true,
+		Safety: &Safety{Mutability: Irreversible, ConfirmationRecommended: true},
+	}).MustRegister()
+	reg.Delete("/orders/{id}").Description("Cancelled order.").MustRegister()
+
+	calls, fail := 0, true
+	h := Middleware(Options{
+		Registry:        reg,
+		PathResolver:    func(r *http.Request) string { return "/orders/{id}" },
+		ConfirmationKey: []byte("test-key"),
+	})(Idempotency(IdempotencyOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fail {
+			fail = false
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"cancelled":true}`))
+	})))
+	send := func(token, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/orders/1", nil)
+		req.Header.Set("Accept", MediaType)
+		if token != "" {
+			req.Header.Set(ConfirmationHeader, token)
+		}
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var env ErrorEnvelope
+	json.Unmarshal(send("", "").Body.Bytes(), &env)
+	token := env.Error.Recovery.Actions[0].Headers[ConfirmationHeader]
+
+	steps := []struct {
+		name, key  string
+		wantStatus int
+		wantCalls  int
+	}{
+		{"failed attempt", "k1", http.StatusServiceUnavailable, 1},
+		{"token kept after 5xx", "k1", http.StatusOK, 2},
+		{"idempotent retry replayed", "k1", http.StatusOK, 2},
+		{"different key", "k2", http.StatusPreconditionRequired, 2},
+		{"no key", "", http.StatusPreconditionRequired, 2},
+	}
+	for _, s := range steps {
+		rec := send(token, s.key)
+		if rec.Code != s.wantStatus || calls != s.wantCalls {
+			t.Errorf("%s: status = %d, calls = %d, want %d and %d", s.name, rec.Code, calls, s.wantStatus, s.wantCalls)
+		}
+		if s.name == "idempotent retry replayed" && rec.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("%s: not replayed", s.name)
+		}
+	}
+}
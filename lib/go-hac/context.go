@@ -19,3 +19,33 @@ func IsHACRequested(r *http.Request) bool {
 func withHACRequested(ctx context.Context) context.Context {
 	return context.WithValue(ctx, contextKey{}, true)
 }
+
+type confirmedKey struct{}
+
+// IsConfirmed reports whether the request carried a valid confirmation token
+// for an action that requires confirmation. Handlers can rely on it as proof
+// that the agent confirmed the action with the user.
+func IsConfirmed(r *http.Request) bool {
+	v, _ := r.Context().Value(confirmedKey{}).(bool)
+	return v
+}
+
+// withConfirmed returns a new context with the confirmed flag set.
+func withConfirmed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, confirmedKey{}, true)
+}
+
+type dryRunKey struct{}
+
+// IsDryRun reports whether the request asked for a dry run on a route that
+// supports it. Handlers should return a preview of the result without
+// changing any state.
+func IsDryRun(r *http.Request) bool {
+	v, _ := r.Context().Value(dryRunKey{}).(bool)
+	return v
+}
+
+// withDryRun returns a new context with the dry-run flag set.
+func withDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
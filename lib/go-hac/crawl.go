@@ -0,0 +1,438 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Crawl defaults applied when the corresponding Crawler field is zero.
+const (
+	DefaultCrawlDepth   = 3
+	DefaultCrawlBudget  = 100
+	DefaultCrawlMaxBody = 1 << 20
+)
+
+// errCrawlBudget is reported on resources skipped because the budget ran out.
+var errCrawlBudget = errors.New("request budget exhausted")
+
+// EdgeKind classifies how one resource in a CapabilityGraph links to another.
+type EdgeKind string
+
+const (
+	// EdgeResource links the discovery root to a top-level resource.
+	EdgeResource EdgeKind = "resource"
+	// EdgeRelated follows a related resource link.
+	EdgeRelated EdgeKind = "related"
+	// EdgeAction is an action an agent could invoke.
+	EdgeAction EdgeKind = "action"
+)
+
+// Crawler builds a CapabilityGraph of a HAC API by walking outward from its
+// discovery document. It follows discovery resources, related links and GET
+// actions whose safety metadata is read_only (or absent), and never sends a
+// request for any other action. Only hrefs on the same origin as BaseURL are
+// fetched, per spec §9.2, redirects off that origin are not followed, and URI
+// templates are recorded but not expanded.
+type Crawler struct {
+	// BaseURL is the API root that serves the discovery document.
+	BaseURL string
+
+	// Client sends requests. Defaults to http.DefaultClient. Crawl uses a
+	// copy whose CheckRedirect also refuses redirects to another origin.
+	Client *http.Client
+
+	// MaxDepth limits the number of link hops from the root.
+	// Defaults to DefaultCrawlDepth.
+	MaxDepth int
+
+	// MaxRequests caps the total number of requests, including the root.
+	// Defaults to DefaultCrawlBudget.
+	MaxRequests int
+
+	// MaxBodyBytes caps how much of each response is read. Larger responses
+	// are recorded as errors. Defaults to DefaultCrawlMaxBody.
+	MaxBodyBytes int64
+}
+
+// CapabilityGraph describes everything an agent could reach and invoke from
+// an API root. It marshals to JSON as-is and to Graphviz DOT via WriteDOT.
+type CapabilityGraph struct {
+	// Root is the href of the discovery document.
+	Root string `json:"root"`
+
+	// API is the discovery metadata served at Root, if any.
+	API *DiscoveryMeta `json:"api,omitempty"`
+
+	// Resources lists every href seen, in the order it was first reached.
+	Resources []*GraphResource `json:"resources"`
+
+	// Edges lists every link and action between resources.
+	Edges []GraphEdge `json:"edges"`
+
+	// Truncated is true if the request budget ran out before the crawl
+	// finished.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// GraphResource is a node in a CapabilityGraph.
+type GraphResource struct {
+	Href        string   `json:"href"`
+	Description string   `json:"description,omitempty"`
+	Depth       int      `json:"depth"`
+	Fetched     bool     `json:"fetched"`
+	Status      int      `json:"status,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Actions     []Action `json:"actions,omitempty"`
+}
+
+// GraphEdge is a directed link between two resources in a CapabilityGraph.
+// For action edges, Method and Safety describe the action.
+type GraphEdge struct {
+	From   string   `json:"from"`
+	To     string   `json:"to"`
+	Rel    string   `json:"rel"`
+	Kind   EdgeKind `json:"kind"`
+	Method string   `json:"method,omitempty"`
+	Safety *Safety  `json:"safety,omitempty"`
+}
+
+// Crawl fetches the discovery document at BaseURL and walks the API within
+// the configured depth and request budget. Failures fetching individual
+// resources are recorded on their GraphResource; Crawl only returns an error
+// if BaseURL is invalid or ctx is cancelled.
+func (c *Crawler) Crawl(ctx context.Context) (*CapabilityGraph, error) {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("hac: invalid crawl base URL %q", c.BaseURL)
+	}
+
+	cr := &crawl{
+		c:      c,
+		ctx:    ctx,
+		base:   base,
+		client: c.client(base),
+		nodes:  make(map[string]*GraphResource),
+		queued: make(map[string]bool),
+		graph:  &CapabilityGraph{Root: base.RequestURI()},
+	}
+	cr.visit(cr.graph.Root, 0)
+
+	for len(cr.queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		node := cr.queue[0]
+		cr.queue = cr.queue[1:]
+		if cr.requests >= c.maxRequests() {
+			node.Error = errCrawlBudget.Error()
+			cr.graph.Truncated = true
+			continue
+		}
+		cr.fetch(node)
+	}
+	return cr.graph, nil
+}
+
+// client returns a copy of the configured client that only follows
+// redirects within base's origin.
+func (c *Crawler) client(base *url.URL) *http.Client {
+	client := *http.DefaultClient
+	if c.Client != nil {
+		client = *c.Client
+	}
+	next := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != base.Scheme || req.URL.Host != base.Host {
+			return fmt.Errorf("redirect to another origin: %s", req.URL.Redacted())
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &client
+}
+
+func (c *Crawler) maxDepth() int {
+	if c.MaxDepth > 0 {
+		return c.MaxDepth
+	}
+	return DefaultCrawlDepth
+}
+
+func (c *Crawler) maxRequests() int {
+	if c.MaxRequests > 0 {
+		return c.MaxRequests
+	}
+	return DefaultCrawlBudget
+}
+
+func (c *Crawler) maxBody() int64 {
+	if c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return DefaultCrawlMaxBody
+}
+
+// crawl holds the state of a single Crawl call.
+type crawl struct {
+	c        *Crawler
+	ctx      context.Context
+	client   *http.Client
+	base     *url.URL
+	graph    *CapabilityGraph
+	nodes    map[string]*GraphResource
+	queued   map[string]bool
+	queue    []*GraphResource
+	requests int
+}
+
+// node returns the resource for href, creating it if needed.
+func (cr *crawl) node(href string, depth int) *GraphResource {
+	if n, ok := cr.nodes[href]; ok {
+		return n
+	}
+	n := &GraphResource{Href: href, Depth: depth}
+	cr.nodes[href] = n
+	cr.graph.Resources = append(cr.graph.Resources, n)
+	return n
+}
+
+// visit records href and queues it for fetching if it is a concrete,
+// same-origin URL within the depth limit that has not been queued before.
+func (cr *crawl) visit(href string, depth int) {
+	n := cr.node(href, depth)
+	if cr.queued[href] || depth > cr.c.maxDepth() || isURITemplate(href) || !cr.sameOrigin(href) {
+		return
+	}
+	cr.queued[href] = true
+	n.Depth = depth
+	cr.queue = append(cr.queue, n)
+}
+
+// link adds an edge from one resource to an href and returns the target's
+// normalized href.
+func (cr *crawl) link(from *GraphResource, href, rel string, kind EdgeKind, method string, safety *Safety) string {
+	to := cr.normalize(href)
+	cr.graph.Edges = append(cr.graph.Edges, GraphEdge{
+		From:   from.Href,
+		To:     to,
+		Rel:    rel,
+		Kind:   kind,
+		Method: method,
+		Safety: safety,
+	})
+	return to
+}
+
+// normalize resolves href against the base URL and returns it relative to the
+// origin when it is same-origin, or absolute otherwise.
+func (cr *crawl) normalize(href string) string {
+	if isURITemplate(href) {
+		return href
+	}
+	u, err := cr.base.Parse(href)
+	if err != nil {
+		return href
+	}
+	if u.Scheme == cr.base.Scheme && u.Host == cr.base.Host {
+		return u.RequestURI()
+	}
+	return u.String()
+}
+
+func (cr *crawl) sameOrigin(href string) bool {
+	u, err := cr.base.Parse(href)
+	return err == nil && u.Scheme == cr.base.Scheme && u.Host == cr.base.Host
+}
+
+// fetch requests a resource and expands its links.
+func (cr *crawl) fetch(n *GraphResource) {
+	cr.requests++
+	n.Fetched = true
+
+	u, _ := cr.base.Parse(n.Href)
+	req, err := http.NewRequestWithContext(cr.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		n.Error = err.Error()
+		return
+	}
+	req.Header.Set("Accept", MediaType)
+
+	resp, err := cr.client.Do(req)
+	if err != nil {
+		n.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	n.Status = resp.StatusCode
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cr.c.maxBody()+1))
+	if err != nil {
+		n.Error = err.Error()
+		return
+	}
+	if int64(len(body)) > cr.c.maxBody() {
+		n.Error = fmt.Sprintf("response body exceeds %d bytes", cr.c.maxBody())
+		return
+	}
+	if resp.StatusCode >= 400 {
+		n.Error = crawlErrorMessage(resp.StatusCode, body)
+		return
+	}
+
+	var doc struct {
+		Data json.RawMessage `json:"data"`
+		HAC  json.RawMessage `json:"_hac"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil || doc.HAC == nil {
+		n.Error = "response is not a HAC document"
+		return
+	}
+
+	if doc.Data == nil && n.Href == cr.graph.Root {
+		var meta DiscoveryMeta
+		if err := json.Unmarshal(doc.HAC, &meta); err != nil {
+			n.Error = err.Error()
+			return
+		}
+		cr.expandDiscovery(n, &meta)
+		return
+	}
+
+	var meta HACMeta
+	if err := json.Unmarshal(doc.HAC, &meta); err != nil {
+		n.Error = err.Error()
+		return
+	}
+	cr.expandMeta(n, &meta)
+}
+
+func (cr *crawl) expandDiscovery(n *GraphResource, meta *DiscoveryMeta) {
+	cr.graph.API = meta
+	n.Description = meta.Description
+	for _, res := range meta.Resources {
+		to := cr.link(n, res.Href, res.Rel, EdgeResource, "", nil)
+		cr.visit(to, n.Depth+1)
+		if target := cr.nodes[to]; target.Description == "" {
+			target.Description = res.Description
+		}
+	}
+}
+
+func (cr *crawl) expandMeta(n *GraphResource, meta *HACMeta) {
+	n.Description = meta.Description
+	n.Actions = meta.Actions
+	for _, rel := range meta.Related {
+		to := cr.link(n, rel.Href, rel.Rel, EdgeRelated, "", nil)
+		cr.visit(to, n.Depth+1)
+	}
+	for _, a := range meta.Actions {
+		to := cr.link(n, a.Href, a.Rel, EdgeAction, a.Method, a.Safety)
+		if isCrawlableAction(a) {
+			cr.visit(to, n.Depth+1)
+		} else {
+			cr.node(to, n.Depth+1)
+		}
+	}
+}
+
+// isCrawlableAction reports whether an action is safe for the crawler to
+// invoke: a GET that is not marked as mutating.
+func isCrawlableAction(a Action) bool {
+	if !strings.EqualFold(a.Method, http.MethodGet) {
+		return false
+	}
+	return a.Safety == nil || a.Safety.Mutability == "" || a.Safety.Mutability == ReadOnly
+}
+
+// isURITemplate reports whether href contains RFC 6570 template expressions.
+func isURITemplate(href string) bool {
+	return strings.ContainsAny(href, "{}")
+}
+
+// crawlErrorMessage extracts the HAC error message from body, falling back to
+// the status text.
+func crawlErrorMessage(status int, body []byte) string {
+	var env ErrorEnvelope
+	if err := json.Unmarshal(body, &env); err == nil && env.Error != nil && env.Error.Message != "" {
+		return env.Error.Message
+	}
+	return http.StatusText(status)
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Action edges are colored
+// by mutability: green for read_only, orange for reversible, red for
+// irreversible and gray when unspecified.
+func (g *CapabilityGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph hac {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	for _, n := range g.Resources {
+		style := ""
+		if !n.Fetched {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s%s];\n", dotQuote(n.Href), dotQuote(dotLabel(n)), style)
+	}
+	for _, e := range g.Edges {
+		label := e.Rel
+		attrs := ""
+		if e.Kind == EdgeAction {
+			label = e.Method + " " + e.Rel
+			attrs = fmt.Sprintf(", color=%s, fontcolor=%s", dotColor(e.Safety), dotColor(e.Safety))
+		} else if e.Kind == EdgeRelated {
+			attrs = ", style=dotted"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s%s];\n", dotQuote(e.From), dotQuote(e.To), dotQuote(label), attrs)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotLabel(n *GraphResource) string {
+	label := n.Href
+	if n.Description != "" {
+		desc := n.Description
+		if runes := []rune(desc); len(runes) > 60 {
+			desc = string(runes[:59]) + "…"
+		}
+		label += "\n" + desc
+	}
+	if n.Error != "" {
+		label += "\n(" + n.Error + ")"
+	}
+	return label
+}
+
+func dotColor(s *Safety) string {
+	if s == nil {
+		return "gray"
+	}
+	switch s.Mutability {
+	case ReadOnly:
+		return "darkgreen"
+	case Reversible:
+		return "orange"
+	case Irreversible:
+		return "red"
+	}
+	return "gray"
+}
+
+// dotQuote quotes s as a DOT string literal.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
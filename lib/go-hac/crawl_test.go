@@ -0,0 +1,236 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newCrawlTestServer serves a small HAC API and records every request made.
+func newCrawlTestServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	reg := NewRegistry()
+	reg.Get("/users").
+		Description("All users.").
+		Actions(
+			Action{Rel: "create", Method: "POST", Href: "/users", Safety: &Safety{Mutability: Reversible}},
+			Action{Rel: "search", Method: "GET", Href: "/users/search", Safety: &Safety{Mutability: ReadOnly}},
+		).
+		Related(RelatedResource{Rel: "item", Href: "/users/1"}).
+		MustRegister()
+	reg.Get("/users/search").Description("Search users.").MustRegister()
+	reg.Get("/users/1").
+		Description("A user.").
+		Actions(
+			Action{Rel: "delete", Method: "DELETE", Href: "/users/1", Safety: &Safety{Mutability: Irreversible}},
+			Action{Rel: "purge", Method: "GET", Href: "/users/1/purge", Safety: &Safety{Mutability: Irreversible}},
+		).
+		Related(
+			RelatedResource{Rel: "orders", Href: "/users/1/orders"},
+			RelatedResource{Rel: "external", Href: "https://other.example/users/1"},
+		).
+		MustRegister()
+	reg.Get("/users/1/orders").Description("Orders.").MustRegister()
+
+	disc := &Discovery{Meta: &DiscoveryMeta{
+		Name: "Test API",
+		Resources: []ResourceEntry{
+			{Rel: "users", Href: "/users", Description: "User accounts."},
+			{Rel: "user", Href: "/users/{id}"},
+		},
+	}}
+
+	var mu sync.Mutex
+	var requests []string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	})
+	handler := http.NewServeMux()
+	handler.Handle("/{$}", disc.Handler(nil))
+	handler.Handle("/", Middleware(Options{Registry: reg})(api))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestCrawlerBuildsGraph(t *testing.T) {
+	srv, requests := newCrawlTestServer(t)
+
+	c := &Crawler{BaseURL: srv.URL, Client: srv.Client()}
+	g, err := c.Crawl(context.Background())
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+
+	if g.API == nil || g.API.Name != "Test API" {
+		t.Errorf("api = %+v", g.API)
+	}
+
+	for _, req := range *requests {
+		if !strings.HasPrefix(req, "GET ") {
+			t.Errorf("crawler sent non-GET request %q", req)
+		}
+		if req == "GET /users/1/purge" {
+			t.Error("crawler invoked a GET action marked irreversible")
+		}
+	}
+
+	fetched := make(map[string]*GraphResource)
+	for _, n := range g.Resources {
+		fetched[n.Href] = n
+	}
+	for _, href := range []string{"/", "/users", "/users/search", "/users/1", "/users/1/orders"} {
+		if n, ok := fetched[href]; !ok || !n.Fetched {
+			t.Errorf("expected %s to be fetched", href)
+		}
+	}
+	for _, href := range []string{"/users/{id}", "/users/1/purge", "https://other.example/users/1"} {
+		if n, ok := fetched[href]; !ok || n.Fetched {
+			t.Errorf("expected %s to be recorded but not fetched", href)
+		}
+	}
+	if fetched["/users"].Description != "All users." {
+		t.Errorf("users description = %q", fetched["/users"].Description)
+	}
+
+	var deleteEdge *GraphEdge
+	for i, e := range g.Edges {
+		if e.Kind == EdgeAction && e.Rel == "delete" {
+			deleteEdge = &g.Edges[i]
+		}
+	}
+	if deleteEdge == nil || deleteEdge.Method != "DELETE" || deleteEdge.Safety.Mutability != Irreversible {
+		t.Errorf("delete edge = %+v", deleteEdge)
+	}
+}
+
+func TestCrawlerDepthAndBudget(t *testing.T) {
+	srv, _ := newCrawlTestServer(t)
+
+	c := &Crawler{BaseURL: srv.URL, Client: srv.Client(), MaxDepth: 1}
+	g, err := c.Crawl(context.Background())
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	for _, n := range g.Resources {
+		if n.Fetched && n.Depth > 1 {
+			t.Errorf("%s fetched at depth %d beyond MaxDepth", n.Href, n.Depth)
+		}
+	}
+
+	c = &Crawler{BaseURL: srv.URL, Client: srv.Client(), MaxRequests: 2}
+	g, err = c.Crawl(context.Background())
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if !g.Truncated {
+		t.Error("expected truncated graph")
+	}
+	count := 0
+	for _, n := range g.Resources {
+		if n.Fetched {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Errorf("fetched %d resources, want 2", count)
+	}
+}
+
+func TestCrawlerStaysOnOrigin(t *testing.T) {
+	var offOrigin int
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { offOrigin++ }))
+	defer other.Close()
+	disc := &Discovery{Meta: &DiscoveryMeta{
+		Name:      "Test API",
+		Resources: []ResourceEntry{{Rel: "users", Href: "/users"}},
+	}}
+	mux := http.NewServeMux()
+	mux.Handle("/{$}", disc.Handler(nil))
+	mux.Handle("/users", http.RedirectHandler(other.URL+"/users", http.StatusFound))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	g, err := (&Crawler{BaseURL: srv.URL, Client: srv.Client()}).Crawl(context.Background())
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if offOrigin != 0 {
+		t.Errorf("crawler followed a redirect to another origin %d times", offOrigin)
+	}
+	for _, n := range g.Resources {
+		if n.Href == "/users" && !strings.Contains(n.Error, "another origin") {
+			t.Errorf("redirected resource = %+v", n)
+		}
+	}
+}
+
+func TestCrawlerBodyLimit(t *testing.T) {
+	srv, _ := newCrawlTestServer(t)
+
+	g, err := (&Crawler{BaseURL: srv.URL, Client: srv.Client(), MaxBodyBytes: 16}).Crawl(context.Background())
+	if err != nil {
+		t.Fatalf("crawl: %v", err)
+	}
+	if len(g.Resources) != 1 || g.API != nil || !strings.Contains(g.Resources[0].Error, "exceeds 16 bytes") {
+		t.Errorf("resources = %+v", g.Resources)
+	}
+}
+
+func TestCrawlerInvalidBaseURL(t *testing.T) {
+	c := &Crawler{BaseURL: "/relative"}
+	if _, err := c.Crawl(context.Background()); err == nil {
+		t.Error("expected error for relative base URL")
+	}
+}
+
+func TestCapabilityGraphSerialization(t *testing.T) {
+	g := &CapabilityGraph{
+		Root: "/",
+		Resources: []*GraphResource{
+			{Href: "/", Fetched: true},
+			{Href: "/users/1", Description: `A "user".`},
+		},
+		Edges: []GraphEdge{
+			{From: "/", To: "/users/1", Rel: "delete", Kind: EdgeAction, Method: "DELETE", Safety: &Safety{Mutability: Irreversible}},
+		},
+	}
+
+	var dot strings.Builder
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatalf("WriteDOT: %v", err)
+	}
+	out := dot.String()
+	if !strings.HasPrefix(out, "digraph hac {") {
+		t.Errorf("unexpected DOT header: %q", out)
+	}
+	if !strings.Contains(out, `"/" -> "/users/1" [label="DELETE delete", color=red`) {
+		t.Errorf("missing colored action edge in:\n%s", out)
+	}
+	if !strings.Contains(out, `A \"user\".`) {
+		t.Errorf("description not escaped in:\n%s", out)
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var back CapabilityGraph
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(back.Edges) != 1 || back.Edges[0].Kind != EdgeAction {
+		t.Errorf("round-tripped edges = %+v", back.Edges)
+	}
+}
@@ -55,11 +55,7 @@ func AutoDiscovery(name, version, description string, reg *Registry) *Discovery
 	grouped := make(map[string]*entry)
 	for _, pair := range routes {
 		method, pattern := pair[0], pair[1]
-		// Strip method prefix from stdlib patterns like "GET /users/{id}"
-		cleanPattern := pattern
-		if idx := strings.Index(pattern, " /"); idx >= 0 {
-			cleanPattern = pattern[idx+1:]
-		}
+		cleanPattern := routePath(pattern)
 		e, ok := grouped[cleanPattern]
 		if !ok {
 			e = &entry{pattern: cleanPattern}
@@ -79,11 +75,7 @@ func AutoDiscovery(name, version, description string, reg *Registry) *Discovery
 		var desc string
 		for _, pair := range routes {
 			method, pat := pair[0], pair[1]
-			cleanPat := pat
-			if idx := strings.Index(pat, " /"); idx >= 0 {
-				cleanPat = pat[idx+1:]
-			}
-			if cleanPat == e.pattern {
+			if routePath(pat) == e.pattern {
 				if cfg := reg.Lookup(method, pat); cfg != nil && cfg.Description != "" {
 					desc = cfg.Description
 					break
@@ -113,6 +105,15 @@ func AutoDiscovery(name, version, description string, reg *Registry) *Discovery
 	}
 }
 
+// routePath strips the method prefix from stdlib patterns like
+// "GET /users/{id}", returning "/users/{id}".
+func routePath(pattern string) string {
+	if idx := strings.Index(pattern, " /"); idx >= 0 {
+		return pattern[idx+1:]
+	}
+	return pattern
+}
+
 // deriveRel extracts a relation name from a URL pattern.
 // "/users/{id}" -> "users", "/orders" -> "orders"
 func deriveRel(pattern string) string {
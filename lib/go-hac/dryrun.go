@@ -0,0 +1,47 @@
+package hac
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DryRunPreference is the Prefer header token (RFC 7240) that asks for a
+// preview of a mutation instead of performing it.
+const DryRunPreference = "dry-run"
+
+// DryRunQueryParam is the query parameter that requests a dry run for clients
+// that cannot set headers, as in "?dry_run=true".
+const DryRunQueryParam = "dry_run"
+
+// wantsDryRun reports whether r asks for a dry run through the Prefer header
+// or the dry_run query parameter.
+func wantsDryRun(r *http.Request) bool {
+	for _, v := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(v, ",") {
+			token, _, _ := strings.Cut(pref, ";")
+			token, _, _ = strings.Cut(token, "=")
+			if strings.EqualFold(strings.TrimSpace(token), DryRunPreference) {
+				return true
+			}
+		}
+	}
+	switch strings.ToLower(r.URL.Query().Get(DryRunQueryParam)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// dryRunUnsupported rejects a dry-run request for a route that has not opted
+// in, so the mutation is never performed by mistake.
+func dryRunUnsupported(w http.ResponseWriter, r *http.Request) {
+	writeHACError(w, r, http.StatusBadRequest, &HACError{
+		Code:    "dry_run_unsupported",
+		Message: r.Method + " " + r.URL.Path + " does not support dry runs; nothing was changed.",
+		Recovery: &Recovery{
+			Description: "Re-send the request without the Prefer: " + DryRunPreference +
+				" header or " + DryRunQueryParam + " parameter to perform it for real, " +
+				"after confirming the consequences with the user.",
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package hac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newDryRunTestHandler(mutations *int) http.Handler {
+	reg := NewRegistry()
+	reg.Post("POST /orders").Description("Place an order.").DryRun().MustRegister()
+	reg.Delete("DELETE /orders/{id}").Description("Cancel an order.").MustRegister()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /orders", func(w http.ResponseWriter, r *http.Request) {
+		if IsDryRun(r) {
+			w.Write([]byte(`{"total":42,"status":"preview"}`))
+			return
+		}
+		*mutations++
+		w.Write([]byte(`{"total":42,"status":"placed"}`))
+	})
+	mux.HandleFunc("DELETE /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		*mutations++
+	})
+	return Middleware(Options{Registry: reg, PathResolver: MuxPathResolver(mux)})(mux)
+}
+
+func TestDryRun(t *testing.T) {
+	for name, req := range map[string]*http.Request{
+		"prefer header": func() *http.Request {
+			req := httptest.NewRequest("POST", "/orders", nil)
+			req.Header.Set("Prefer", "return=minimal, dry-run")
+			return req
+		}(),
+		"query flag": httptest.NewRequest("POST", "/orders?dry_run=true", nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mutations int
+			h := newDryRunTestHandler(&mutations)
+			req.Header.Set("Accept", MediaType)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK || mutations != 0 {
+				t.Fatalf("status = %d, mutations = %d", rec.Code, mutations)
+			}
+			if got := rec.Header().Get("Preference-Applied"); got != "dry-run" {
+				t.Errorf("Preference-Applied = %q", got)
+			}
+			var env SuccessEnvelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if !env.HAC.Simulated || string(env.Data) != `{"total":42,"status":"preview"}` {
+				t.Errorf("envelope = %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestDryRunNotRequested(t *testing.T) {
+	var mutations int
+	h := newDryRunTestHandler(&mutations)
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if mutations != 1 || rec.Header().Get("Preference-Applied") != "" {
+		t.Errorf("mutations = %d, Preference-Applied = %q", mutations, rec.Header().Get("Preference-Applied"))
+	}
+	if vary := rec.Header().Values("Vary"); len(vary) != 2 || vary[1] != "Prefer" {
+		t.Errorf("Vary = %v, want Accept and Prefer", vary)
+	}
+	var env SuccessEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if env.HAC == nil || env.HAC.Simulated {
+		t.Errorf("envelope = %s", rec.Body)
+	}
+}
+
+func TestDryRunUnsupported(t *testing.T) {
+	var mutations int
+	h := newDryRunTestHandler(&mutations)
+
+	for _, path := range []string{"/orders/7", "/unregistered"} {
+		req := httptest.NewRequest("DELETE", path, nil)
+		req.Header.Set("Accept", MediaType+", application/json;q=0.5")
+		req.Header.Set("Prefer", "dry-run")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if mutations != 0 {
+			t.Fatalf("%s: mutation performed", path)
+		}
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, rec.Code)
+		}
+		var env ErrorEnvelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Error.Code != "dry_run_unsupported" || env.Error.Recovery == nil {
+			t.Errorf("%s: body = %s", path, rec.Body)
+		}
+	}
+}
+
+func TestWantsDryRun(t *testing.T) {
+	tests := map[string]bool{
+		"dry-run":                true,
+		"DRY-RUN":                true,
+		"respond-async, dry-run": true,
+		"dry-run; scope=full":    true,
+		"return=representation":  false,
+		"dry-running":            false,
+	}
+	for prefer, want := range tests {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Prefer", prefer)
+		if got := wantsDryRun(req); got != want {
+			t.Errorf("Prefer %q: wantsDryRun = %v, want %v", prefer, got, want)
+		}
+	}
+	if wantsDryRun(httptest.NewRequest("POST", "/?dry_run=false", nil)) {
+		t.Error("dry_run=false requested a dry run")
+	}
+}
+
+func TestDryRunNonHACClient(t *testing.T) {
+	var mutations int
+	h := newDryRunTestHandler(&mutations)
+
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Prefer", "dry-run")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || mutations != 0 || rec.Body.String() != `{"total":42,"status":"preview"}` {
+		t.Errorf("supported: status = %d, mutations = %d, body = %s", rec.Code, mutations, rec.Body)
+	}
+	if got := rec.Header().Get("Preference-Applied"); got != "dry-run" {
+		t.Errorf("Preference-Applied = %q", got)
+	}
+
+	req = httptest.NewRequest("DELETE", "/orders/7?dry_run=1", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || mutations != 0 {
+		t.Errorf("unsupported: status = %d, mutations = %d", rec.Code, mutations)
+	}
+
+	// Unregistered routes pass through untouched.
+	req = httptest.NewRequest("POST", "/unregistered?dry_run=1", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Preference-Applied") != "" {
+		t.Errorf("unregistered: status = %d, headers = %v", rec.Code, rec.Header())
+	}
+}
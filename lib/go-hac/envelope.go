@@ -64,6 +64,13 @@ func defaultErrorMapping(statusCode int, body []byte) *HACError {
 		return hacErr
 	}
 
+	// A body that is already a HAC error envelope, such as one written by
+	// Idempotency or another HAC-aware layer, is used as is.
+	var env ErrorEnvelope
+	if err := json.Unmarshal(body, &env); err == nil && env.Error != nil && env.Error.Code != "" {
+		return env.Error
+	}
+
 	// Try to extract code and message from JSON body
 	var parsed struct {
 		Code    string `json:"code"`
@@ -83,3 +90,46 @@ func defaultErrorMapping(statusCode int, body []byte) *HACError {
 
 	return hacErr
 }
+
+// completeError fills the fields hacErr leaves out from the registry's error
+// catalog entry for its code. A message that is only the status text counts
+// as missing. It returns hacErr itself if there is no entry, else a copy.
+func completeError(reg *Registry, statusCode int, hacErr *HACError) *HACError {
+	entry, ok := reg.lookupError(hacErr.Code)
+	if !ok {
+		return hacErr
+	}
+	out := *hacErr
+	if out.Message == "" || out.Message == http.StatusText(statusCode) {
+		out.Message = entry.Message
+	}
+	if entry.Retryable {
+		out.Retryable = true
+	}
+	if out.RetryAfter == 0 {
+		out.RetryAfter = entry.RetryAfter
+	}
+	if out.Recovery == nil {
+		out.Recovery = entry.Recovery
+	}
+	return &out
+}
+
+// writeHACError writes a HAC error envelope with the given status. When the
+// middleware exposes trace IDs, the error carries the trace ID of r.
+func writeHACError(w http.ResponseWriter, r *http.Request, statusCode int, hacErr *HACError) {
+	if id := exposedTraceID(r); id != "" && hacErr.TraceID == "" {
+		withID := *hacErr
+		withID.TraceID = id
+		hacErr = &withID
+	}
+	out, err := json.Marshal(&ErrorEnvelope{Error: hacErr})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(statusCode)
+	w.Write(out)
+}
@@ -117,6 +117,15 @@ func TestBuildErrorEnvelopeErrorField(t *testing.T) {
 	}
 }
 
+func TestBuildErrorEnvelopeHACErrorBody(t *testing.T) {
+	body := []byte(`{"error":{"code":"idempotency_key_mismatch","message":"Key reused.","recovery":{"description":"Use a new key."}}}`)
+	r := httptest.NewRequest("POST", "/", nil)
+	env, _ := buildErrorEnvelope(422, body, r, nil)
+	if env.Error.Code != "idempotency_key_mismatch" || env.Error.Recovery == nil {
+		t.Errorf("error = %+v, want the HAC error from the body", env.Error)
+	}
+}
+
 // http import needed for ErrorMapper type in test
 var _ ErrorMapper = func(int, []byte, *http.Request) *HACError { return nil }
 
@@ -132,3 +141,24 @@ func TestEnvelopeJSON(t *testing.T) {
 		t.Error("output is not valid JSON")
 	}
 }
+
+func TestCompleteError(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterError(HACError{
+		Code: "quota_exceeded", Message: "Monthly quota exceeded.", Retryable: true, RetryAfter: 60,
+		Recovery: &Recovery{Description: "Wait for the quota to reset."},
+	})
+
+	got := completeError(reg, 429, &HACError{Code: "quota_exceeded", Message: "Too Many Requests"})
+	if got.Message != "Monthly quota exceeded." || !got.Retryable || got.RetryAfter != 60 || got.Recovery == nil {
+		t.Errorf("completed = %+v", got)
+	}
+	got = completeError(reg, 429, &HACError{Code: "quota_exceeded", Message: "Quota of 100 exceeded.", RetryAfter: 5})
+	if got.Message != "Quota of 100 exceeded." || got.RetryAfter != 5 {
+		t.Errorf("handler fields overwritten: %+v", got)
+	}
+	orig := &HACError{Code: "other", Message: "Other."}
+	if completeError(reg, 400, orig) != orig {
+		t.Error("error without a catalog entry was copied")
+	}
+}
@@ -10,9 +10,11 @@ import (
 )
 
 func Example() {
-	// 1. Create a registry and register HAC metadata for routes
+	// 1. Create a registry and register HAC metadata for routes. Register
+	// returns an error if the metadata is invalid, for example an action
+	// without a rel or with an unknown method; MustRegister panics instead.
 	reg := hac.NewRegistry()
-	reg.Route("GET", "/users/1").
+	err := reg.Route("GET", "/users/1").
 		Description("A user account. Contains PII — do not log response bodies.").
 		Actions(
 			hac.Action{
@@ -28,6 +30,10 @@ func Example() {
 			},
 		).
 		Register()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	// 2. Create your normal HTTP handler
 	userHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
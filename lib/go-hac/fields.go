@@ -0,0 +1,306 @@
+package hac
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldsFrom derives action fields from the struct type T, usually the type
+// a handler decodes its JSON request body into, so the metadata cannot drift
+// from the code. T may also be a pointer to a struct.
+//
+// Each exported field becomes a Field named after its json tag, following
+// encoding/json: fields tagged json:"-" are skipped and the fields of
+// embedded structs are promoted. Go types map to JSON Schema types: bool is
+// boolean, integers are integer, floats are number, strings, []byte,
+// time.Time (format date-time) and encoding.TextMarshaler implementations
+// are string, slices and arrays are array with items, structs are object
+// with properties, and maps are object. Interfaces and json.Marshaler
+// implementations, such as json.RawMessage, may hold any JSON value and are
+// described as object without properties; declare the field by hand if a
+// narrower type is known. Pointers are followed, and a struct that contains
+// itself is described once.
+//
+// A hac struct tag adds the rest of the metadata:
+//
+//	Plan  string `json:"plan" hac:"desc=Target plan, billed monthly.,required,enum=pro|enterprise"`
+//	Seats int    `json:"seats" hac:"desc=Number of seats.,default=1,min=1,max=500"`
+//	Email string `json:"email" hac:"format=email,maxLength=254"`
+//
+// The options are desc, required, enum (values separated by |), default,
+// format, pattern, min, max, minLength and maxLength. Enum and default
+// values are parsed as the field's type. A description or pattern may
+// contain commas. hac:"-" skips the field.
+//
+// FieldsFrom panics if T is not a struct or a tag is malformed. Both are
+// programming errors, so call it where routes are registered at startup.
+func FieldsFrom[T any]() []Field {
+	t := reflect.TypeFor[T]()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("hac: FieldsFrom: %s is not a struct", t))
+	}
+	fields, err := structFields(t, make(map[reflect.Type]bool))
+	if err != nil {
+		panic("hac: FieldsFrom: " + err.Error())
+	}
+	return fields
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+// structFields returns the fields of the struct type t in declaration
+// order. Fields declared directly in t hide promoted fields of the same name.
+// seen holds the struct types being described, to stop at recursive types.
+func structFields(t reflect.Type, seen map[reflect.Type]bool) ([]Field, error) {
+	if seen[t] {
+		return nil, nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+
+	var (
+		fields   []Field
+		promoted = make(map[int]bool) // indexes into fields
+		direct   = make(map[string]bool)
+	)
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		jsonTag := sf.Tag.Get("json")
+		name, jsonOpts, _ := strings.Cut(jsonTag, ",")
+		if jsonTag == "-" || sf.Tag.Get("hac") == "-" {
+			continue
+		}
+
+		ft := indirectType(sf.Type)
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct && !isStringType(ft) {
+			inner, err := structFields(ft, seen)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range inner {
+				promoted[len(fields)] = true
+				fields = append(fields, f)
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		f, err := structField(name, sf.Type, jsonOpts, sf.Tag.Get("hac"), seen)
+		if err != nil {
+			return nil, fmt.Errorf("field %s.%s: %w", t.Name(), sf.Name, err)
+		}
+		fields = append(fields, f)
+		direct[name] = true
+	}
+	out := fields[:0]
+	for i, f := range fields {
+		if !promoted[i] || !direct[f.Name] {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// structField builds the field for one struct field from its type and tags.
+func structField(name string, t reflect.Type, jsonOpts, tag string, seen map[reflect.Type]bool) (Field, error) {
+	f, err := typeField(t, seen)
+	if err != nil {
+		return Field{}, err
+	}
+	if strings.Contains(","+jsonOpts+",", ",string,") && f.Type != "array" && f.Type != "object" {
+		f = Field{Type: "string"} // json:",string" quotes scalars
+	}
+	f.Name = name
+
+	for _, opt := range splitTag(tag) {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "desc":
+			f.Description = value
+		case "required":
+			f.Required = true
+		case "enum":
+			for _, s := range strings.Split(value, "|") {
+				v, err := parseTagValue(f.Type, s)
+				if err != nil {
+					return Field{}, fmt.Errorf("enum: %w", err)
+				}
+				f.Enum = append(f.Enum, v)
+			}
+		case "default":
+			v, err := parseTagValue(f.Type, value)
+			if err != nil {
+				return Field{}, fmt.Errorf("default: %w", err)
+			}
+			f.Default = v
+		case "format":
+			f.Format = value
+		case "pattern":
+			f.Pattern = value
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Field{}, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "min" {
+				f.Minimum = &n
+			} else {
+				f.Maximum = &n
+			}
+		case "minLength", "maxLength":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Field{}, fmt.Errorf("%s: %w", key, err)
+			}
+			if key == "minLength" {
+				f.MinLength = &n
+			} else {
+				f.MaxLength = &n
+			}
+		default:
+			return Field{}, fmt.Errorf("unknown hac tag option %q", key)
+		}
+	}
+	return f, nil
+}
+
+// splitTag splits a hac tag into options. A comma not followed by a known
+// option continues the previous option's value, so descriptions may contain
+// commas.
+func splitTag(tag string) []string {
+	if tag == "" {
+		return nil
+	}
+	var opts []string
+	for _, part := range strings.Split(tag, ",") {
+		key, _, _ := strings.Cut(part, "=")
+		if len(opts) == 0 || tagOptions[key] {
+			opts = append(opts, part)
+		} else {
+			opts[len(opts)-1] += "," + part
+		}
+	}
+	return opts
+}
+
+// tagOptions are the hac tag option names.
+var tagOptions = map[string]bool{
+	"desc": true, "required": true, "enum": true, "default": true, "format": true,
+	"pattern": true, "min": true, "max": true, "minLength": true, "maxLength": true,
+}
+
+// typeField returns an unnamed field describing values of type t, with the
+// items or properties of arrays and structs.
+func typeField(t reflect.Type, seen map[reflect.Type]bool) (Field, error) {
+	typ, err := goJSONType(t)
+	if err != nil {
+		return Field{}, err
+	}
+	f := Field{Type: typ}
+	t = indirectType(t)
+	switch {
+	case t == timeType:
+		f.Format = FormatDateTime
+	case typ == "array":
+		item, err := typeField(t.Elem(), seen)
+		if err != nil {
+			return Field{}, err
+		}
+		f.Items = &item
+	case typ == "object" && t.Kind() == reflect.Struct && !isOpaqueType(t):
+		if f.Properties, err = structFields(t, seen); err != nil {
+			return Field{}, err
+		}
+	}
+	return f, nil
+}
+
+// goJSONType returns the JSON Schema type encoding/json produces for t.
+func goJSONType(t reflect.Type) (string, error) {
+	t = indirectType(t)
+	if isStringType(t) {
+		return "string", nil
+	}
+	if isOpaqueType(t) {
+		return "object", nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer", nil
+	case reflect.Float32, reflect.Float64:
+		return "number", nil
+	case reflect.String:
+		return "string", nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string", nil // base64
+		}
+		return "array", nil
+	case reflect.Array:
+		return "array", nil
+	case reflect.Struct, reflect.Map:
+		return "object", nil
+	}
+	return "", fmt.Errorf("unsupported type %s", t)
+}
+
+// isStringType reports whether t is encoded as a JSON string: time.Time and
+// encoding.TextMarshaler implementations. As in encoding/json, a
+// json.Marshaler implementation is not, even if it is a TextMarshaler too.
+func isStringType(t reflect.Type) bool {
+	return t == timeType || implements(t, textMarshalerType) && !implements(t, jsonMarshalerType)
+}
+
+// isOpaqueType reports whether t may encode as any JSON value: interfaces
+// and json.Marshaler implementations other than time.Time.
+func isOpaqueType(t reflect.Type) bool {
+	return t != timeType && (t.Kind() == reflect.Interface || implements(t, jsonMarshalerType))
+}
+
+// implements reports whether t or *t implements the interface iface.
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// indirectType follows pointer types to their element type.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// parseTagValue parses an enum or default tag value as the JSON type typ.
+func parseTagValue(typ, s string) (any, error) {
+	switch typ {
+	case "string":
+		return s, nil
+	case "integer":
+		return strconv.ParseInt(s, 10, 64)
+	case "number":
+		return strconv.ParseFloat(s, 64)
+	case "boolean":
+		return strconv.ParseBool(s)
+	}
+	return nil, fmt.Errorf("not supported for %s fields", typ)
+}
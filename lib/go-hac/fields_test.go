@@ -0,0 +1,145 @@
+package hac
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testAudit struct {
+	CreatedBy string `json:"created_by" hac:"desc=Who placed the order."`
+	Note      string `json:"note"`
+}
+
+type testAddress struct {
+	City string `json:"city"`
+}
+
+type testOrder struct {
+	testAudit
+	Plan     string            `json:"plan" hac:"desc=Target plan, billed monthly.,required,enum=pro|enterprise"`
+	Seats    int               `json:"seats,omitempty" hac:"default=1,enum=1|5|10"`
+	Price    float64           `json:"price,string"`
+	Trial    *bool             `json:"trial" hac:"default=true"`
+	Start    time.Time         `json:"start" hac:"required"`
+	Addr     netip.Addr        `json:"client_ip"`
+	Ship     *testAddress      `json:"ship"`
+	Items    []testAddress     `json:"items"`
+	Labels   map[string]string `json:"labels"`
+	Blob     []byte            `json:"blob"`
+	Note     string            `json:"note" hac:"desc=Overrides the promoted note."`
+	NoTag    uint8
+	Skipped  string `json:"-"`
+	Hidden   string `hac:"-"`
+	internal string
+}
+
+func TestFieldsFrom(t *testing.T) {
+	want := []Field{
+		{Name: "created_by", Type: "string", Description: "Who placed the order."},
+		{Name: "plan", Type: "string", Description: "Target plan, billed monthly.", Required: true, Enum: []any{"pro", "enterprise"}},
+		{Name: "seats", Type: "integer", Default: int64(1), Enum: []any{int64(1), int64(5), int64(10)}},
+		{Name: "price", Type: "string"},
+		{Name: "trial", Type: "boolean", Default: true},
+		{Name: "start", Type: "string", Required: true, Format: "date-time"},
+		{Name: "client_ip", Type: "string"},
+		{Name: "ship", Type: "object", Properties: []Field{{Name: "city", Type: "string"}}},
+		{Name: "items", Type: "array", Items: &Field{Type: "object", Properties: []Field{{Name: "city", Type: "string"}}}},
+		{Name: "labels", Type: "object"},
+		{Name: "blob", Type: "string"},
+		{Name: "note", Type: "string", Description: "Overrides the promoted note."},
+		{Name: "NoTag", Type: "integer"},
+	}
+	got := FieldsFrom[*testOrder]()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+type testNode struct {
+	Name     string     `json:"name" hac:"pattern=^[a-z]{1,3}(,[a-z]+)*$,minLength=1,maxLength=64"`
+	Weight   float64    `json:"weight" hac:"min=0,max=1.5"`
+	Email    string     `json:"email" hac:"format=email"`
+	Children []testNode `json:"children"`
+}
+
+func TestFieldsFromNested(t *testing.T) {
+	one, max, zero, maxLen := 1, 1.5, 0.0, 64
+	got := FieldsFrom[testNode]()
+	want := []Field{
+		{Name: "name", Type: "string", Pattern: "^[a-z]{1,3}(,[a-z]+)*$", MinLength: &one, MaxLength: &maxLen},
+		{Name: "weight", Type: "number", Minimum: &zero, Maximum: &max},
+		{Name: "email", Type: "string", Format: FormatEmail},
+		// The recursive type is described once.
+		{Name: "children", Type: "array", Items: &Field{Type: "object"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// testBoth is a json.Marshaler and a TextMarshaler; encoding/json uses the
+// former.
+type testBoth struct{ V int }
+
+func (testBoth) MarshalJSON() ([]byte, error) { return []byte(`{}`), nil }
+func (testBoth) MarshalText() ([]byte, error) { return []byte(`v`), nil }
+
+func TestFieldsFromOpaque(t *testing.T) {
+	got := FieldsFrom[struct {
+		Any   any             `json:"any"`
+		Raw   json.RawMessage `json:"raw"`
+		Ptr   *json.RawMessage
+		Both  testBoth `json:"both"`
+		Anys  []any    `json:"anys"`
+		Start time.Time
+	}]()
+	want := []Field{
+		{Name: "any", Type: "object"},
+		{Name: "raw", Type: "object"},
+		{Name: "Ptr", Type: "object"},
+		{Name: "both", Type: "object"},
+		{Name: "anys", Type: "array", Items: &Field{Type: "object"}},
+		{Name: "Start", Type: "string", Format: FormatDateTime},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestFieldsFromPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func() []Field
+		want string
+	}{
+		{"not a struct", FieldsFrom[[]string], "is not a struct"},
+		{"bad default", FieldsFrom[struct {
+			N int `hac:"default=many"`
+		}], "field .N: default:"},
+		{"unknown option", FieldsFrom[struct {
+			S string `hac:"requird"`
+		}], `unknown hac tag option "requird"`},
+		{"enum on array", FieldsFrom[struct {
+			S []string `hac:"enum=a|b"`
+		}], "not supported for array fields"},
+		{"unsupported type", FieldsFrom[struct{ C chan int }], "unsupported type chan int"},
+		{"bad bound", FieldsFrom[struct {
+			N int `hac:"min=low"`
+		}], "min:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if msg, _ := r.(string); !strings.Contains(msg, tt.want) {
+					t.Errorf("panic = %v, want %q", r, tt.want)
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package hac
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RouteGroup registers routes under a shared path prefix with shared
+// defaults. Create one with Registry.Group; nested groups inherit and extend
+// their parent's prefix and defaults.
+type RouteGroup struct {
+	registry *Registry
+	parent   *RouteGroup
+
+	prefix        string
+	safety        *Safety
+	preconditions []string
+	related       []RelatedResource
+	tags          []string
+	fragment      string
+}
+
+// Group starts a route group whose routes are registered under prefix.
+func (reg *Registry) Group(prefix string) *RouteGroup {
+	return &RouteGroup{registry: reg, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// Group starts a nested group under g's prefix that inherits g's defaults.
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	return &RouteGroup{registry: g.registry, parent: g, prefix: strings.TrimSuffix(prefix, "/")}
+}
+
+// Safety sets the default safety metadata for state-changing actions
+// (methods other than GET, HEAD and OPTIONS) that declare none. An action's
+// own Safety replaces the default entirely.
+func (g *RouteGroup) Safety(s Safety) *RouteGroup {
+	g.safety = &s
+	return g
+}
+
+// Preconditions sets the default preconditions for actions that declare
+// none.
+func (g *RouteGroup) Preconditions(preconditions ...string) *RouteGroup {
+	g.preconditions = preconditions
+	return g
+}
+
+// Related adds related resources to every route in the group. A route's own
+// related resource with the same rel takes precedence.
+func (g *RouteGroup) Related(related ...RelatedResource) *RouteGroup {
+	g.related = related
+	return g
+}
+
+// Tags adds tags to every route in the group.
+func (g *RouteGroup) Tags(tags ...string) *RouteGroup {
+	g.tags = tags
+	return g
+}
+
+// Describe sets a description fragment, such as "Requires the admin role.",
+// appended to the description of every route in the group.
+func (g *RouteGroup) Describe(fragment string) *RouteGroup {
+	g.fragment = fragment
+	return g
+}
+
+// Get starts building a GET route in the group.
+func (g *RouteGroup) Get(pattern string) *RouteBuilder {
+	return g.Route("GET", pattern)
+}
+
+// Post starts building a POST route in the group.
+func (g *RouteGroup) Post(pattern string) *RouteBuilder {
+	return g.Route("POST", pattern)
+}
+
+// Put starts building a PUT route in the group.
+func (g *RouteGroup) Put(pattern string) *RouteBuilder {
+	return g.Route("PUT", pattern)
+}
+
+// Patch starts building a PATCH route in the group.
+func (g *RouteGroup) Patch(pattern string) *RouteBuilder {
+	return g.Route("PATCH", pattern)
+}
+
+// Delete starts building a DELETE route in the group.
+func (g *RouteGroup) Delete(pattern string) *RouteBuilder {
+	return g.Route("DELETE", pattern)
+}
+
+// Route starts building a route in the group for an arbitrary method. The
+// pattern is relative to the group's prefix, and may start with a method as
+// in "GET /users". Action and related hrefs without a leading slash, such as
+// "users/{id}", are resolved against the prefix too; hrefs starting with a
+// slash are used as written.
+func (g *RouteGroup) Route(method, pattern string) *RouteBuilder {
+	return &RouteBuilder{registry: g.registry, method: method, pattern: pattern, group: g}
+}
+
+// apply applies the group's defaults to cfg, outermost group first, and
+// returns the prefixed pattern.
+func (g *RouteGroup) apply(pattern string, cfg *RouteConfig) string {
+	var chain []*RouteGroup
+	for p := g; p != nil; p = p.parent {
+		chain = append(chain, p)
+	}
+
+	prefix := ""
+	var (
+		safety        *Safety
+		preconditions []string
+		related       []RelatedResource
+		tags          []string
+		fragments     []string
+	)
+	for i := len(chain) - 1; i >= 0; i-- {
+		p := chain[i]
+		prefix += p.prefix
+		if p.safety != nil {
+			safety = p.safety
+		}
+		if p.preconditions != nil {
+			preconditions = p.preconditions
+		}
+		for _, r := range p.related {
+			r.Href = resolveGroupHref(prefix, r.Href)
+			related = append(related, r)
+		}
+		tags = append(tags, p.tags...)
+		if p.fragment != "" {
+			fragments = append(fragments, p.fragment)
+		}
+	}
+
+	var actions []Action
+	for _, a := range cfg.Actions {
+		a.Href = resolveGroupHref(prefix, a.Href)
+		if a.Safety == nil && safety != nil && !isSafeMethod(a.Method) {
+			s := *safety
+			a.Safety = &s
+		}
+		if a.Preconditions == nil && preconditions != nil {
+			a.Preconditions = preconditions
+		}
+		actions = append(actions, a)
+	}
+	cfg.Actions = actions
+
+	own := make(map[string]bool, len(cfg.Related))
+	var merged []RelatedResource
+	for _, r := range cfg.Related {
+		own[r.Rel] = true
+	}
+	for _, r := range related {
+		if !own[r.Rel] {
+			merged = append(merged, r)
+		}
+	}
+	for _, r := range cfg.Related {
+		r.Href = resolveGroupHref(prefix, r.Href)
+		merged = append(merged, r)
+	}
+	cfg.Related = merged
+
+	for _, t := range cfg.Tags {
+		if !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	cfg.Tags = tags
+
+	if len(fragments) > 0 {
+		cfg.Description = strings.TrimSpace(cfg.Description + " " + strings.Join(fragments, " "))
+	}
+	return prefixPattern(prefix, pattern)
+}
+
+// resolveGroupHref resolves an href without a leading slash against prefix.
+func resolveGroupHref(prefix, href string) string {
+	if href == "" || strings.HasPrefix(href, "/") || strings.Contains(href, "://") {
+		return href
+	}
+	return prefix + "/" + href
+}
+
+// prefixPattern adds prefix to the path of a route pattern, keeping a
+// leading method.
+func prefixPattern(prefix, pattern string) string {
+	if prefix == "" {
+		return pattern
+	}
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || strings.HasPrefix(method, "/") {
+		return prefix + pattern
+	}
+	return method + " " + prefix + path
+}
+
+// Mount copies every route and error catalog entry of other into reg, with
+// prefix added to route patterns and to action and related hrefs that start
+// with a slash. It composes registries owned by different teams whose
+// handlers are mounted under prefix, for example with http.StripPrefix.
+// Nothing is copied if any route or error code is already registered in reg.
+func (reg *Registry) Mount(prefix string, other *Registry) error {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mountHref := func(href string) string {
+		if strings.HasPrefix(href, "/") {
+			return prefix + href
+		}
+		return href
+	}
+
+	routes := make(map[routeKey]*RouteConfig)
+	for _, pair := range other.Routes() {
+		src := other.Lookup(pair[0], pair[1])
+		if src == nil {
+			continue
+		}
+		cfg := *src
+		cfg.Actions = make([]Action, len(src.Actions))
+		for i, a := range src.Actions {
+			a.Href = mountHref(a.Href)
+			cfg.Actions[i] = a
+		}
+		cfg.Related = make([]RelatedResource, len(src.Related))
+		for i, r := range src.Related {
+			r.Href = mountHref(r.Href)
+			cfg.Related[i] = r
+		}
+		routes[routeKey{method: pair[0], pattern: prefixPattern(prefix, pair[1])}] = &cfg
+	}
+	errs := other.ErrorCatalog()
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.frozen.Load() {
+		return fmt.Errorf("hac: mount %s: %w", prefix, ErrRegistryFrozen)
+	}
+	for k := range routes {
+		if _, ok := reg.routes[k]; ok {
+			return fmt.Errorf("hac: mount %s: %s %s: %w", prefix, k.method, k.pattern, ErrDuplicateRoute)
+		}
+	}
+	for _, e := range errs {
+		if _, ok := reg.errors[e.Code]; ok {
+			return fmt.Errorf("hac: mount %s: error %q: %w", prefix, e.Code, ErrDuplicateError)
+		}
+	}
+	for k, cfg := range routes {
+		if reg.inferSafety {
+			cfg.Actions = inferActions(cfg.Actions)
+		}
+		reg.routes[k] = cfg
+	}
+	reg.actions.Store(nil)
+	for _, e := range errs {
+		reg.errors[e.Code] = e
+	}
+	return nil
+}
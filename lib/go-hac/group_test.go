@@ -0,0 +1,95 @@
+package hac
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegistryGroup(t *testing.T) {
+	reg := NewRegistry()
+	admin := reg.Group("/admin/").
+		Safety(Safety{Mutability: Irreversible, BlastRadius: Many, ConfirmationRecommended: true}).
+		Preconditions("Caller must have the admin role.").
+		Related(RelatedResource{Rel: "audit-log", Href: "audit"}).
+		Tags("admin").
+		Describe("Admin only.")
+
+	admin.Get("GET /users").
+		Description("All user accounts.").
+		Actions(
+			Action{Rel: "purge", Method: "DELETE", Href: "users"},
+			Action{Rel: "suspend", Method: "POST", Href: "users/suspend",
+				Safety: &Safety{Mutability: Reversible, BlastRadius: Many}, Preconditions: []string{}},
+			Action{Rel: "self", Method: "GET", Href: "/users"},
+		).
+		Related(RelatedResource{Rel: "audit-log", Href: "/admin/users/audit"}).
+		Tags("users", "admin").
+		MustRegister()
+
+	cfg := reg.Lookup("GET", "GET /admin/users")
+	if cfg == nil {
+		t.Fatalf("routes = %v", reg.Routes())
+	}
+	if cfg.Description != "All user accounts. Admin only." {
+		t.Errorf("description = %q", cfg.Description)
+	}
+	if !reflect.DeepEqual(cfg.Tags, []string{"admin", "users"}) {
+		t.Errorf("tags = %v", cfg.Tags)
+	}
+	if len(cfg.Related) != 1 || cfg.Related[0].Href != "/admin/users/audit" {
+		t.Errorf("related = %+v", cfg.Related)
+	}
+
+	purge, suspend, self := cfg.Actions[0], cfg.Actions[1], cfg.Actions[2]
+	if purge.Href != "/admin/users" || purge.Safety == nil || purge.Safety.Mutability != Irreversible ||
+		len(purge.Preconditions) != 1 {
+		t.Errorf("purge = %+v", purge)
+	}
+	if suspend.Href != "/admin/users/suspend" || suspend.Safety.Mutability != Reversible || len(suspend.Preconditions) != 0 {
+		t.Errorf("suspend overrides lost: %+v", suspend)
+	}
+	if self.Href != "/users" || self.Safety != nil {
+		t.Errorf("self = %+v", self)
+	}
+
+	// Nested groups extend the prefix and inherit defaults.
+	admin.Group("/billing").Describe("Billing team.").Get("/invoices").Description("Invoices.").MustRegister()
+	nested := reg.Lookup("GET", "/admin/billing/invoices")
+	if nested == nil || nested.Description != "Invoices. Admin only. Billing team." ||
+		len(nested.Related) != 1 || nested.Related[0].Href != "/admin/audit" {
+		t.Errorf("nested = %+v", nested)
+	}
+}
+
+func TestRegistryMount(t *testing.T) {
+	billing := NewRegistry()
+	billing.Get("/invoices/{id}").
+		Description("An invoice.").
+		Actions(Action{Rel: "pay", Method: "POST", Href: "/invoices/{id}/pay", Fields: []Field{{Name: "id", Type: "string"}}}).
+		Related(RelatedResource{Rel: "docs", Href: "https://example.com/docs"}).
+		MustRegister()
+	billing.RegisterError(HACError{Code: "card_declined", Message: "The card was declined."})
+
+	reg := NewRegistry()
+	if err := reg.Mount("/billing/", billing); err != nil {
+		t.Fatal(err)
+	}
+	cfg := reg.Lookup("GET", "/billing/invoices/{id}")
+	if cfg == nil || cfg.Actions[0].Href != "/billing/invoices/{id}/pay" || cfg.Related[0].Href != "https://example.com/docs" {
+		t.Fatalf("mounted = %+v", cfg)
+	}
+	if billing.Lookup("GET", "/invoices/{id}").Actions[0].Href != "/invoices/{id}/pay" {
+		t.Error("Mount modified the source registry")
+	}
+	if _, ok := reg.lookupError("card_declined"); !ok {
+		t.Error("error catalog not mounted")
+	}
+	if _, ok := reg.MatchAction("POST", "/billing/invoices/7/pay"); !ok {
+		t.Error("mounted action not matched")
+	}
+
+	if err := reg.Mount("/billing", billing); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("second mount: err = %v", err)
+	}
+}
@@ -12,8 +12,8 @@ const (
 type Mutability string
 
 const (
-	ReadOnly    Mutability = "read_only"
-	Reversible  Mutability = "reversible"
+	ReadOnly     Mutability = "read_only"
+	Reversible   Mutability = "reversible"
 	Irreversible Mutability = "irreversible"
 )
 
@@ -39,6 +39,14 @@ type HACMeta struct {
 	Description string            `json:"description,omitempty"`
 	Actions     []Action          `json:"actions,omitempty"`
 	Related     []RelatedResource `json:"related,omitempty"`
+
+	// Simulated marks a dry-run response: the data is a preview and no state
+	// was changed. It is a vendor extension (§8.2).
+	Simulated bool `json:"x-simulated,omitempty"`
+
+	// TraceID is the W3C trace ID of the request, so agents can report it
+	// back when correlating steps. It is a vendor extension (§8.2).
+	TraceID string `json:"x-trace-id,omitempty"`
 }
 
 // Action represents a hypermedia action an agent can invoke.
@@ -50,6 +58,20 @@ type Action struct {
 	Safety        *Safety  `json:"safety,omitempty"`
 	Fields        []Field  `json:"fields,omitempty"`
 	Preconditions []string `json:"preconditions,omitempty"`
+
+	// Idempotent advertises that the action accepts an Idempotency-Key
+	// header (see Idempotency), so agents should send one and reuse it when
+	// retrying. It is a vendor extension (§8.2).
+	Idempotent bool `json:"x-idempotent,omitempty"`
+
+	// Headers lists request headers the agent must send when invoking the
+	// action, such as a confirmation token. It is a vendor extension (§8.2).
+	Headers map[string]string `json:"x-headers,omitempty"`
+
+	// InferredSafety lists the safety fields, such as "mutability", that
+	// were guessed from the HTTP method rather than declared (see
+	// Registry.InferSafety). It is a vendor extension (§8.2).
+	InferredSafety []string `json:"x-inferred-safety,omitempty"`
 }
 
 // Safety contains risk-assessment metadata for an action.
@@ -68,16 +90,47 @@ type Cost struct {
 	Description string  `json:"description,omitempty"`
 }
 
-// Field represents an input field for an action.
+// Field represents an input field for an action. Beyond the flat name and
+// type it carries a JSON Schema subset, so agents can build valid structured
+// bodies.
 type Field struct {
-	Name        string `json:"name"`
+	Name        string `json:"name,omitempty"`
 	Type        string `json:"type"`
 	Description string `json:"description,omitempty"`
 	Required    bool   `json:"required,omitempty"`
 	Enum        []any  `json:"enum,omitempty"`
 	Default     any    `json:"default,omitempty"`
+
+	// Format refines a string type, for example FormatEmail.
+	Format string `json:"format,omitempty"`
+
+	// Pattern is a regular expression that string values must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Minimum and Maximum bound number and integer values, inclusive.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	// MinLength and MaxLength bound the length of string values in
+	// characters.
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+
+	// Items describes the elements of an array field. Its Name is unused.
+	Items *Field `json:"items,omitempty"`
+
+	// Properties describes the members of an object field.
+	Properties []Field `json:"properties,omitempty"`
 }
 
+// Common string formats for Field.Format.
+const (
+	FormatEmail    = "email"
+	FormatURI      = "uri"
+	FormatDateTime = "date-time"
+	FormatUUID     = "uuid"
+)
+
 // RelatedResource is a link to a related resource.
 type RelatedResource struct {
 	Rel         string `json:"rel"`
@@ -97,6 +150,14 @@ type HACError struct {
 	Retryable  bool      `json:"retryable,omitempty"`
 	RetryAfter int       `json:"retry_after,omitempty"`
 	Recovery   *Recovery `json:"recovery,omitempty"`
+
+	// TraceID is the W3C trace ID of the failed request. It is a vendor
+	// extension (§8.2).
+	TraceID string `json:"x-trace-id,omitempty"`
+
+	// Violations lists the request fields that failed validation (see
+	// ValidateRequests). It is a vendor extension (§8.2).
+	Violations []Violation `json:"x-violations,omitempty"`
 }
 
 // Recovery provides guidance on how to resolve an error.
@@ -0,0 +1,206 @@
+package hac
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// HandlerMeta is the HAC metadata Handle registers alongside a typed
+// handler.
+type HandlerMeta struct {
+	// Registry receives the route. Required.
+	Registry *Registry
+
+	// Description describes the response data, as RouteBuilder.Description
+	// does.
+	Description string
+
+	// Action describes how to invoke the route, and is advertised first
+	// among the route's actions. Handle fills in Method and Href from the
+	// pattern, and Fields from the request type unless they are set. Rel
+	// defaults to "self" for GET and to the lowercased method otherwise.
+	Action Action
+
+	// Actions lists further actions advertised in the response.
+	Actions []Action
+
+	Related []RelatedResource
+	Tags    []string
+
+	// DryRun marks the route as able to preview its effect; see
+	// RouteBuilder.DryRun.
+	DryRun bool
+
+	// Status is the status of successful responses, such as
+	// http.StatusCreated. Defaults to 200. With 204 No Content the returned
+	// Resp is not written.
+	Status int
+}
+
+// HandlerError is an error a Handle function returns to answer with a
+// specific status and HAC error. Fields the error leaves out are filled from
+// the registry's error catalog, as the middleware does; a Status outside
+// 400-599 is answered as 500. Any other error is answered with a 500
+// "internal_error".
+type HandlerError struct {
+	Status int
+	Err    HACError
+}
+
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("hac: %d %s: %s", e.Status, e.Err.Code, e.Err.Message)
+}
+
+// Handle registers fn on mux under pattern and its HAC metadata in
+// meta.Registry under the same pattern, so the two cannot drift apart. The
+// action's fields are derived from Req with FieldsFrom.
+//
+// pattern must name a method, as in "POST /orders". The handler decodes the
+// JSON body into Req, then sets Req fields named by query parameters and
+// path wildcards, following where ValidateRequests looks for each field.
+// It calls fn and encodes the returned Resp as JSON with meta.Status. A body
+// or parameter that cannot be decoded is answered with a 400 HAC error, code
+// "invalid_request".
+//
+// The action href is the pattern's path written as a URI template: a
+// trailing wildcard such as {path...} becomes {+path}, which keeps its
+// slashes, and {$} is dropped.
+//
+// Req must be a struct type; use struct{} for routes without input. Like
+// ServeMux.Handle with a conflicting pattern, Handle panics if meta.Registry
+// is nil, the pattern has no method, meta.Status is not a 2xx status, Req is
+// not a struct, or the route cannot be registered. Wrap mux in Middleware,
+// with MuxPathResolver, to serve envelopes:
+//
+//	hac.Handle(mux, "POST /orders", hac.HandlerMeta{Registry: reg, Description: "The placed order."},
+//		func(ctx context.Context, req PlaceOrder) (Order, error) { ... })
+func Handle[Req, Resp any](mux *http.ServeMux, pattern string, meta HandlerMeta, fn func(context.Context, Req) (Resp, error)) {
+	if meta.Registry == nil {
+		panic(fmt.Sprintf("hac: Handle %q: HandlerMeta.Registry is nil", pattern))
+	}
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || strings.HasPrefix(method, "/") {
+		panic(fmt.Sprintf("hac: Handle %q: pattern must start with a method", pattern))
+	}
+	path = strings.TrimSpace(path)
+	if i := strings.IndexByte(path, '/'); i > 0 {
+		path = path[i:] // drop the host
+	}
+	status := cmp.Or(meta.Status, http.StatusOK)
+	if status < 200 || status > 299 {
+		panic(fmt.Sprintf("hac: Handle %q: HandlerMeta.Status %d is not a success status", pattern, status))
+	}
+
+	a := meta.Action
+	a.Method = method
+	if a.Href == "" {
+		a.Href = patternHref(path)
+	}
+	if a.Fields == nil {
+		a.Fields = FieldsFrom[Req]()
+	}
+	if a.Rel == "" {
+		a.Rel = strings.ToLower(method)
+		if method == http.MethodGet {
+			a.Rel = "self"
+		}
+	}
+
+	b := meta.Registry.Route(method, pattern).
+		Description(meta.Description).
+		Actions(append([]Action{a}, meta.Actions...)...).
+		Related(meta.Related...).
+		Tags(meta.Tags...)
+	if meta.DryRun {
+		b.DryRun()
+	}
+	b.MustRegister()
+
+	queryFields, bodyFields := splitFields(a)
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if len(bodyFields) > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				writeInvalidRequest(w, r, http.StatusBadRequest, a, []Violation{{Message: "body is not valid JSON: " + err.Error()}})
+				return
+			}
+		}
+		params := queryInstance(queryFields, r.URL.Query())
+		for _, v := range templateVars(a.Href) {
+			if s := r.PathValue(v.name); s != "" && !v.inQuery() {
+				params[v.name] = queryValue(fieldNamed(a.Fields, v.name), []string{s})
+			}
+		}
+		if len(params) > 0 {
+			raw, err := json.Marshal(params)
+			if err == nil {
+				err = json.Unmarshal(raw, &req)
+			}
+			if err != nil {
+				writeInvalidRequest(w, r, http.StatusBadRequest, a, []Violation{{Message: "invalid parameter: " + err.Error()}})
+				return
+			}
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			var he *HandlerError
+			if errors.As(err, &he) {
+				hacErr := he.Err
+				code := he.Status
+				if code < 400 || code > 599 {
+					code = http.StatusInternalServerError
+				}
+				writeHACError(w, r, code, completeError(meta.Registry, code, &hacErr))
+				return
+			}
+			writeHACError(w, r, http.StatusInternalServerError, &HACError{
+				Code:      "internal_error",
+				Message:   "The server could not complete the request.",
+				Retryable: true,
+			})
+			return
+		}
+
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		out, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(out)
+	})
+}
+
+// patternHref converts the path of a ServeMux pattern to a URI template:
+// "/files/{path...}" becomes "/files/{+path}" and "/{$}" becomes "/".
+func patternHref(path string) string {
+	path = strings.TrimSuffix(path, "{$}")
+	if strings.HasSuffix(path, "...}") {
+		i := strings.LastIndexByte(path, '{')
+		path = path[:i] + "{+" + path[i+1:len(path)-len("...}")] + "}"
+	}
+	return path
+}
+
+// fieldNamed returns the field called name, or a string field if there is
+// none.
+func fieldNamed(fields []Field, name string) Field {
+	for _, f := range fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return Field{Name: name, Type: "string"}
+}
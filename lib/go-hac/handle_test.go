@@ -0,0 +1,175 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testPlaceOrder struct {
+	UserID int    `json:"user_id"`
+	Plan   string `json:"plan" hac:"desc=Target plan.,required,enum=pro|enterprise"`
+	Seats  int    `json:"seats" hac:"default=1"`
+}
+
+type testOrderPage struct {
+	UserID int      `json:"user_id"`
+	Limit  int      `json:"limit"`
+	Status []string `json:"status"`
+}
+
+func TestHandle(t *testing.T) {
+	reg := NewRegistry()
+	reg.RegisterError(HACError{Code: "plan_unavailable", Message: "The plan is not available in this region."})
+	mux := http.NewServeMux()
+
+	Handle(mux, "POST /users/{user_id}/orders", HandlerMeta{
+		Registry:    reg,
+		Description: "The placed order.",
+		Action:      Action{Rel: "order", Safety: &Safety{Mutability: Reversible, BlastRadius: Self}},
+		Tags:        []string{"orders"},
+	}, func(ctx context.Context, req testPlaceOrder) (map[string]any, error) {
+		switch req.Plan {
+		case "enterprise":
+			return nil, &HandlerError{Status: http.StatusConflict, Err: HACError{Code: "plan_unavailable"}}
+		case "broken":
+			return nil, errors.New("database is down")
+		case "legacy":
+			return nil, &HandlerError{Err: HACError{Code: "plan_unavailable"}}
+		}
+		return map[string]any{"user_id": req.UserID, "plan": req.Plan, "seats": req.Seats}, nil
+	})
+	Handle(mux, "GET /users/{user_id}/orders", HandlerMeta{Registry: reg, Description: "A page of orders."},
+		func(ctx context.Context, req testOrderPage) (testOrderPage, error) {
+			return req, nil
+		})
+
+	cfg := reg.Lookup("POST", "POST /users/{user_id}/orders")
+	if cfg == nil || cfg.Description != "The placed order." || len(cfg.Tags) != 1 {
+		t.Fatalf("registered route = %+v", cfg)
+	}
+	a := cfg.Actions[0]
+	if a.Rel != "order" || a.Method != "POST" || a.Href != "/users/{user_id}/orders" ||
+		len(a.Fields) != 3 || !a.Fields[1].Required || a.Safety == nil {
+		t.Errorf("action = %+v", a)
+	}
+	if got := reg.Lookup("GET", "GET /users/{user_id}/orders").Actions[0].Rel; got != "self" {
+		t.Errorf("GET rel = %q", got)
+	}
+
+	h := Middleware(Options{Registry: reg, PathResolver: MuxPathResolver(mux)})(mux)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Accept", MediaType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("POST", "/users/7/orders", `{"plan":"pro","seats":3}`)
+	var env SuccessEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if string(env.Data) != `{"plan":"pro","seats":3,"user_id":7}` || env.HAC.Description != "The placed order." {
+		t.Errorf("POST: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = do("GET", "/users/7/orders?limit=5&status=open&status=paid", "")
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if string(env.Data) != `{"user_id":7,"limit":5,"status":["open","paid"]}` {
+		t.Errorf("GET: %d %s", rec.Code, rec.Body)
+	}
+
+	errorTests := []struct {
+		name, method, target, body string
+		status                     int
+		code, message              string
+	}{
+		{"handler error", "POST", "/users/7/orders", `{"plan":"enterprise"}`,
+			http.StatusConflict, "plan_unavailable", "The plan is not available in this region."},
+		{"handler error without status", "POST", "/users/7/orders", `{"plan":"legacy"}`,
+			http.StatusInternalServerError, "plan_unavailable", "The plan is not available in this region."},
+		{"internal error", "POST", "/users/7/orders", `{"plan":"broken"}`,
+			http.StatusInternalServerError, "internal_error", "The server could not complete the request."},
+		{"malformed body", "POST", "/users/7/orders", `{"plan":`, http.StatusBadRequest, "invalid_request", ""},
+		{"bad path value", "POST", "/users/seven/orders", `{"plan":"pro"}`, http.StatusBadRequest, "invalid_request", ""},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.target, tt.body)
+			var env ErrorEnvelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.status || env.Error.Code != tt.code ||
+				(tt.message != "" && env.Error.Message != tt.message) {
+				t.Errorf("response = %d %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandlePanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "must start with a method") {
+			t.Errorf("panic = %v", r)
+		}
+	}()
+	Handle(http.NewServeMux(), "/orders", HandlerMeta{Registry: NewRegistry()},
+		func(context.Context, struct{}) (struct{}, error) { return struct{}{}, nil })
+}
+
+type testFile struct {
+	Path string `json:"path"`
+	Body string `json:"body"`
+}
+
+func TestHandleStatusAndWildcards(t *testing.T) {
+	reg := NewRegistry()
+	mux := http.NewServeMux()
+	Handle(mux, "PUT /files/{path...}", HandlerMeta{Registry: reg, Description: "The stored file.", Status: http.StatusCreated},
+		func(ctx context.Context, req testFile) (testFile, error) { return req, nil })
+	Handle(mux, "DELETE /files/{path...}", HandlerMeta{Registry: reg, Description: "Nothing.", Status: http.StatusNoContent},
+		func(ctx context.Context, req testFile) (testFile, error) { return req, nil })
+	Handle(mux, "GET /{$}", HandlerMeta{Registry: reg, Description: "The index."},
+		func(ctx context.Context, req struct{}) (struct{}, error) { return req, nil })
+
+	if a := reg.Lookup("PUT", "PUT /files/{path...}").Actions[0]; a.Href != "/files/{+path}" {
+		t.Errorf("wildcard href = %q", a.Href)
+	}
+	if a := reg.Lookup("GET", "GET /{$}").Actions[0]; a.Href != "/" {
+		t.Errorf("exact match href = %q", a.Href)
+	}
+
+	h := Middleware(Options{Registry: reg, PathResolver: MuxPathResolver(mux)})(mux)
+	for _, accept := range []string{MediaType, "application/json"} {
+		req := httptest.NewRequest("PUT", "/files/a/b.txt", strings.NewReader(`{"body":"hi"}`))
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `{"path":"a/b.txt","body":"hi"}`) {
+			t.Errorf("PUT, Accept %s: %d %s", accept, rec.Code, rec.Body)
+		}
+
+		req = httptest.NewRequest("DELETE", "/files/a/b.txt", nil)
+		req.Header.Set("Accept", accept)
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+			t.Errorf("DELETE, Accept %s: %d %s", accept, rec.Code, rec.Body)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "not a success status") {
+			t.Errorf("panic = %v", r)
+		}
+	}()
+	Handle(mux, "POST /files", HandlerMeta{Registry: reg, Status: http.StatusFound},
+		func(context.Context, struct{}) (struct{}, error) { return struct{}{}, nil })
+}
@@ -0,0 +1,308 @@
+package hac
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header carrying the client-chosen
+// idempotency key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL is how long responses are kept for replay when
+// IdempotencyOptions.TTL is zero.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultMaxIdempotentBody is the largest request body the Idempotency
+// middleware reads to fingerprint a request when IdempotencyOptions.MaxBody
+// is zero.
+const DefaultMaxIdempotentBody = 1 << 20
+
+// IdempotencyRecord is the stored state of a request made with an
+// idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the original request (method, URI and body).
+	Fingerprint string
+
+	// Done is false while the original request is still being handled.
+	Done bool
+
+	// StatusCode, Header and Body are the stored response once Done.
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyStore persists idempotency records. Implementations must be safe
+// for concurrent use; Begin must be atomic so that two concurrent requests
+// with the same key cannot both proceed.
+type IdempotencyStore interface {
+	// Begin reserves key for a request with the given fingerprint. If key is
+	// already reserved or completed, it returns the existing record and
+	// false; otherwise it returns nil and true.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error)
+
+	// Complete stores the response for a key reserved by Begin.
+	Complete(ctx context.Context, key string, rec *IdempotencyRecord) error
+
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configures the Idempotency middleware.
+type IdempotencyOptions struct {
+	// Store holds idempotency records. Defaults to a new
+	// MemoryIdempotencyStore, which is only suitable for a single instance.
+	Store IdempotencyStore
+
+	// TTL is how long a key and its response are remembered.
+	// Defaults to DefaultIdempotencyTTL.
+	TTL time.Duration
+
+	// Caller scopes keys per caller so that one caller cannot replay
+	// another's response. Defaults to a single shared scope.
+	Caller CallerFunc
+
+	// Required rejects mutating requests that carry no Idempotency-Key.
+	Required bool
+
+	// MaxBody caps the request body read to fingerprint a request with a
+	// key. Larger bodies are rejected with 413. Defaults to
+	// DefaultMaxIdempotentBody.
+	MaxBody int64
+}
+
+// Idempotency returns a middleware that makes POST, PUT, PATCH and DELETE
+// requests carrying an Idempotency-Key header safe to retry. The first
+// request with a key runs normally and its response is stored; retries with
+// the same key and the same method, URI and body get the stored response
+// replayed with an Idempotent-Replayed header instead of running the handler
+// again. Reusing a key for a different request is rejected with a 422 HAC
+// error, and a retry that arrives while the original is still running gets a
+// retryable 409. Responses with a 5xx status are not stored, so the request
+// may be retried. Dry runs are passed through without using the key.
+//
+// Place it inside Middleware so replayed responses are enveloped like fresh
+// ones:
+//
+//	hac.Middleware(opts)(hac.Idempotency(hac.IdempotencyOptions{})(mux))
+//
+// Mark the corresponding actions Idempotent so agents know to send a key.
+func Idempotency(opts IdempotencyOptions) func(http.Handler) http.Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultIdempotencyTTL
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = DefaultMaxIdempotentBody
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Dry runs change nothing, and storing a preview under the key
+			// would replay it in place of the real request.
+			if isSafeMethod(r.Method) || wantsDryRun(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				if opts.Required {
+					writeHACError(w, r, http.StatusBadRequest, &HACError{
+						Code:    "idempotency_key_required",
+						Message: "This request must carry an " + IdempotencyKeyHeader + " header.",
+						Recovery: &Recovery{
+							Description: "Generate a unique key (for example a UUID), send it in the " +
+								IdempotencyKeyHeader + " header, and reuse the same key when retrying this request.",
+						},
+					})
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBody+1))
+			r.Body.Close()
+			if err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > opts.MaxBody {
+				writeHACError(w, r, http.StatusRequestEntityTooLarge, &HACError{
+					Code:    "request_too_large",
+					Message: fmt.Sprintf("The request body exceeds %d bytes.", opts.MaxBody),
+				})
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if opts.Caller != nil {
+				key = opts.Caller(r) + "\x00" + key
+			}
+			fp := requestFingerprint(r, body)
+			ctx := r.Context()
+
+			existing, ok, err := opts.Store.Begin(ctx, key, fp, opts.TTL)
+			if err != nil {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				replayIdempotent(w, r, existing, fp)
+				return
+			}
+
+			rec := &responseRecorder{
+				header: make(http.Header),
+				body:   &bytes.Buffer{},
+				code:   http.StatusOK,
+			}
+			completed := false
+			defer func() {
+				if !completed {
+					opts.Store.Release(context.WithoutCancel(ctx), key)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+
+			if rec.code < 500 {
+				err := opts.Store.Complete(context.WithoutCancel(ctx), key, &IdempotencyRecord{
+					Fingerprint: fp,
+					Done:        true,
+					StatusCode:  rec.code,
+					Header:      rec.header.Clone(),
+					Body:        bytes.Clone(rec.body.Bytes()),
+				})
+				completed = err == nil
+			}
+			writeRecorded(w, rec.header, rec.code, rec.body.Bytes())
+		})
+	}
+}
+
+// replayIdempotent answers a request whose key is already in use.
+func replayIdempotent(w http.ResponseWriter, r *http.Request, existing *IdempotencyRecord, fp string) {
+	switch {
+	case existing.Fingerprint != fp:
+		writeHACError(w, r, http.StatusUnprocessableEntity, &HACError{
+			Code:    "idempotency_key_mismatch",
+			Message: "This " + IdempotencyKeyHeader + " was already used for a different request.",
+			Recovery: &Recovery{
+				Description: "Use a new idempotency key for a new request, or resend the original request unchanged to get its result.",
+			},
+		})
+	case !existing.Done:
+		writeHACError(w, r, http.StatusConflict, &HACError{
+			Code:       "idempotency_request_in_progress",
+			Message:    "A request with this " + IdempotencyKeyHeader + " is still being processed.",
+			Retryable:  true,
+			RetryAfter: 1,
+		})
+	default:
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeRecorded(w, existing.Header, existing.StatusCode, existing.Body)
+	}
+}
+
+// writeRecorded writes a captured response to w.
+func writeRecorded(w http.ResponseWriter, header http.Header, code int, body []byte) {
+	for k, vs := range header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// requestFingerprint hashes the parts of a request that must match for a
+// retry to be replayed.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.RequestURI())
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore. Expired records
+// are dropped lazily.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*memoryIdempotencyEntry
+	swept   time.Time
+	now     func() time.Time
+}
+
+type memoryIdempotencyEntry struct {
+	rec     IdempotencyRecord
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]*memoryIdempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// Begin implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.sweep(now)
+	if e, ok := s.records[key]; ok && !now.After(e.expires) {
+		rec := e.rec
+		return &rec, false, nil
+	}
+	s.records[key] = &memoryIdempotencyEntry{
+		rec:     IdempotencyRecord{Fingerprint: fingerprint},
+		expires: now.Add(ttl),
+	}
+	return nil, true, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, rec *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.records[key]; ok {
+		e.rec = *rec
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// sweep drops expired records, at most once a minute.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+	for k, e := range s.records {
+		if now.After(e.expires) {
+			delete(s.records, k)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func idempotentRequest(method, path, key, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	return req
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var calls int
+	h := Idempotency(IdempotencyOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/orders/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	first := httptest.NewRecorder()
+	h.ServeHTTP(first, idempotentRequest("POST", "/orders", "k1", `{"qty":1}`))
+	second := httptest.NewRecorder()
+	h.ServeHTTP(second, idempotentRequest("POST", "/orders", "k1", `{"qty":1}`))
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != `{"id":1}` || second.Header().Get("Location") != "/orders/1" {
+		t.Errorf("replay = %d %v %s", second.Code, second.Header(), second.Body)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("Idempotent-Replayed header not set on the replay only")
+	}
+
+	// Requests without a key, and safe methods, are not deduplicated.
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "", `{"qty":1}`))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "", `{"qty":1}`))
+	if calls != 3 {
+		t.Errorf("keyless requests: calls = %d, want 3", calls)
+	}
+}
+
+func TestIdempotencyMismatch(t *testing.T) {
+	h := Idempotency(IdempotencyOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "k1", `{"qty":1}`))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("POST", "/orders", "k1", `{"qty":2}`))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Error.Code != "idempotency_key_mismatch" {
+		t.Errorf("body = %s", rec.Body)
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	h := Idempotency(IdempotencyOptions{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := idempotentRequest("POST", "/orders", "k1", `{}`)
+	if _, ok, _ := store.Begin(context.Background(), "k1", requestFingerprint(req, []byte(`{}`)), time.Hour); !ok {
+		t.Fatal("Begin on a fresh store failed")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var env ErrorEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if rec.Code != http.StatusConflict || env.Error == nil || !env.Error.Retryable {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestIdempotencyServerErrorNotStored(t *testing.T) {
+	fail := true
+	var calls int
+	h := Idempotency(IdempotencyOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), idempotentRequest("POST", "/orders", "k1", `{}`))
+	fail = false
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("POST", "/orders", "k1", `{}`))
+	if calls != 2 || rec.Code != http.StatusOK {
+		t.Errorf("retry after 5xx: calls = %d, status = %d", calls, rec.Code)
+	}
+}
+
+func TestIdempotencyCallerScope(t *testing.T) {
+	var calls int
+	h := Idempotency(IdempotencyOptions{
+		Caller: func(r *http.Request) string { return r.Header.Get("X-Caller") },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+
+	for _, caller := range []string{"alice", "bob", "alice"} {
+		req := idempotentRequest("POST", "/orders", "k1", `{}`)
+		req.Header.Set("X-Caller", caller)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %d, want one per caller", calls)
+	}
+}
+
+func TestIdempotencyRequired(t *testing.T) {
+	h := Idempotency(IdempotencyOptions{Required: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("POST", "/orders", "", `{}`))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "idempotency_key_required") {
+		t.Errorf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("GET", "/orders", "", ""))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET without key: status = %d", rec.Code)
+	}
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	calls := 0
+	h := Idempotency(IdempotencyOptions{MaxBody: 8})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("POST", "/orders", "k1", `{"qty":1000}`))
+	if rec.Code != http.StatusRequestEntityTooLarge || calls != 0 || !strings.Contains(rec.Body.String(), "request_too_large") {
+		t.Errorf("oversized: status = %d, calls = %d, body = %s", rec.Code, calls, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, idempotentRequest("POST", "/orders", "k1", `{"q":1}`))
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Errorf("within limit: status = %d, calls = %d", rec.Code, calls)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	now := time.Unix(1_700_000_000, 0)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store.Begin(ctx, "k", "fp", time.Minute)
+	if _, ok, _ := store.Begin(ctx, "k", "fp", time.Minute); ok {
+		t.Error("key reserved twice")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok, _ := store.Begin(ctx, "k", "other", time.Minute); !ok {
+		t.Error("expired key not released")
+	}
+}
+
+func TestIdempotencyWithMiddleware(t *testing.T) {
+	reg := NewRegistry()
+	reg.Post("/orders").
+		Description("Orders.").
+		Actions(Action{Rel: "create", Method: "POST", Href: "/orders", Idempotent: true}).
+		MustRegister()
+	var calls int
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"id":1}`))
+	})
+	h := Middleware(Options{Registry: reg})(Idempotency(IdempotencyOptions{})(api))
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := idempotentRequest("POST", "/orders", "k1", body)
+		req.Header.Set("Accept", MediaType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send(`{}`)
+	rec := send(`{}`)
+	var env SuccessEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if calls != 1 || string(env.Data) != `{"id":1}` || !env.HAC.Actions[0].Idempotent {
+		t.Errorf("replayed envelope = %s, calls = %d", rec.Body, calls)
+	}
+	if !strings.Contains(rec.Body.String(), `"x-idempotent":true`) {
+		t.Errorf("action does not advertise x-idempotent: %s", rec.Body)
+	}
+
+	rec = send(`{"other":true}`)
+	var errEnv ErrorEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &errEnv)
+	if rec.Code != http.StatusUnprocessableEntity || errEnv.Error.Code != "idempotency_key_mismatch" {
+		t.Errorf("mismatch through middleware = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestIdempotencyDryRun(t *testing.T) {
+	reg := NewRegistry()
+	reg.Post("/orders").Description("Orders.").DryRun().MustRegister()
+	var placed int
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsDryRun(r) {
+			w.Write([]byte(`{"status":"preview"}`))
+			return
+		}
+		placed++
+		w.Write([]byte(`{"status":"placed"}`))
+	})
+	h := Middleware(Options{Registry: reg})(Idempotency(IdempotencyOptions{})(api))
+
+	send := func(dryRun bool) *httptest.ResponseRecorder {
+		req := idempotentRequest("POST", "/orders", "k1", `{"qty":1}`)
+		req.Header.Set("Accept", MediaType)
+		if dryRun {
+			req.Header.Set("Prefer", DryRunPreference)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	send(true)
+	rec := send(false)
+	var env SuccessEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if placed != 1 || string(env.Data) != `{"status":"placed"}` || env.HAC.Simulated {
+		t.Errorf("real request after dry run: placed = %d, body = %s", placed, rec.Body)
+	}
+	if rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("real request was answered with the stored preview")
+	}
+
+	// The real result is still replayed for retries, but not for previews.
+	send(false)
+	rec = send(true)
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if placed != 1 || string(env.Data) != `{"status":"preview"}` {
+		t.Errorf("dry run after real request: placed = %d, body = %s", placed, rec.Body)
+	}
+}
@@ -0,0 +1,135 @@
+package hac
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Names of the safety fields InferSafety can fill, as listed in
+// Action.InferredSafety.
+const (
+	InferredMutability  = "mutability"
+	InferredBlastRadius = "blast_radius"
+)
+
+// InferSafety enables safety inference from HTTP method semantics. Routes
+// already registered, and every route registered or mounted afterwards, have
+// their actions' missing mutability and blast radius filled in:
+//
+//   - GET, HEAD and OPTIONS are read_only
+//   - PUT and PATCH are reversible
+//   - DELETE is irreversible, as a conservative default (spec §12.2)
+//
+// State-changing actions also get a blast radius from their href: self when
+// it targets an item, such as "/users/{id}", and many when it targets a
+// collection, such as "/users". POST is always self, since it creates or acts
+// on a single resource; its mutability is left unset. Declared values are
+// never replaced. Inferred fields are listed in Action.InferredSafety so
+// agents can tell them from declared ones.
+//
+// InferSafety returns ErrRegistryFrozen if the registry is frozen.
+func (reg *Registry) InferSafety() error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.frozen.Load() {
+		return fmt.Errorf("hac: infer safety: %w", ErrRegistryFrozen)
+	}
+	reg.inferSafety = true
+	for k, cfg := range reg.routes {
+		// Replace rather than modify the config: readers may hold it.
+		next := *cfg
+		next.Actions = inferActions(cfg.Actions)
+		reg.routes[k] = &next
+	}
+	reg.actions.Store(nil)
+	return nil
+}
+
+// inferActions returns a copy of actions with missing safety fields
+// inferred.
+func inferActions(actions []Action) []Action {
+	if actions == nil {
+		return nil
+	}
+	out := make([]Action, len(actions))
+	for i, a := range actions {
+		out[i] = inferAction(a)
+	}
+	return out
+}
+
+// inferAction fills a's missing mutability and blast radius from its method
+// and href.
+func inferAction(a Action) Action {
+	var s Safety
+	if a.Safety != nil {
+		s = *a.Safety
+	}
+	inferred := slices.Clone(a.InferredSafety)
+	method := strings.ToUpper(a.Method)
+	if s.Mutability == "" {
+		if d := defaultSafety(method); d != nil {
+			s.Mutability = d.Mutability
+			inferred = append(inferred, InferredMutability)
+		}
+	}
+	if s.BlastRadius == "" && !isSafeMethod(method) {
+		s.BlastRadius = Many
+		if method == http.MethodPost || targetsItem(a.Href) {
+			s.BlastRadius = Self
+		}
+		inferred = append(inferred, InferredBlastRadius)
+	}
+	if a.Safety != nil || len(inferred) > len(a.InferredSafety) {
+		a.Safety = &s
+	}
+	a.InferredSafety = inferred
+	return a
+}
+
+// targetsItem reports whether href addresses a single resource, that is,
+// whether its last path segment is a template variable as in "/users/{id}".
+// Query expressions such as "{?fields}" are ignored.
+func targetsItem(href string) bool {
+	if i := strings.Index(href, "{?"); i >= 0 {
+		href = href[:i]
+	}
+	if i := strings.Index(href, "{&"); i >= 0 {
+		href = href[:i]
+	}
+	href = strings.TrimSuffix(href, "/")
+	last := href[strings.LastIndex(href, "/")+1:]
+	return strings.HasPrefix(last, "{") && strings.HasSuffix(last, "}")
+}
+
+// inferredCopy returns a frozen copy of reg with safety inferred.
+func inferredCopy(reg *Registry) *Registry {
+	c := reg.clone()
+	c.InferSafety() // c is not frozen yet
+	c.Freeze()
+	return c
+}
+
+// inferringSource serves an inferred copy of each snapshot of src, made
+// once per snapshot.
+type inferringSource struct {
+	src  RegistrySource
+	last atomic.Pointer[inferredSnapshot]
+}
+
+type inferredSnapshot struct {
+	base, inferred *Registry
+}
+
+func (s *inferringSource) Registry() *Registry {
+	base := s.src.Registry()
+	if last := s.last.Load(); last != nil && last.base == base {
+		return last.inferred
+	}
+	inferred := inferredCopy(base)
+	s.last.Store(&inferredSnapshot{base: base, inferred: inferred})
+	return inferred
+}
@@ -0,0 +1,152 @@
+package hac
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferAction(t *testing.T) {
+	tests := []struct {
+		name         string
+		in           Action
+		want         *Safety
+		wantInferred []string
+	}{
+		{"get", Action{Method: "GET", Href: "/users"},
+			&Safety{Mutability: ReadOnly}, []string{"mutability"}},
+		{"delete item", Action{Method: "DELETE", Href: "/users/{id}"},
+			&Safety{Mutability: Irreversible, BlastRadius: Self}, []string{"mutability", "blast_radius"}},
+		{"delete collection", Action{Method: "DELETE", Href: "/users{?status}"},
+			&Safety{Mutability: Irreversible, BlastRadius: Many}, []string{"mutability", "blast_radius"}},
+		{"patch item with query", Action{Method: "patch", Href: "/users/{id}{?fields}"},
+			&Safety{Mutability: Reversible, BlastRadius: Self}, []string{"mutability", "blast_radius"}},
+		{"post", Action{Method: "POST", Href: "/users"},
+			&Safety{BlastRadius: Self}, []string{"blast_radius"}},
+		{"declared kept", Action{Method: "DELETE", Href: "/users",
+			Safety: &Safety{Mutability: Reversible, ConfirmationRecommended: true}},
+			&Safety{Mutability: Reversible, BlastRadius: Many, ConfirmationRecommended: true}, []string{"blast_radius"}},
+		{"fully declared", Action{Method: "PUT", Href: "/users/{id}",
+			Safety: &Safety{Mutability: Irreversible, BlastRadius: All}},
+			&Safety{Mutability: Irreversible, BlastRadius: All}, nil},
+		{"nothing to infer", Action{Method: "TRACE", Href: "/users"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inferAction(tt.in)
+			if !reflect.DeepEqual(got.Safety, tt.want) || !reflect.DeepEqual(got.InferredSafety, tt.wantInferred) {
+				t.Errorf("safety = %+v, inferred %v, want %+v, inferred %v", got.Safety, got.InferredSafety, tt.want, tt.wantInferred)
+			}
+		})
+	}
+}
+
+func TestRegistryInferSafety(t *testing.T) {
+	declared := &Safety{Mutability: Irreversible}
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}", Safety: declared}).
+		MustRegister()
+	before := reg.Lookup("GET", "/users/{id}")
+
+	if err := reg.InferSafety(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reg.Lookup("GET", "/users/{id}").Actions[0]; got.Safety.BlastRadius != Self ||
+		!reflect.DeepEqual(got.InferredSafety, []string{"blast_radius"}) {
+		t.Errorf("existing route action = %+v", got)
+	}
+	if before.Actions[0].Safety != declared || declared.BlastRadius != "" {
+		t.Error("InferSafety modified a config in place")
+	}
+
+	reg.Get("/orders").Actions(Action{Rel: "clear", Method: "DELETE", Href: "/orders"}).MustRegister()
+	if got := reg.Lookup("GET", "/orders").Actions[0].Safety; got == nil || got.BlastRadius != Many {
+		t.Errorf("later route safety = %+v", got)
+	}
+
+	reg.Freeze()
+	if err := reg.InferSafety(); !errors.Is(err, ErrRegistryFrozen) {
+		t.Errorf("frozen: err = %v", err)
+	}
+}
+
+func TestMiddlewareInferSafety(t *testing.T) {
+	reg := NewRegistry()
+	h := Middleware(Options{Registry: reg, InferSafety: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	reg.Get("/users/{id}").Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"}).MustRegister()
+
+	req := httptest.NewRequest("GET", "/users/{id}", nil)
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), `"x-inferred-safety":["mutability","blast_radius"]`) {
+		t.Errorf("body = %s", rec.Body)
+	}
+	var env SuccessEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if s := env.HAC.Actions[0].Safety; s == nil || s.Mutability != Irreversible {
+		t.Errorf("safety = %+v", s)
+	}
+}
+
+func TestMiddlewareInferSafetySources(t *testing.T) {
+	build := func(desc string) *Registry {
+		reg := NewRegistry()
+		reg.Get("/users/{id}").Description(desc).
+			Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"}).MustRegister()
+		return reg
+	}
+	frozen := build("Frozen.")
+	frozen.Freeze()
+	rl := NewReloader(build("Version one."))
+	custom := NewReloader(build("Custom."))
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"frozen registry", Options{Registry: frozen}},
+		{"reloader", Options{Source: rl}},
+		{"other source", Options{Source: struct{ RegistrySource }{custom}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.InferSafety = true
+			h := Middleware(tt.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{}`))
+			}))
+			req := httptest.NewRequest("GET", "/users/{id}", nil)
+			req.Header.Set("Accept", MediaType)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			var env SuccessEnvelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatalf("body = %s", rec.Body)
+			}
+			if a := env.HAC.Actions[0]; a.Safety == nil || a.Safety.Mutability != Irreversible || len(a.InferredSafety) != 2 {
+				t.Errorf("action = %+v", a)
+			}
+		})
+	}
+
+	// The reloader infers each snapshot it loads, for every consumer.
+	if err := rl.Update(build("Version two.")); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := rl.Registry().MatchAction("DELETE", "/users/1"); a.Safety == nil || a.Safety.BlastRadius != Self {
+		t.Errorf("reloaded action = %+v", a)
+	}
+	if frozen.Lookup("GET", "/users/{id}").Actions[0].Safety != nil {
+		t.Error("frozen registry modified")
+	}
+}
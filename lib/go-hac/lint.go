@@ -0,0 +1,236 @@
+package hac
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Severity ranks lint findings.
+type Severity string
+
+const (
+	// SeverityError marks metadata that violates the spec.
+	SeverityError Severity = "error"
+
+	// SeverityWarning marks a departure from a spec SHOULD.
+	SeverityWarning Severity = "warning"
+
+	// SeverityInfo marks an authoring suggestion.
+	SeverityInfo Severity = "info"
+)
+
+// Lint rule identifiers, reported in LintFinding.Rule.
+const (
+	RuleMissingSafety      = "missing-safety"
+	RuleReversibleWithin   = "reversible-within"
+	RuleInvalidDuration    = "invalid-duration"
+	RuleInvalidCurrency    = "invalid-currency"
+	RuleTemplateField      = "template-field"
+	RuleRelFormat          = "rel-format"
+	RuleDuplicateRel       = "duplicate-rel"
+	RuleShortDescription   = "short-description"
+	RuleMissingConsequence = "missing-consequence"
+)
+
+// MinDescriptionLength is the length below which Lint reports a description
+// as too short to guide an agent.
+const MinDescriptionLength = 20
+
+// LintFinding is a single problem reported by Registry.Lint.
+type LintFinding struct {
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+
+	// Route is the registered route as "METHOD pattern".
+	Route string `json:"route"`
+
+	// Action is the rel of the offending action, or empty when the finding
+	// concerns the route itself.
+	Action string `json:"action,omitempty"`
+
+	Message string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	loc := f.Route
+	if f.Action != "" {
+		loc += " action " + f.Action
+	}
+	return fmt.Sprintf("%s: %s [%s] %s", f.Severity, loc, f.Rule, f.Message)
+}
+
+// Lint checks the registered metadata against the spec's SHOULDs and the
+// description guidelines of §3.2:
+//
+//   - mutating actions without mutability or blast_radius (§5)
+//   - reversible_within on actions that are not reversible (§5.3)
+//   - reversible_within values that are not ISO 8601 durations
+//   - cost currencies that are not ISO 4217 codes (§5.5)
+//   - href template variables with no matching field (§4.4)
+//   - rels that are neither URIs nor lowercase hyphenated tokens (§4.2)
+//   - duplicate rels among a route's actions
+//   - missing or short descriptions, and irreversible or costly actions
+//     whose description does not state the consequence
+//
+// Findings are ordered by route, then by action. An action shared by several
+// routes is reported once, under the first route that declares it.
+func (reg *Registry) Lint() []LintFinding {
+	var findings []LintFinding
+	linted := make(map[routeKey]bool)
+	for _, pair := range sortedRoutes(reg) {
+		cfg := reg.Lookup(pair[0], pair[1])
+		if cfg == nil {
+			continue
+		}
+		route := pair[0] + " " + routePath(pair[1])
+		report := func(sev Severity, rule, action, format string, args ...any) {
+			findings = append(findings, LintFinding{
+				Severity: sev,
+				Rule:     rule,
+				Route:    route,
+				Action:   action,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		switch {
+		case cfg.Description == "":
+			report(SeverityInfo, RuleShortDescription, "", "route has no description")
+		case len(cfg.Description) < MinDescriptionLength:
+			report(SeverityInfo, RuleShortDescription, "", "description %q is too short to guide an agent", cfg.Description)
+		}
+
+		rels := make(map[string]bool)
+		for _, a := range cfg.Actions {
+			if rels[a.Rel] {
+				report(SeverityWarning, RuleDuplicateRel, a.Rel, "rel %q is used by more than one action on this route", a.Rel)
+			}
+			rels[a.Rel] = true
+
+			k := routeKey{method: a.Method, pattern: a.Href}
+			if linted[k] {
+				continue
+			}
+			linted[k] = true
+			lintAction(a, func(sev Severity, rule, format string, args ...any) {
+				report(sev, rule, a.Rel, format, args...)
+			})
+		}
+	}
+	return findings
+}
+
+// lintAction applies the action-level rules to a.
+func lintAction(a Action, report func(sev Severity, rule, format string, args ...any)) {
+	if !validRel(a.Rel) {
+		report(SeverityWarning, RuleRelFormat, "rel %q should be an IANA relation type, a URI, or a lowercase hyphenated token", a.Rel)
+	}
+
+	s := a.Safety
+	if !isSafeMethod(a.Method) {
+		switch {
+		case s == nil:
+			report(SeverityWarning, RuleMissingSafety, "%s action has no safety metadata", a.Method)
+		default:
+			if s.Mutability == "" {
+				report(SeverityWarning, RuleMissingSafety, "%s action has no mutability", a.Method)
+			}
+			if s.BlastRadius == "" {
+				report(SeverityWarning, RuleMissingSafety, "%s action has no blast_radius", a.Method)
+			}
+		}
+	}
+	if s != nil && s.ReversibleWithin != "" {
+		if s.Mutability != Reversible {
+			report(SeverityWarning, RuleReversibleWithin, "reversible_within only applies to reversible actions, not %q", s.Mutability)
+		}
+		if !validDuration(s.ReversibleWithin) {
+			report(SeverityError, RuleInvalidDuration, "reversible_within %q is not an ISO 8601 duration", s.ReversibleWithin)
+		}
+	}
+	if s != nil && s.Cost != nil && !iso4217[s.Cost.Currency] {
+		report(SeverityError, RuleInvalidCurrency, "cost currency %q is not an ISO 4217 code", s.Cost.Currency)
+	}
+
+	fields := make(map[string]bool, len(a.Fields))
+	for _, f := range a.Fields {
+		fields[f.Name] = true
+	}
+	for _, v := range templateVars(a.Href) {
+		if !fields[v.name] {
+			report(SeverityWarning, RuleTemplateField, "href variable {%s} has no matching field", v.name)
+		}
+	}
+
+	switch {
+	case a.Description == "":
+		report(SeverityInfo, RuleShortDescription, "action has no description")
+	case len(a.Description) < MinDescriptionLength:
+		report(SeverityInfo, RuleShortDescription, "description %q is too short to guide an agent", a.Description)
+	}
+	if s != nil && a.Description != "" {
+		desc := strings.ToLower(a.Description)
+		if s.Mutability == Irreversible && !containsAny(desc, irreversibleWords) {
+			report(SeverityInfo, RuleMissingConsequence, "irreversible action description should say the change cannot be undone")
+		}
+		if s.Cost != nil && !containsAny(desc+" "+strings.ToLower(s.Cost.Description), costWords) {
+			report(SeverityInfo, RuleMissingConsequence, "costly action description should mention the charge")
+		}
+	}
+}
+
+var (
+	relTokenPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	durationPattern = regexp.MustCompile(`^P(?:\d+Y)?(?:\d+M)?(?:\d+W)?(?:\d+D)?(?:T(?:\d+H)?(?:\d+M)?(?:\d+S)?)?$`)
+)
+
+// validRel reports whether rel is an extension token or an absolute URI.
+// Registered IANA relation types are themselves lowercase tokens.
+func validRel(rel string) bool {
+	if relTokenPattern.MatchString(rel) {
+		return true
+	}
+	u, err := url.Parse(rel)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// validDuration reports whether d is an ISO 8601 duration with at least one
+// component, such as "P30D" or "PT1H".
+func validDuration(d string) bool {
+	return durationPattern.MatchString(d) && d != "P" && !strings.HasSuffix(d, "T")
+}
+
+var (
+	irreversibleWords = []string{"permanent", "cannot be undone", "can't be undone", "irreversib", "not be recovered", "no undo"}
+	costWords         = []string{"charge", "cost", "bill", "fee", "price", "pay", "invoice"}
+)
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// iso4217 holds the active ISO 4217 alphabetic currency codes.
+var iso4217 = func() map[string]bool {
+	const codes = "AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF " +
+		"BMD BND BOB BOV BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CLF CLP CNY " +
+		"COP COU CRC CUP CVE CZK DJF DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL " +
+		"GHS GIP GMD GNF GTQ GYD HKD HNL HTG HUF IDR ILS INR IQD IRR ISK JMD JOD " +
+		"JPY KES KGS KHR KMF KPW KRW KWD KYD KZT LAK LBP LKR LRD LSL LYD MAD MDL " +
+		"MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR " +
+		"NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF SAR SBD SCR SDG " +
+		"SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND TOP TRY TTD " +
+		"TWD TZS UAH UGX USD USN UYI UYU UYW UZS VED VES VND VUV WST XAF XAG XAU " +
+		"XBA XBB XBC XBD XCD XCG XDR XOF XPD XPF XPT XSU XTS XUA XXX YER ZAR ZMW ZWG"
+	m := make(map[string]bool)
+	for _, c := range strings.Fields(codes) {
+		m[c] = true
+	}
+	return m
+}()
@@ -0,0 +1,123 @@
+package hac
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryLint(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("GET /users/{id}").
+		Description("A user account with profile and billing details.").
+		Actions(
+			Action{
+				Rel: "delete", Method: "DELETE", Href: "/users/{id}",
+				Description: "Delete this user and all of their orders.",
+				Fields:      []Field{{Name: "id", Type: "string"}},
+				Safety:      &Safety{Mutability: Irreversible, BlastRadius: SelfAndAssociated, ReversibleWithin: "P30D"},
+			},
+			Action{
+				Rel: "Upgrade_Plan", Method: "POST", Href: "/users/{id}/upgrade",
+				Description: "Upgrade.",
+				Safety: &Safety{
+					Mutability: Reversible, ReversibleWithin: "30 days",
+					Cost: &Cost{Amount: 49, Currency: "usd"},
+				},
+			},
+			Action{Rel: "delete", Method: "POST", Href: "/users/{id}/archive", Description: "Archive this user; restorable for a week."},
+		).
+		MustRegister()
+	reg.Get("GET /health").MustRegister()
+
+	type key struct {
+		sev  Severity
+		rule string
+		rel  string
+	}
+	got := make(map[key]int)
+	for _, f := range reg.Lint() {
+		got[key{f.Severity, f.Rule, f.Action}]++
+	}
+
+	want := map[key]int{
+		{SeverityInfo, RuleShortDescription, ""}:               1, // GET /health
+		{SeverityWarning, RuleReversibleWithin, "delete"}:      1,
+		{SeverityInfo, RuleMissingConsequence, "delete"}:       1,
+		{SeverityWarning, RuleRelFormat, "Upgrade_Plan"}:       1,
+		{SeverityWarning, RuleMissingSafety, "Upgrade_Plan"}:   1, // blast_radius
+		{SeverityError, RuleInvalidDuration, "Upgrade_Plan"}:   1,
+		{SeverityError, RuleInvalidCurrency, "Upgrade_Plan"}:   1,
+		{SeverityWarning, RuleTemplateField, "Upgrade_Plan"}:   1,
+		{SeverityInfo, RuleShortDescription, "Upgrade_Plan"}:   1,
+		{SeverityInfo, RuleMissingConsequence, "Upgrade_Plan"}: 1,
+		{SeverityWarning, RuleDuplicateRel, "delete"}:          1,
+		{SeverityWarning, RuleMissingSafety, "delete"}:         1, // archive has no safety
+		{SeverityWarning, RuleTemplateField, "delete"}:         1, // archive has no id field
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("%v: got %d findings, want %d", k, got[k], n)
+		}
+	}
+	for k, n := range got {
+		if _, ok := want[k]; !ok {
+			t.Errorf("unexpected finding %v (x%d)", k, n)
+		}
+	}
+}
+
+func TestRegistryLintClean(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("GET /users/{id}").
+		Description("A user account with profile and billing details.").
+		Actions(Action{
+			Rel: "https://api.example.com/rels/deactivate", Method: "POST", Href: "/users/{id}/deactivate",
+			Description: "Deactivate this user. Can be reactivated within 30 days.",
+			Fields:      []Field{{Name: "id", Type: "string", Required: true}},
+			Safety:      &Safety{Mutability: Reversible, BlastRadius: Self, ReversibleWithin: "P30D"},
+		}).
+		MustRegister()
+
+	if findings := reg.Lint(); len(findings) != 0 {
+		t.Errorf("findings = %v", findings)
+	}
+}
+
+func TestValidDuration(t *testing.T) {
+	for d, want := range map[string]bool{
+		"P30D": true, "PT1H": true, "P1Y2M3DT4H5M6S": true, "P2W": true,
+		"P": false, "PT": false, "30D": false, "P1DT": false, "": false,
+	} {
+		if got := validDuration(d); got != want {
+			t.Errorf("validDuration(%q) = %v, want %v", d, got, want)
+		}
+	}
+}
+
+func TestLintFindingString(t *testing.T) {
+	f := LintFinding{Severity: SeverityError, Rule: RuleInvalidCurrency, Route: "GET /users/{id}", Action: "upgrade", Message: "bad"}
+	if s := f.String(); !strings.Contains(s, "GET /users/{id} action upgrade") || !strings.HasPrefix(s, "error") {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestValidRel(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"self", true},
+		{"edit-form", true},
+		{"v2-upgrade", true},
+		{"https://api.example.com/rels/deactivate", true},
+		{"orders.list", false},
+		{"Upgrade_Plan", false},
+		{"trailing-", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validRel(tt.rel); got != tt.want {
+			t.Errorf("validRel(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
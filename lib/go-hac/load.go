@@ -0,0 +1,349 @@
+package hac
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// registryFile is the JSON document read by LoadRegistry:
+//
+//	{
+//	  "routes": [
+//	    {
+//	      "method": "GET",
+//	      "pattern": "/users/{id}",
+//	      "description": "A user account.",
+//	      "actions": [{"rel": "delete", "method": "DELETE", "href": "/users/{id}", ...}],
+//	      "related": [{"rel": "orders", "href": "/users/{id}/orders"}],
+//	      "tags": ["users"],
+//	      "dry_run": false
+//	    }
+//	  ],
+//	  "errors": [
+//	    {"code": "insufficient_funds", "message": "...", "recovery": {...}}
+//	  ]
+//	}
+//
+// Actions, related resources and errors use their wire format.
+type registryFile struct {
+	Routes []routeFile `json:"routes"`
+	Errors []HACError  `json:"errors"`
+}
+
+type routeFile struct {
+	// Method may be omitted when Pattern starts with one, as in
+	// "GET /users/{id}".
+	Method      string            `json:"method"`
+	Pattern     string            `json:"pattern"`
+	Description string            `json:"description"`
+	Actions     []Action          `json:"actions"`
+	Related     []RelatedResource `json:"related"`
+	Tags        []string          `json:"tags"`
+	DryRun      bool              `json:"dry_run"`
+}
+
+// ConfigError reports a problem in a registry configuration document, with
+// the line and column where it was found.
+type ConfigError struct {
+	// File is the name of the document, or empty for LoadRegistry.
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ConfigError) Error() string {
+	loc := strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column)
+	if e.File != "" {
+		loc = e.File + ":" + loc
+	}
+	return "hac: " + loc + ": " + strings.TrimPrefix(e.Err.Error(), "hac: ")
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// LoadRegistry reads a JSON registry document (see the README for the
+// format) and returns a registry holding its routes and error catalog.
+// Decoding is strict: unknown members, wrong types and routes that fail
+// validation are reported as *ConfigError with line and column, and all
+// validation problems are returned together.
+func LoadRegistry(r io.Reader) (*Registry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reg := NewRegistry()
+	if err := loadRegistry(reg, "", data); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// LoadRegistryFS loads every file in fsys matching glob (see fs.Glob), in
+// lexical order, into one registry. It works with embed.FS, so descriptions
+// can be edited as JSON and compiled into the binary:
+//
+//	//go:embed hac/*.json
+//	var hacFiles embed.FS
+//
+//	reg, err := hac.LoadRegistryFS(hacFiles, "hac/*.json")
+//
+// A route or error code defined in more than one file is an error.
+func LoadRegistryFS(fsys fs.FS, glob string) (*Registry, error) {
+	names, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("hac: no registry files match %q", glob)
+	}
+	sort.Strings(names)
+
+	reg := NewRegistry()
+	var errs []error
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, loadRegistry(reg, name, data))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// loadRegistry decodes one document into reg.
+func loadRegistry(reg *Registry, name string, data []byte) error {
+	at := func(offset int64, err error) error {
+		line, col := lineColumn(data, offset)
+		return &ConfigError{File: name, Line: line, Column: col, Err: err}
+	}
+
+	starts := make(map[string]int64)
+	if err := checkMembers(data, reflect.TypeFor[registryFile](), starts); err != nil {
+		var loc *locatedError
+		if errors.As(err, &loc) {
+			return at(loc.offset, loc.err)
+		}
+		return at(0, err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return at(typeErr.Offset, fmt.Errorf("%s: cannot use JSON %s as %s", typeErr.Field, typeErr.Value, typeErr.Type))
+		}
+		return at(0, err)
+	}
+
+	var errs []error
+	for i, rf := range file.Routes {
+		method := rf.Method
+		if m, _, ok := strings.Cut(rf.Pattern, " "); ok && method == "" && !strings.HasPrefix(m, "/") {
+			method = m
+		}
+		b := reg.Route(method, rf.Pattern).
+			Description(rf.Description).
+			Actions(rf.Actions...).
+			Related(rf.Related...).
+			Tags(rf.Tags...)
+		if rf.DryRun {
+			b.DryRun()
+		}
+		if err := b.Register(); err != nil {
+			// Report each of the route's problems on its own.
+			problems := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				problems = joined.Unwrap()
+			}
+			for _, p := range problems {
+				errs = append(errs, at(starts["/routes/"+strconv.Itoa(i)], p))
+			}
+		}
+	}
+	for i, e := range file.Errors {
+		var err error
+		if e.Message == "" {
+			err = fmt.Errorf("hac: error %q: message is required", e.Code)
+		} else {
+			err = reg.RegisterError(e)
+		}
+		if err != nil {
+			errs = append(errs, at(starts["/errors/"+strconv.Itoa(i)], err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// locatedError is an error at a byte offset in the document.
+type locatedError struct {
+	offset int64
+	err    error
+}
+
+func (e *locatedError) Error() string { return e.err.Error() }
+
+// checkMembers walks data and reports the first object member that t, the
+// type it decodes into, does not declare. encoding/json's
+// DisallowUnknownFields gives no position for such members. The offsets of
+// array elements are recorded in starts, keyed by JSON Pointer.
+func checkMembers(data []byte, t reflect.Type, starts map[string]int64) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := walkValue(dec, data, t, "", starts); err != nil {
+		return err
+	}
+	offset := skipSpace(data, dec.InputOffset())
+	if _, err := dec.Token(); err != io.EOF {
+		return &locatedError{offset: offset, err: errors.New("unexpected data after the document")}
+	}
+	return nil
+}
+
+func walkValue(dec *json.Decoder, data []byte, t reflect.Type, path string, starts map[string]int64) error {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return &locatedError{offset: max(0, syntax.Offset-1), err: err}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &locatedError{offset: dec.InputOffset(), err: err}
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		var fields map[string]reflect.Type
+		var elem reflect.Type
+		switch {
+		case t == nil:
+		case t.Kind() == reflect.Struct:
+			fields = jsonFields(t)
+		case t.Kind() == reflect.Map:
+			elem = t.Elem()
+		}
+		for dec.More() {
+			offset := skipSpace(data, dec.InputOffset())
+			keyTok, err := dec.Token()
+			if err != nil {
+				return &locatedError{offset: offset, err: err}
+			}
+			key := keyTok.(string)
+			ft := elem
+			if fields != nil {
+				var ok bool
+				if ft, ok = fields[strings.ToLower(key)]; !ok {
+					return &locatedError{offset: offset, err: fmt.Errorf("unknown member %q", key)}
+				}
+			}
+			if err := walkValue(dec, data, ft, path+"/"+key, starts); err != nil {
+				return err
+			}
+		}
+		return closeToken(dec)
+
+	case json.Delim('['):
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := 0; dec.More(); i++ {
+			p := path + "/" + strconv.Itoa(i)
+			starts[p] = skipSpace(data, dec.InputOffset())
+			if err := walkValue(dec, data, elem, p, starts); err != nil {
+				return err
+			}
+		}
+		return closeToken(dec)
+	}
+	return nil
+}
+
+// closeToken consumes the delimiter that ends an object or array.
+func closeToken(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return &locatedError{offset: max(0, syntax.Offset-1), err: err}
+		}
+		return &locatedError{offset: dec.InputOffset(), err: err}
+	}
+	return nil
+}
+
+// jsonFields maps the lowercased JSON member names of struct type t to
+// their types, following encoding/json's rules for tags and embedding.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range jsonFields(ft) {
+					fields[k] = v
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
+
+// skipSpace advances offset past whitespace and a value separator, to the
+// start of the next token.
+func skipSpace(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// lineColumn converts a byte offset into a 1-based line and column.
+func lineColumn(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return line, col
+}
@@ -0,0 +1,145 @@
+package hac
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testRegistryDoc = `{
+  "routes": [
+    {
+      "pattern": "GET /users/{id}",
+      "description": "A user account.",
+      "actions": [
+        {
+          "rel": "delete",
+          "method": "DELETE",
+          "href": "/users/{id}",
+          "description": "Permanently delete this user.",
+          "safety": {"mutability": "irreversible", "blast_radius": "self"},
+          "fields": [{"name": "id", "type": "string", "required": true}]
+        }
+      ],
+      "related": [{"rel": "orders", "href": "/users/{id}/orders"}]
+    },
+    {"method": "POST", "pattern": "/orders", "description": "Place an order.", "dry_run": true}
+  ],
+  "errors": [
+    {
+      "code": "insufficient_funds",
+      "message": "The account balance is too low.",
+      "recovery": {"description": "Ask the user to top up their balance."}
+    }
+  ]
+}`
+
+func TestLoadRegistry(t *testing.T) {
+	reg, err := LoadRegistry(strings.NewReader(testRegistryDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := reg.Lookup("GET", "GET /users/{id}")
+	if cfg == nil || cfg.Description != "A user account." || len(cfg.Actions) != 1 || len(cfg.Related) != 1 {
+		t.Fatalf("GET route = %+v", cfg)
+	}
+	if a := cfg.Actions[0]; a.Safety.Mutability != Irreversible || !a.Fields[0].Required {
+		t.Errorf("action = %+v", a)
+	}
+	if cfg := reg.Lookup("POST", "/orders"); cfg == nil || !cfg.DryRun {
+		t.Errorf("POST route = %+v", cfg)
+	}
+	if cat := reg.ErrorCatalog(); len(cat) != 1 || cat[0].Recovery == nil {
+		t.Errorf("error catalog = %+v", cat)
+	}
+}
+
+func TestLoadRegistryErrors(t *testing.T) {
+	tests := []struct {
+		name, doc string
+		want      []string
+	}{
+		{"syntax", "{\n  \"routes\": [,]\n}", []string{"2:14"}},
+		{"unknown member", "{\n  \"routes\": [\n    {\"pattern\": \"/a\", \"method\": \"GET\",\n     \"descripton\": \"typo\"}\n  ]\n}",
+			[]string{`4:6: unknown member "descripton"`}},
+		{"unknown nested member", `{"routes": [{"pattern": "/a", "method": "GET", "actions": [{"rel": "x", "method": "GET", "href": "/a", "safty": {}}]}]}`,
+			[]string{`1:104: unknown member "safty"`}},
+		{"wrong type", `{"routes": [{"pattern": "/a", "method": "GET", "dry_run": "yes"}]}`,
+			[]string{"dry_run: cannot use JSON string as bool"}},
+		{"invalid route", "{\"routes\": [\n  {\"pattern\": \"/a\", \"method\": \"GET\"},\n  {\"pattern\": \"/b\", \"method\": \"FETCH\",\n   \"actions\": [{\"rel\": \"x\", \"method\": \"GET\", \"href\": \"/b\", \"safety\": {\"mutability\": \"maybe\"}}]}\n]}",
+			[]string{`3:3: FETCH /b: invalid method "FETCH"`, `3:3: FETCH /b: action x: invalid mutability "maybe"`}},
+		{"error without message", `{"errors": [{"code": "oops"}]}`, []string{`1:13: error "oops": message is required`}},
+		{"trailing data", `{} {}`, []string{"1:4: unexpected data"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := LoadRegistry(strings.NewReader(tt.doc))
+			if err == nil {
+				t.Fatalf("no error, registry %+v", reg.Routes())
+			}
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) {
+				t.Errorf("error %v is not a *ConfigError", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadRegistryFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"hac/users.json":  {Data: []byte(`{"routes": [{"pattern": "GET /users", "description": "All users."}]}`)},
+		"hac/orders.json": {Data: []byte(`{"routes": [{"pattern": "GET /orders", "description": "All orders."}]}`)},
+		"hac/notes.txt":   {Data: []byte(`not json`)},
+	}
+	reg, err := LoadRegistryFS(fsys, "hac/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reg.Routes()) != 2 {
+		t.Errorf("routes = %v", reg.Routes())
+	}
+
+	fsys["hac/dup.json"] = &fstest.MapFile{Data: []byte(`{"routes": [{"pattern": "GET /users"}]}`)}
+	_, err = LoadRegistryFS(fsys, "hac/*.json")
+	if !errors.Is(err, ErrDuplicateRoute) || !strings.Contains(err.Error(), "hac/users.json:1:13") {
+		t.Errorf("duplicate route error = %v", err)
+	}
+
+	if _, err := LoadRegistryFS(fsys, "none/*.json"); err == nil {
+		t.Error("no error for a glob with no matches")
+	}
+}
+
+func TestErrorCatalogInMiddleware(t *testing.T) {
+	reg, err := LoadRegistry(strings.NewReader(testRegistryDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Middleware(Options{Registry: reg, PathResolver: func(*http.Request) string { return "/orders" }})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusPaymentRequired)
+			w.Write([]byte(`{"code":"insufficient_funds"}`))
+		}))
+
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Error.Message != "The account balance is too low." || env.Error.Recovery == nil {
+		t.Errorf("error = %+v", env.Error)
+	}
+}
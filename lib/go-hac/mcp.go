@@ -0,0 +1,666 @@
+package hac
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// MCPProtocolVersion is the newest Model Context Protocol revision the bridge
+// speaks. Older revisions listed in mcpProtocolVersions are accepted during
+// initialization.
+const MCPProtocolVersion = "2025-06-18"
+
+var mcpProtocolVersions = []string{MCPProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// defaultMCPResourceBase prefixes resource URIs when an MCPServer has no
+// BaseURL.
+const defaultMCPResourceBase = "hac://api"
+
+// DefaultMaxMCPMessage is the largest JSON-RPC message the HTTP transport
+// reads when MCPServer.MaxMessageBytes is zero.
+const DefaultMaxMCPMessage = 4 << 20
+
+// defaultMCPForwardHeaders are the caller headers proxied requests carry when
+// MCPServer.ForwardHeaders is nil.
+var defaultMCPForwardHeaders = []string{"Authorization", "Cookie"}
+
+// MCPServer bridges a HAC-enabled API to the Model Context Protocol (spec
+// §11.5). Actions become MCP tools whose annotations are derived from their
+// safety metadata, GET endpoints become MCP resources, and every tool call or
+// resource read is proxied to the underlying API as a HAC-negotiated HTTP
+// request.
+//
+// MCPServer implements http.Handler for the streamable HTTP transport and
+// serves the stdio transport via ServeStdio.
+type MCPServer struct {
+	// Name and Version identify the server during initialization.
+	Name    string
+	Version string
+
+	// Instructions is optional guidance returned to the client during
+	// initialization.
+	Instructions string
+
+	// Tools are exposed via tools/list and tools/call.
+	Tools []Tool
+
+	// Resources are exposed via resources/list, or resources/templates/list
+	// when the href is a URI template.
+	Resources []ResourceEntry
+
+	// Handler serves proxied requests in-process. When nil, requests are sent
+	// to BaseURL using Client.
+	Handler http.Handler
+
+	// BaseURL is the API origin for remote proxying. It is also the prefix of
+	// resource URIs; when empty, resource URIs use the "hac://api" prefix.
+	BaseURL string
+
+	// Client sends remote requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// AllowedOrigins lists the Origin header values accepted by the HTTP
+	// transport. Requests without an Origin header are always accepted;
+	// requests with any other Origin are rejected to prevent DNS rebinding.
+	AllowedOrigins []string
+
+	// MaxMessageBytes caps the JSON-RPC message read by the HTTP transport.
+	// Larger messages are rejected with 413. Defaults to
+	// DefaultMaxMCPMessage.
+	MaxMessageBytes int64
+
+	// ForwardHeaders lists the headers of an HTTP transport request that are
+	// copied onto the API requests it causes, so the API authenticates the
+	// MCP caller. Defaults to Authorization and Cookie; an empty non-nil
+	// slice forwards nothing.
+	ForwardHeaders []string
+}
+
+// NewMCPServer builds an MCP bridge from a Registry. Tool calls and resource
+// reads are served in-process by h, which should be the API handler wrapped
+// in Middleware.
+func NewMCPServer(name, version string, reg *Registry, h http.Handler) *MCPServer {
+	var resources []ResourceEntry
+	seen := make(map[string]bool)
+	for _, pair := range sortedRoutes(reg) {
+		method, path := pair[0], routePath(pair[1])
+		if method != http.MethodGet || seen[path] {
+			continue
+		}
+		seen[path] = true
+		res := ResourceEntry{Rel: deriveRel(path), Href: path}
+		if cfg := reg.Lookup(pair[0], pair[1]); cfg != nil {
+			res.Description = cfg.Description
+		}
+		resources = append(resources, res)
+	}
+
+	return &MCPServer{
+		Name:      name,
+		Version:   version,
+		Tools:     ToolsFromRegistry(reg),
+		Resources: resources,
+		Handler:   h,
+	}
+}
+
+// NewRemoteMCPServer builds an MCP bridge for a remote HAC API by crawling it
+// from its discovery document. Only the actions and resources the crawler
+// reaches are exposed.
+func NewRemoteMCPServer(ctx context.Context, c *Crawler) (*MCPServer, error) {
+	g, err := c.Crawl(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &MCPServer{
+		BaseURL: strings.TrimSuffix(c.BaseURL, "/"),
+		Client:  c.Client,
+	}
+	if g.API != nil {
+		s.Name, s.Version, s.Instructions = g.API.Name, g.API.Version, g.API.Description
+	}
+
+	var actions []Action
+	seenAction := make(map[routeKey]bool)
+	seenResource := make(map[string]bool)
+	for _, n := range g.Resources {
+		for _, a := range n.Actions {
+			k := routeKey{method: a.Method, pattern: a.Href}
+			if !seenAction[k] {
+				seenAction[k] = true
+				actions = append(actions, a)
+			}
+		}
+		if n.Href == g.Root || seenResource[n.Href] || strings.Contains(n.Href, "://") {
+			continue
+		}
+		if (n.Fetched && n.Error == "") || isURITemplate(n.Href) {
+			seenResource[n.Href] = true
+			s.Resources = append(s.Resources, ResourceEntry{
+				Rel:         deriveRel(n.Href),
+				Href:        n.Href,
+				Description: n.Description,
+			})
+		}
+	}
+	s.Tools = ToolsFromActions(actions)
+	return s, nil
+}
+
+// ServeStdio runs the stdio transport: newline-delimited JSON-RPC messages
+// are read from in and responses are written to out. It returns nil when in
+// is exhausted, or ctx.Err() once ctx is cancelled. A read from in that is
+// blocked when ctx is cancelled is abandoned rather than interrupted, so the
+// caller should close in if it needs the reading goroutine to exit.
+func (s *MCPServer) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	type readResult struct {
+		line []byte
+		err  error
+	}
+	lines := make(chan readResult)
+	next := make(chan struct{})
+	go func() {
+		r := bufio.NewReader(in)
+		for {
+			line, err := r.ReadBytes('\n')
+			select {
+			case lines <- readResult{line, err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+			select {
+			case <-next:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var res readResult
+		select {
+		case res = <-lines:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if line := bytes.TrimSpace(res.line); len(line) > 0 {
+			if resp := s.handleMessage(ctx, line); resp != nil {
+				if _, werr := out.Write(append(resp, '\n')); werr != nil {
+					return werr
+				}
+			}
+		}
+		if errors.Is(res.err, io.EOF) {
+			return nil
+		}
+		if res.err != nil {
+			return res.err
+		}
+		select {
+		case next <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ServeHTTP implements the streamable HTTP transport. Each POST carries one
+// JSON-RPC message (or batch); requests are answered with a single JSON
+// response and notifications with 202 Accepted. Server-initiated streams are
+// not offered, so GET is rejected with 405.
+func (s *MCPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && !slices.Contains(s.AllowedOrigins, origin) {
+		http.Error(w, "Forbidden: origin not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := s.MaxMessageBytes
+	if limit <= 0 {
+		limit = DefaultMaxMCPMessage
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) > limit {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	forward := s.ForwardHeaders
+	if forward == nil {
+		forward = defaultMCPForwardHeaders
+	}
+	caller := make(http.Header)
+	for _, name := range forward {
+		for _, v := range r.Header.Values(name) {
+			caller.Add(name, v)
+		}
+	}
+	ctx := context.WithValue(r.Context(), mcpCallerKey{}, caller)
+
+	resp := s.handleMessage(ctx, body)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// JSON-RPC 2.0 error codes.
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcInternalError  = -32603
+)
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// handleMessage processes a single message or batch and returns the encoded
+// response, or nil if nothing needs to be sent back.
+func (s *MCPServer) handleMessage(ctx context.Context, msg []byte) []byte {
+	if len(msg) > 0 && msg[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(msg, &batch); err != nil || len(batch) == 0 {
+			return encodeRPC(rpcError(nil, jsonrpcParseError, "parse error"))
+		}
+		var out []*jsonrpcResponse
+		for _, m := range batch {
+			if resp := s.handleOne(ctx, m); resp != nil {
+				out = append(out, resp)
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return encodeRPC(out)
+	}
+	if resp := s.handleOne(ctx, msg); resp != nil {
+		return encodeRPC(resp)
+	}
+	return nil
+}
+
+func (s *MCPServer) handleOne(ctx context.Context, msg json.RawMessage) *jsonrpcResponse {
+	var req jsonrpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		return rpcError(nil, jsonrpcParseError, "parse error")
+	}
+	if req.Method == "" {
+		// A response to a server-initiated request; the bridge sends none.
+		return nil
+	}
+	if req.JSONRPC != "2.0" {
+		return rpcError(req.ID, jsonrpcInvalidRequest, "invalid request")
+	}
+
+	result, rpcErr := s.dispatch(ctx, req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+	if result == nil {
+		result = map[string]any{}
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *MCPServer) dispatch(ctx context.Context, method string, params json.RawMessage) (any, *jsonrpcError) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &p)
+		version := MCPProtocolVersion
+		if slices.Contains(mcpProtocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		result := map[string]any{
+			"protocolVersion": version,
+			"capabilities": map[string]any{
+				"tools":     map[string]any{"listChanged": false},
+				"resources": map[string]any{"listChanged": false, "subscribe": false},
+			},
+			"serverInfo": map[string]any{"name": s.Name, "version": s.Version},
+		}
+		if s.Instructions != "" {
+			result["instructions"] = s.Instructions
+		}
+		return result, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "tools/list":
+		tools := make([]mcpTool, 0, len(s.Tools))
+		for _, t := range s.Tools {
+			tools = append(tools, newMCPTool(t))
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "invalid params"}
+		}
+		return s.callTool(ctx, p.Name, p.Arguments)
+	case "resources/list":
+		resources := []map[string]any{}
+		for _, res := range s.Resources {
+			if !isURITemplate(res.Href) {
+				resources = append(resources, s.mcpResource("uri", res))
+			}
+		}
+		return map[string]any{"resources": resources}, nil
+	case "resources/templates/list":
+		templates := []map[string]any{}
+		for _, res := range s.Resources {
+			if isURITemplate(res.Href) {
+				templates = append(templates, s.mcpResource("uriTemplate", res))
+			}
+		}
+		return map[string]any{"resourceTemplates": templates}, nil
+	case "resources/read":
+		var p struct {
+			URI string `json:"uri"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "invalid params"}
+		}
+		return s.readResource(ctx, p.URI)
+	}
+	return nil, &jsonrpcError{Code: jsonrpcMethodNotFound, Message: "method not found: " + method}
+}
+
+// mcpTool is the MCP wire form of a Tool.
+type mcpTool struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	InputSchema *Schema            `json:"inputSchema"`
+	Annotations *mcpToolAnnotation `json:"annotations,omitempty"`
+}
+
+type mcpToolAnnotation struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+	IdempotentHint  *bool  `json:"idempotentHint,omitempty"`
+}
+
+// newMCPTool converts a Tool, deriving annotations from the action's safety
+// metadata and falling back to HTTP method semantics when it is absent.
+func newMCPTool(t Tool) mcpTool {
+	a := t.Action
+	var mutability Mutability
+	if a.Safety != nil {
+		mutability = a.Safety.Mutability
+	}
+	if mutability == "" && isSafeMethod(a.Method) {
+		mutability = ReadOnly
+	}
+
+	ann := &mcpToolAnnotation{Title: a.Method + " " + a.Href}
+	readOnly := mutability == ReadOnly
+	ann.ReadOnlyHint = &readOnly
+	if !readOnly {
+		destructive := mutability != Reversible
+		ann.DestructiveHint = &destructive
+		// An action that accepts an Idempotency-Key can be retried safely.
+		idempotent := isIdempotentMethod(a.Method) || a.Idempotent
+		ann.IdempotentHint = &idempotent
+	}
+	return mcpTool{
+		Name:        t.Name,
+		Description: t.Description,
+		InputSchema: t.Parameters,
+		Annotations: ann,
+	}
+}
+
+// isIdempotentMethod reports whether method is idempotent per RFC 9110 §9.2.2.
+func isIdempotentMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return isSafeMethod(method)
+}
+
+func (s *MCPServer) resourceBase() string {
+	if s.BaseURL != "" {
+		return strings.TrimSuffix(s.BaseURL, "/")
+	}
+	return defaultMCPResourceBase
+}
+
+func (s *MCPServer) mcpResource(uriKey string, res ResourceEntry) map[string]any {
+	name := res.Rel
+	if name == "" {
+		name = res.Href
+	}
+	out := map[string]any{
+		uriKey:     s.resourceBase() + res.Href,
+		"name":     name,
+		"mimeType": MediaType,
+	}
+	if res.Description != "" {
+		out["description"] = res.Description
+	}
+	return out
+}
+
+func (s *MCPServer) callTool(ctx context.Context, name string, args map[string]any) (any, *jsonrpcError) {
+	idx := slices.IndexFunc(s.Tools, func(t Tool) bool { return t.Name == name })
+	if idx < 0 {
+		return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "unknown tool: " + name}
+	}
+	a := s.Tools[idx].Action
+	for _, p := range s.Tools[idx].PathParams {
+		if _, ok := args[p]; !ok {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "missing required argument: " + p}
+		}
+	}
+
+	href, used := expandTemplate(a.Href, args)
+	rest := make(map[string]any)
+	for k, v := range args {
+		if !used[k] {
+			rest[k] = v
+		}
+	}
+
+	var body io.Reader
+	method := strings.ToUpper(a.Method)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		if len(rest) > 0 {
+			q := url.Values{}
+			for k, v := range rest {
+				q.Set(k, templateValue(v))
+			}
+			sep := "?"
+			if strings.Contains(href, "?") {
+				sep = "&"
+			}
+			href += sep + q.Encode()
+		}
+	default:
+		if len(rest) > 0 {
+			b, err := json.Marshal(rest)
+			if err != nil {
+				return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "invalid arguments"}
+			}
+			body = bytes.NewReader(b)
+		}
+	}
+
+	status, respBody, err := s.proxy(ctx, method, href, body)
+	if err != nil {
+		return mcpToolResult(fmt.Sprintf("request failed: %v", err), nil, true), nil
+	}
+	var structured map[string]any
+	json.Unmarshal(respBody, &structured)
+	return mcpToolResult(string(respBody), structured, status >= 400), nil
+}
+
+func mcpToolResult(text string, structured map[string]any, isError bool) map[string]any {
+	result := map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+	if structured != nil {
+		result["structuredContent"] = structured
+	}
+	return result
+}
+
+// readResource proxies a read of uri, which must name one of s.Resources or
+// match one of its templates.
+func (s *MCPServer) readResource(ctx context.Context, uri string) (any, *jsonrpcError) {
+	href, ok := strings.CutPrefix(uri, s.resourceBase())
+	if !ok || !strings.HasPrefix(href, "/") || !s.listsResource(href) {
+		return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "unknown resource: " + uri}
+	}
+	status, body, err := s.proxy(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("read failed: %v", err)}
+	}
+	if status >= 400 {
+		return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("read failed: %d %s", status, crawlErrorMessage(status, body))}
+	}
+	return map[string]any{
+		"contents": []map[string]any{{"uri": uri, "mimeType": MediaType, "text": string(body)}},
+	}, nil
+}
+
+// listsResource reports whether href is one of the listed resources or
+// matches a listed resource template.
+func (s *MCPServer) listsResource(href string) bool {
+	path, _, _ := strings.Cut(href, "?")
+	return slices.ContainsFunc(s.Resources, func(res ResourceEntry) bool {
+		return matchTemplate(res.Href, path)
+	})
+}
+
+// mcpCallerKey holds the HTTP transport caller's headers to forward.
+type mcpCallerKey struct{}
+
+// proxy sends a HAC-negotiated request for href to the in-process handler or
+// the remote API and returns the status and body.
+func (s *MCPServer) proxy(ctx context.Context, method, href string, body io.Reader) (int, []byte, error) {
+	target := href
+	if s.Handler == nil {
+		if s.BaseURL == "" {
+			return 0, nil, errors.New("no handler or base URL configured")
+		}
+		base, err := url.Parse(s.BaseURL)
+		if err != nil {
+			return 0, nil, err
+		}
+		u, err := base.Parse(href)
+		if err != nil {
+			return 0, nil, err
+		}
+		if u.Scheme != base.Scheme || u.Host != base.Host {
+			return 0, nil, fmt.Errorf("refusing cross-origin href %q", href)
+		}
+		target = u.String()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	if caller, ok := ctx.Value(mcpCallerKey{}).(http.Header); ok {
+		for name, vals := range caller {
+			req.Header[name] = vals
+		}
+	}
+	req.Header.Set("Accept", MediaType)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if s.Handler != nil {
+		rec := &responseRecorder{
+			header: make(http.Header),
+			body:   &bytes.Buffer{},
+			code:   http.StatusOK,
+		}
+		s.Handler.ServeHTTP(rec, req)
+		return rec.code, rec.body.Bytes(), nil
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+func rpcError(id json.RawMessage, code int, msg string) *jsonrpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &jsonrpcResponse{JSONRPC: "2.0", ID: id, Error: &jsonrpcError{Code: code, Message: msg}}
+}
+
+// encodeRPC marshals a response, reporting an internal error if the result
+// cannot be encoded (e.g. an unsupported Field default value).
+func encodeRPC(v any) []byte {
+	out, err := json.Marshal(v)
+	if err != nil {
+		out, _ = json.Marshal(rpcError(nil, jsonrpcInternalError, "internal error: "+err.Error()))
+	}
+	return out
+}
@@ -0,0 +1,398 @@
+package hac
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMCPTestServer returns a bridge over an in-process API and a log of the
+// requests the API received.
+func newMCPTestServer(t *testing.T) (*MCPServer, *[]string) {
+	t.Helper()
+
+	reg := NewRegistry()
+	reg.Route("GET", "GET /users").
+		Description("All users.").
+		Actions(Action{
+			Rel: "create", Method: "POST", Href: "/users",
+			Safety: &Safety{Mutability: Reversible, BlastRadius: Self},
+			Fields: []Field{{Name: "name", Type: "string", Required: true}},
+		}).
+		MustRegister()
+	reg.Route("GET", "GET /users/{id}").
+		Description("A user.").
+		Actions(Action{
+			Rel: "delete", Method: "DELETE", Href: "/users/{id}",
+			Safety: &Safety{Mutability: Irreversible, BlastRadius: SelfAndAssociated},
+		}).
+		MustRegister()
+	reg.Route("POST", "POST /users").Description("Create a user.").MustRegister()
+	reg.Route("DELETE", "DELETE /users/{id}").Description("Delete a user.").MustRegister()
+
+	var log []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		log = append(log, "GET /users")
+		w.Write([]byte(`[{"id":1}]`))
+	})
+	mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		log = append(log, "GET /users/"+r.PathValue("id"))
+		w.Write([]byte(`{"id":` + r.PathValue("id") + `}`))
+	})
+	mux.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		log = append(log, "POST /users "+string(body))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":2}`))
+	})
+	mux.HandleFunc("DELETE /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		log = append(log, "DELETE /users/"+r.PathValue("id"))
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"code":"active_subscriptions","message":"Cancel subscriptions first."}`))
+	})
+	h := Middleware(Options{Registry: reg, PathResolver: MuxPathResolver(mux)})(mux)
+
+	return NewMCPServer("Test API", "1.0", reg, h), &log
+}
+
+// mcpCall sends a JSON-RPC request over the HTTP transport and decodes the result.
+func mcpCall(t *testing.T, s *MCPServer, method string, params any) (map[string]any, *jsonrpcError) {
+	t.Helper()
+	msg, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	req := httptest.NewRequest("POST", "/mcp", bytes.NewReader(msg))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d", method, rec.Code)
+	}
+	var resp struct {
+		Result map[string]any `json:"result"`
+		Error  *jsonrpcError  `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: unmarshal: %v", method, err)
+	}
+	return resp.Result, resp.Error
+}
+
+func TestMCPInitialize(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+	result, rpcErr := mcpCall(t, s, "initialize", map[string]any{"protocolVersion": "2025-03-26"})
+	if rpcErr != nil {
+		t.Fatalf("error: %+v", rpcErr)
+	}
+	if result["protocolVersion"] != "2025-03-26" {
+		t.Errorf("protocolVersion = %v", result["protocolVersion"])
+	}
+	info := result["serverInfo"].(map[string]any)
+	if info["name"] != "Test API" {
+		t.Errorf("serverInfo = %v", info)
+	}
+
+	result, _ = mcpCall(t, s, "initialize", map[string]any{"protocolVersion": "1999-01-01"})
+	if result["protocolVersion"] != MCPProtocolVersion {
+		t.Errorf("unsupported version should fall back to %s, got %v", MCPProtocolVersion, result["protocolVersion"])
+	}
+}
+
+func TestMCPToolsList(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+	result, rpcErr := mcpCall(t, s, "tools/list", nil)
+	if rpcErr != nil {
+		t.Fatalf("error: %+v", rpcErr)
+	}
+
+	tools := make(map[string]map[string]any)
+	for _, raw := range result["tools"].([]any) {
+		tool := raw.(map[string]any)
+		tools[tool["name"].(string)] = tool
+	}
+
+	del, ok := tools["delete"]
+	if !ok {
+		t.Fatalf("missing delete tool in %v", tools)
+	}
+	ann := del["annotations"].(map[string]any)
+	if ann["readOnlyHint"] != false || ann["destructiveHint"] != true || ann["idempotentHint"] != true {
+		t.Errorf("delete annotations = %v", ann)
+	}
+	if _, ok := del["inputSchema"].(map[string]any)["properties"].(map[string]any)["id"]; !ok {
+		t.Errorf("delete inputSchema missing id: %v", del["inputSchema"])
+	}
+
+	create := tools["create"]["annotations"].(map[string]any)
+	if create["destructiveHint"] != false || create["idempotentHint"] != false {
+		t.Errorf("create annotations = %v", create)
+	}
+
+	get := tools["get-users"]["annotations"].(map[string]any)
+	if get["readOnlyHint"] != true {
+		t.Errorf("get-users annotations = %v", get)
+	}
+
+	keyed := newMCPTool(Tool{Action: Action{Method: "POST", Href: "/orders", Idempotent: true}}).Annotations
+	if keyed.IdempotentHint == nil || !*keyed.IdempotentHint {
+		t.Errorf("x-idempotent POST annotations = %+v", keyed)
+	}
+}
+
+func TestMCPToolsCall(t *testing.T) {
+	s, log := newMCPTestServer(t)
+
+	result, rpcErr := mcpCall(t, s, "tools/call", map[string]any{
+		"name":      "create",
+		"arguments": map[string]any{"name": "Bob"},
+	})
+	if rpcErr != nil {
+		t.Fatalf("error: %+v", rpcErr)
+	}
+	if result["isError"] != false {
+		t.Errorf("isError = %v: %v", result["isError"], result["content"])
+	}
+	structured := result["structuredContent"].(map[string]any)
+	if _, ok := structured["_hac"]; !ok {
+		t.Errorf("expected HAC envelope, got %v", structured)
+	}
+	if (*log)[0] != `POST /users {"name":"Bob"}` {
+		t.Errorf("proxied request = %q", (*log)[0])
+	}
+
+	result, _ = mcpCall(t, s, "tools/call", map[string]any{
+		"name":      "delete",
+		"arguments": map[string]any{"id": 7},
+	})
+	if result["isError"] != true {
+		t.Errorf("409 should be reported as isError")
+	}
+	text := result["content"].([]any)[0].(map[string]any)["text"].(string)
+	if !strings.Contains(text, "active_subscriptions") {
+		t.Errorf("error text = %q", text)
+	}
+	if (*log)[1] != "DELETE /users/7" {
+		t.Errorf("proxied request = %q", (*log)[1])
+	}
+
+	if _, rpcErr := mcpCall(t, s, "tools/call", map[string]any{"name": "delete", "arguments": map[string]any{}}); rpcErr == nil {
+		t.Error("expected error for missing path argument")
+	}
+	if _, rpcErr := mcpCall(t, s, "tools/call", map[string]any{"name": "nope"}); rpcErr == nil {
+		t.Error("expected error for unknown tool")
+	}
+}
+
+func TestMCPResources(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+
+	result, _ := mcpCall(t, s, "resources/list", nil)
+	resources := result["resources"].([]any)
+	if len(resources) != 1 || resources[0].(map[string]any)["uri"] != "hac://api/users" {
+		t.Errorf("resources = %v", resources)
+	}
+
+	result, _ = mcpCall(t, s, "resources/templates/list", nil)
+	templates := result["resourceTemplates"].([]any)
+	if len(templates) != 1 || templates[0].(map[string]any)["uriTemplate"] != "hac://api/users/{id}" {
+		t.Errorf("templates = %v", templates)
+	}
+
+	result, rpcErr := mcpCall(t, s, "resources/read", map[string]any{"uri": "hac://api/users/3"})
+	if rpcErr != nil {
+		t.Fatalf("error: %+v", rpcErr)
+	}
+	content := result["contents"].([]any)[0].(map[string]any)
+	if content["mimeType"] != MediaType || !strings.Contains(content["text"].(string), `"data":{"id":3}`) {
+		t.Errorf("content = %v", content)
+	}
+
+	if _, rpcErr := mcpCall(t, s, "resources/read", map[string]any{"uri": "https://evil.example/x"}); rpcErr == nil {
+		t.Error("expected error for foreign URI")
+	}
+	if _, rpcErr := mcpCall(t, s, "resources/read", map[string]any{"uri": "hac://api/admin/secrets"}); rpcErr == nil {
+		t.Error("expected error for unlisted resource")
+	}
+}
+
+func TestMCPForwardsCallerHeaders(t *testing.T) {
+	var got http.Header
+	s := &MCPServer{
+		Resources: []ResourceEntry{{Href: "/me"}},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header.Clone()
+			w.Write([]byte(`{}`))
+		}),
+	}
+	msg := `{"jsonrpc":"2.0","id":1,"method":"resources/read","params":{"uri":"hac://api/me"}}`
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(msg))
+	req.Header.Set("Authorization", "Bearer agent-token")
+	req.Header.Set("X-Unrelated", "1")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Get("Authorization") != "Bearer agent-token" {
+		t.Errorf("Authorization = %q, want it forwarded", got.Get("Authorization"))
+	}
+	if got.Get("X-Unrelated") != "" {
+		t.Error("X-Unrelated forwarded, want only the listed headers")
+	}
+	if got.Get("Accept") != MediaType {
+		t.Errorf("Accept = %q", got.Get("Accept"))
+	}
+}
+
+func TestMCPUnknownMethod(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+	_, rpcErr := mcpCall(t, s, "sampling/createMessage", nil)
+	if rpcErr == nil || rpcErr.Code != jsonrpcMethodNotFound {
+		t.Errorf("error = %+v, want method not found", rpcErr)
+	}
+}
+
+func TestMCPHTTPTransport(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+
+	req := httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("notification status = %d, want 202", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/mcp", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want 405", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Origin", "https://evil.example")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("foreign origin status = %d, want 403", rec.Code)
+	}
+
+	big := &MCPServer{MaxMessageBytes: 16}
+	req = httptest.NewRequest("POST", "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	rec = httptest.NewRecorder()
+	big.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized message status = %d, want 413", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/mcp", strings.NewReader(`not json`))
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"code":-32700`) {
+		t.Errorf("parse error body = %s", rec.Body.String())
+	}
+}
+
+func TestMCPStdioTransport(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+
+	in := strings.NewReader(strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`[{"jsonrpc":"2.0","id":2,"method":"ping"},{"jsonrpc":"2.0","id":3,"method":"tools/list"}]`,
+	}, "\n"))
+	var out bytes.Buffer
+	if err := s.ServeStdio(context.Background(), in, &out); err != nil {
+		t.Fatalf("ServeStdio: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d response lines, want 2:\n%s", len(lines), out.String())
+	}
+	var batch []jsonrpcResponse
+	if err := json.Unmarshal([]byte(lines[1]), &batch); err != nil || len(batch) != 2 {
+		t.Errorf("batch response = %s", lines[1])
+	}
+}
+
+func TestMCPStdioCancel(t *testing.T) {
+	s, _ := newMCPTestServer(t)
+	in, w := io.Pipe()
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.ServeStdio(ctx, in, io.Discard) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("ServeStdio = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio did not return after cancellation")
+	}
+}
+
+func TestMCPStdioCancelDuringCall(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users").Actions(Action{Rel: "create", Method: "POST", Href: "/users"}).MustRegister()
+	started, release := make(chan struct{}), make(chan struct{})
+	s := NewMCPServer("Test API", "1.0", reg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	in, w := io.Pipe()
+	defer w.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.ServeStdio(ctx, in, io.Discard) }()
+	go w.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"create","arguments":{}}}` + "\n"))
+
+	<-started
+	cancel()
+	close(release)
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("ServeStdio = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeStdio did not return after cancellation during a call")
+	}
+}
+
+func TestRemoteMCPServer(t *testing.T) {
+	srv, _ := newCrawlTestServer(t)
+
+	s, err := NewRemoteMCPServer(context.Background(), &Crawler{BaseURL: srv.URL, Client: srv.Client()})
+	if err != nil {
+		t.Fatalf("NewRemoteMCPServer: %v", err)
+	}
+	if s.Name != "Test API" {
+		t.Errorf("name = %q", s.Name)
+	}
+
+	names := make(map[string]bool)
+	for _, tool := range s.Tools {
+		names[tool.Name] = true
+	}
+	for _, want := range []string{"create", "search", "delete", "purge"} {
+		if !names[want] {
+			t.Errorf("missing tool %q in %v", want, names)
+		}
+	}
+
+	result, rpcErr := mcpCall(t, s, "resources/read", map[string]any{"uri": srv.URL + "/users/1"})
+	if rpcErr != nil {
+		t.Fatalf("read: %+v", rpcErr)
+	}
+	content := result["contents"].([]any)[0].(map[string]any)
+	if !strings.Contains(content["text"].(string), `"description":"A user."`) {
+		t.Errorf("content = %v", content)
+	}
+}
@@ -0,0 +1,261 @@
+package hac
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics receives instrumentation from Middleware. Implementations must be
+// safe for concurrent use; adapters map the calls onto a metrics system.
+type Metrics interface {
+	// Inc adds one to the counter name with the given labels.
+	Inc(name string, labels map[string]string)
+
+	// Observe records value in the histogram name with the given labels.
+	Observe(name string, labels map[string]string, value float64)
+}
+
+// Metric names reported by Middleware.
+const (
+	// MetricRequests counts requests by "outcome" and "route".
+	MetricRequests = "hac_requests_total"
+
+	// MetricEnvelopeBytes observes the size of written envelopes by
+	// "route" and "status_class".
+	MetricEnvelopeBytes = "hac_envelope_bytes"
+
+	// MetricWrapSeconds observes the time spent building and encoding
+	// envelopes, after the handler returns, by "route" and "status_class".
+	MetricWrapSeconds = "hac_wrap_seconds"
+)
+
+// Negotiation outcomes, reported in the "outcome" label of MetricRequests.
+const (
+	// OutcomeNotRequested: the client did not ask for HAC.
+	OutcomeNotRequested = "not_requested"
+
+	// OutcomeWrapped: the response was wrapped in a HAC envelope.
+	OutcomeWrapped = "wrapped"
+
+	// OutcomeUnregistered: HAC was asked for on a route with no metadata and
+	// the response passed through unwrapped.
+	OutcomeUnregistered = "unregistered"
+
+	// OutcomeNotAcceptable: HAC was the only acceptable type on a route with
+	// no metadata, and the request got a 406.
+	OutcomeNotAcceptable = "not_acceptable"
+
+	// OutcomeRejected: the middleware answered with a HAC error before the
+	// handler ran, such as an unconfirmed or unsupported dry-run request.
+	OutcomeRejected = "rejected"
+
+	// OutcomeEmpty: the handler answered with a status that has no body,
+	// 204 or 304, which was passed through unwrapped.
+	OutcomeEmpty = "empty"
+)
+
+// countRequest reports a request's negotiation outcome to m, if set. Only
+// registered route patterns are used as labels, to bound cardinality.
+func countRequest(m Metrics, outcome string, cfg *RouteConfig, pattern string) {
+	if m == nil {
+		return
+	}
+	if cfg == nil {
+		pattern = ""
+	}
+	m.Inc(MetricRequests, map[string]string{"outcome": outcome, "route": pattern})
+}
+
+// statusClass returns "2xx", "4xx" and so on.
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// Default histogram buckets used by ExpvarMetrics.
+var (
+	DefaultSizeBuckets    = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576}
+	DefaultLatencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.1}
+)
+
+// ExpvarMetrics is a Metrics implementation with no external dependencies.
+// It keeps counters and histograms in memory, exposes them as an expvar
+// variable, and serves them in the Prometheus text exposition format.
+type ExpvarMetrics struct {
+	// Buckets sets the histogram upper bounds per metric name. Metrics
+	// without an entry use DefaultSizeBuckets if their name ends in
+	// "_bytes" and DefaultLatencyBuckets otherwise.
+	Buckets map[string][]float64
+
+	mu         sync.Mutex
+	counters   map[string]*counterSeries
+	histograms map[string]*histogramSeries
+}
+
+type counterSeries struct {
+	name   string
+	labels string
+	value  uint64
+}
+
+type histogramSeries struct {
+	name   string
+	labels string
+	bounds []float64
+	counts []uint64 // per bound, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewExpvarMetrics creates an ExpvarMetrics. If name is not empty the
+// metrics are published under it with expvar.Publish, which panics if the
+// name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		counters:   make(map[string]*counterSeries),
+		histograms: make(map[string]*histogramSeries),
+	}
+	if name != "" {
+		expvar.Publish(name, m)
+	}
+	return m
+}
+
+// Inc implements Metrics.
+func (m *ExpvarMetrics) Inc(name string, labels map[string]string) {
+	ls := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.counters[name+ls]
+	if !ok {
+		c = &counterSeries{name: name, labels: ls}
+		m.counters[name+ls] = c
+	}
+	c.value++
+}
+
+// Observe implements Metrics.
+func (m *ExpvarMetrics) Observe(name string, labels map[string]string, value float64) {
+	ls := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.histograms[name+ls]
+	if !ok {
+		bounds, ok := m.Buckets[name]
+		if !ok {
+			bounds = DefaultLatencyBuckets
+			if strings.HasSuffix(name, "_bytes") {
+				bounds = DefaultSizeBuckets
+			}
+		}
+		h = &histogramSeries{name: name, labels: ls, bounds: bounds, counts: make([]uint64, len(bounds))}
+		m.histograms[name+ls] = h
+	}
+	h.count++
+	h.sum += value
+	if i, _ := slices.BinarySearch(h.bounds, value); i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
+
+// String implements expvar.Var. Counters are reported as numbers and
+// histograms as objects with count, sum and cumulative buckets, keyed by
+// series in exposition syntax, such as `hac_requests_total{outcome="wrapped"}`.
+func (m *ExpvarMetrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]any, len(m.counters)+len(m.histograms))
+	for k, c := range m.counters {
+		out[k] = c.value
+	}
+	for k, h := range m.histograms {
+		buckets := make(map[string]uint64, len(h.bounds))
+		var cum uint64
+		for i, b := range h.bounds {
+			cum += h.counts[i]
+			buckets[formatFloat(b)] = cum
+		}
+		out[k] = map[string]any{"count": h.count, "sum": h.sum, "buckets": buckets}
+	}
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (m *ExpvarMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(m.exposition()))
+	})
+}
+
+func (m *ExpvarMetrics) exposition() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+
+	typed := make(map[string]bool)
+	for _, k := range sortedKeys(m.counters) {
+		c := m.counters[k]
+		if !typed[c.name] {
+			fmt.Fprintf(&b, "# TYPE %s counter\n", c.name)
+			typed[c.name] = true
+		}
+		fmt.Fprintf(&b, "%s%s %d\n", c.name, c.labels, c.value)
+	}
+	for _, k := range sortedKeys(m.histograms) {
+		h := m.histograms[k]
+		if !typed[h.name] {
+			fmt.Fprintf(&b, "# TYPE %s histogram\n", h.name)
+			typed[h.name] = true
+		}
+		var cum uint64
+		for i, bound := range h.bounds {
+			cum += h.counts[i]
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, withLabel(h.labels, "le", formatFloat(bound)), cum)
+		}
+		fmt.Fprintf(&b, "%s_bucket%s %d\n", h.name, withLabel(h.labels, "le", "+Inf"), h.count)
+		fmt.Fprintf(&b, "%s_sum%s %s\n", h.name, h.labels, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count%s %d\n", h.name, h.labels, h.count)
+	}
+	return b.String()
+}
+
+// formatLabels renders labels in exposition syntax, sorted by name.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, k := range sortedKeys(labels) {
+		parts = append(parts, k+"="+quoteLabel(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// withLabel adds one label to a rendered label set.
+func withLabel(labels, name, value string) string {
+	l := name + "=" + quoteLabel(value)
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
+
+// labelEscaper escapes a label value as the exposition format requires:
+// backslash, double quote and newline only.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel renders a label value in double quotes.
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,106 @@
+package hac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareMetrics(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("GET /users").Description("List of users.").MustRegister()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"id":1}]`))
+	})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`ok`))
+	})
+	m := NewExpvarMetrics("")
+	h := Middleware(Options{Registry: reg, PathResolver: MuxPathResolver(mux), Metrics: m})(mux)
+
+	get := func(path, accept string) {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	get("/users", MediaType)
+	get("/users", MediaType)
+	get("/users", "")
+	get("/health", MediaType)
+	get("/health", MediaType+", application/json")
+
+	text := m.exposition()
+	for _, want := range []string{
+		`hac_requests_total{outcome="wrapped",route="GET /users"} 2`,
+		`hac_requests_total{outcome="not_requested",route="GET /users"} 1`,
+		`hac_requests_total{outcome="not_acceptable",route=""} 1`,
+		`hac_requests_total{outcome="unregistered",route=""} 1`,
+		`hac_envelope_bytes_count{route="GET /users",status_class="2xx"} 2`,
+		`hac_envelope_bytes_bucket{route="GET /users",status_class="2xx",le="256"} 2`,
+		`hac_wrap_seconds_count{route="GET /users",status_class="2xx"} 2`,
+		"# TYPE hac_requests_total counter",
+		"# TYPE hac_wrap_seconds histogram",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("exposition missing %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	m := NewExpvarMetrics("")
+	m.Buckets = map[string][]float64{"size": {10, 100}}
+	m.Inc("hits", map[string]string{"b": "2", "a": "1"})
+	m.Inc("hits", map[string]string{"a": "1", "b": "2"})
+	for _, v := range []float64{5, 50, 500} {
+		m.Observe("size", nil, v)
+	}
+
+	var vars map[string]any
+	if err := json.Unmarshal([]byte(m.String()), &vars); err != nil {
+		t.Fatalf("String() is not JSON: %v", err)
+	}
+	if vars[`hits{a="1",b="2"}`] != float64(2) {
+		t.Errorf("vars = %v", vars)
+	}
+	size := vars["size"].(map[string]any)
+	if size["count"] != float64(3) || size["sum"] != float64(555) ||
+		size["buckets"].(map[string]any)["100"] != float64(2) {
+		t.Errorf("size = %v", size)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := `# TYPE hits counter
+hits{a="1",b="2"} 2
+# TYPE size histogram
+size_bucket{le="10"} 1
+size_bucket{le="100"} 2
+size_bucket{le="+Inf"} 3
+size_sum 555
+size_count 3
+`
+	if rec.Body.String() != want {
+		t.Errorf("exposition = %q, want %q", rec.Body, want)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	got := formatLabels(map[string]string{"route": "GET /café/\"x\"\\\n"})
+	want := `{route="GET /café/\"x\"\\\n"}`
+	if got != want {
+		t.Errorf("formatLabels = %s, want %s", got, want)
+	}
+	if got := withLabel(want, "le", "+Inf"); got != `{route="GET /café/\"x\"\\\n",le="+Inf"}` {
+		t.Errorf("withLabel = %s", got)
+	}
+}
@@ -3,7 +3,10 @@ package hac
 import (
 	"bytes"
 	"encoding/json"
+	"log/slog"
+	"maps"
 	"net/http"
+	"time"
 )
 
 // Options configures the HAC middleware.
@@ -11,12 +14,86 @@ type Options struct {
 	// Registry contains HAC metadata for routes.
 	Registry *Registry
 
+	// Source, if set, supplies the registry per request and takes precedence
+	// over Registry. Use a Reloader to change metadata without a restart.
+	Source RegistrySource
+
 	// PathResolver extracts the route pattern from a request.
 	// Defaults to using r.URL.Path if nil.
 	PathResolver PathResolver
 
 	// ErrorMapper optionally customizes error-to-HACError conversion.
 	ErrorMapper ErrorMapper
+
+	// ConfirmationKey enables server-side enforcement of
+	// confirmation_recommended. When set, every request for an action
+	// flagged for confirmation, whatever its Accept header, must carry a
+	// valid token in the HAC-Confirmation header; otherwise it is rejected
+	// with a 428 error whose recovery action carries a fresh token. Tokens
+	// are HMAC-SHA256 signed with this key and bound to the method, URI,
+	// body and caller.
+	//
+	// A token confirms one request: the middleware rejects it once it has
+	// been accepted, unless that request failed with a 5xx status. Retries
+	// of an Idempotent action may reuse the token with the same
+	// Idempotency-Key, so that the Idempotency middleware can replay the
+	// stored response. Spent tokens are remembered in memory until they
+	// expire, so when several processes share the key, a token may be
+	// accepted once by each of them within its TTL.
+	ConfirmationKey []byte
+
+	// ConfirmationTTL is how long confirmation tokens remain valid.
+	// Defaults to DefaultConfirmationTTL.
+	ConfirmationTTL time.Duration
+
+	// ConfirmationMaxBody caps the request body read to bind a confirmation
+	// token. Larger bodies of flagged actions are rejected with 413.
+	// Defaults to DefaultMaxConfirmationBody.
+	ConfirmationMaxBody int64
+
+	// Caller identifies the caller of a request. Confirmation tokens are
+	// bound to it. Defaults to treating every caller as anonymous.
+	Caller CallerFunc
+
+	// Audit receives one record per HAC request, describing the caller,
+	// the invoked action and its safety metadata, and the outcome. Use
+	// SlogAuditSink to write records through log/slog. Nil disables
+	// auditing.
+	Audit AuditSink
+
+	// AuditRedact optionally rewrites records before they reach Audit, for
+	// example RedactAudit("caller", "query").
+	AuditRedact func(AuditRecord) AuditRecord
+
+	// Metrics receives request counts by negotiation outcome and envelope
+	// size and wrap latency histograms. See NewExpvarMetrics. Nil disables
+	// instrumentation.
+	Metrics Metrics
+
+	// Tracer starts spans around the handler (SpanHandler) and envelope
+	// construction (SpanEnvelope). Nil disables spans.
+	Tracer Tracer
+
+	// ExposeTraceID adds the request's trace ID to envelopes as x-trace-id,
+	// in _hac and in errors, including the errors the middleware and the
+	// middlewares inside it write themselves, such as confirmation_required
+	// or rate_limited. The ID comes from the traceparent header, or a new
+	// trace is started when it is missing.
+	ExposeTraceID bool
+
+	// InferSafety fills in missing action safety metadata from HTTP method
+	// semantics and marks it with x-inferred-safety; see
+	// Registry.InferSafety. It is applied to Registry when the middleware is
+	// created and covers routes registered later too. A Reloader in Source
+	// infers on every snapshot it loads (see Reloader.InferSafety), so the
+	// middlewares sharing it see the inferred metadata as well. A frozen
+	// Registry, or the snapshots of any other Source, are inferred on a copy
+	// that only this middleware uses.
+	InferSafety bool
+
+	// Validation checks every outgoing envelope against the spec schemas.
+	// It is meant for development and tests; defaults to ValidateOff.
+	Validation ValidationMode
 }
 
 // Middleware returns an http.Handler middleware that wraps responses in HAC
@@ -30,34 +107,108 @@ func Middleware(opts Options) func(http.Handler) http.Handler {
 	if opts.Registry == nil {
 		opts.Registry = NewRegistry()
 	}
+	if opts.InferSafety {
+		switch src := opts.Source.(type) {
+		case nil:
+			if err := opts.Registry.InferSafety(); err != nil {
+				opts.Registry = inferredCopy(opts.Registry) // frozen
+			}
+		case *Reloader:
+			src.InferSafety()
+		default:
+			opts.Source = &inferringSource{src: src}
+		}
+	}
+
+	spent := &spentTokens{}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			opts := opts
+			opts.Registry = currentRegistry(opts.Source, opts.Registry)
 			accept := r.Header.Get("Accept")
 
+			// Resolve route and look up config
+			pattern := opts.PathResolver(r)
+			cfg := opts.Registry.Lookup(r.Method, pattern)
+
+			dryRun := !isSafeMethod(r.Method) && wantsDryRun(r)
+			r, tc := requestTraceContext(r, opts.Tracer != nil || opts.ExposeTraceID)
+			if opts.ExposeTraceID {
+				r = r.WithContext(withExposedTraceID(r.Context()))
+			}
+
 			if !wantsHAC(accept) {
-				next.ServeHTTP(w, r)
+				// Dry runs and confirmation protect plain clients too. Routes
+				// without HAC metadata are left alone: they may read dry_run
+				// themselves.
+				if cfg == nil {
+					dryRun = false
+				}
+				if dryRun && !cfg.DryRun {
+					countRequest(opts.Metrics, OutcomeRejected, cfg, pattern)
+					dryRunUnsupported(w, r)
+					return
+				}
+				confirmed, settle := enforceConfirmation(w, r, dryRun, opts, spent)
+				if confirmed == nil {
+					countRequest(opts.Metrics, OutcomeRejected, cfg, pattern)
+					return
+				}
+				if cfg != nil && cfg.DryRun {
+					w.Header().Add("Vary", "Prefer")
+				}
+				if dryRun {
+					confirmed = confirmed.WithContext(withDryRun(confirmed.Context()))
+					w.Header().Set("Preference-Applied", DryRunPreference)
+				}
+				countRequest(opts.Metrics, OutcomeNotRequested, cfg, pattern)
+				serveSettled(next, w, confirmed, settle)
 				return
 			}
 
-			// Resolve route and look up config
-			pattern := opts.PathResolver(r)
-			cfg := opts.Registry.Lookup(r.Method, pattern)
+			if opts.Audit != nil {
+				start := time.Now()
+				sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+				w = sw
+				defer func() {
+					auditRequest(opts, r, pattern, sw.code, dryRun, start)
+				}()
+			}
+
+			// A dry run never reaches a handler that would not honor it.
+			if dryRun && (cfg == nil || !cfg.DryRun) {
+				countRequest(opts.Metrics, OutcomeRejected, cfg, pattern)
+				dryRunUnsupported(w, r)
+				return
+			}
+
+			confirmed, settle := enforceConfirmation(w, r, dryRun, opts, spent)
+			if confirmed == nil {
+				countRequest(opts.Metrics, OutcomeRejected, cfg, pattern)
+				return
+			}
+			r = confirmed
 
 			if cfg == nil {
 				// No HAC config for this route
 				if hacIsOnlyAcceptable(accept) {
 					// Client only accepts HAC, but we can't provide it
+					countRequest(opts.Metrics, OutcomeNotAcceptable, cfg, pattern)
 					http.Error(w, "Not Acceptable: no HAC metadata for this route", http.StatusNotAcceptable)
 					return
 				}
 				// Other types acceptable, passthrough
-				next.ServeHTTP(w, r)
+				countRequest(opts.Metrics, OutcomeUnregistered, cfg, pattern)
+				serveSettled(next, w, r, settle)
 				return
 			}
 
 			// Set HAC-requested flag in context
 			r = r.WithContext(withHACRequested(r.Context()))
+			if dryRun {
+				r = r.WithContext(withDryRun(r.Context()))
+			}
 
 			// Capture the response
 			rec := &responseRecorder{
@@ -65,28 +216,84 @@ func Middleware(opts Options) func(http.Handler) http.Handler {
 				body:   &bytes.Buffer{},
 				code:   http.StatusOK,
 			}
-			next.ServeHTTP(rec, r)
+			ctx, span := startSpan(opts.Tracer, r.Context(), SpanHandler)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			settle(rec.code)
+			span.SetAttribute("http.route", pattern)
+			span.SetAttribute("http.response.status_code", rec.code)
+			span.End()
+
+			if rec.code == http.StatusNoContent || rec.code == http.StatusNotModified {
+				// These responses have no body, so there is nothing to wrap.
+				countRequest(opts.Metrics, OutcomeEmpty, cfg, pattern)
+				maps.Copy(w.Header(), rec.header)
+				w.Header().Set("Vary", "Accept")
+				if cfg.DryRun {
+					w.Header().Add("Vary", "Prefer")
+				}
+				if dryRun {
+					w.Header().Set("Preference-Applied", DryRunPreference)
+				}
+				w.WriteHeader(rec.code)
+				return
+			}
+
+			wrapStart := time.Now()
+			_, span = startSpan(opts.Tracer, r.Context(), SpanEnvelope)
 
 			// Build envelope
 			var envelope any
 			var err error
 			if rec.code >= 400 {
-				envelope, err = buildErrorEnvelope(rec.code, rec.body.Bytes(), r, opts.ErrorMapper)
+				var env *ErrorEnvelope
+				env, err = buildErrorEnvelope(rec.code, rec.body.Bytes(), r, opts.ErrorMapper)
+				if env != nil {
+					env.Error = completeError(opts.Registry, rec.code, env.Error)
+					if opts.ExposeTraceID {
+						withID := *env.Error // the mapper may return a shared error
+						withID.TraceID = tc.TraceID
+						env.Error = &withID
+					}
+				}
+				envelope = env
 			} else {
-				envelope, err = buildSuccessEnvelope(rec.body.Bytes(), cfg)
+				var env *SuccessEnvelope
+				env, err = buildSuccessEnvelope(rec.body.Bytes(), cfg)
+				if env != nil {
+					env.HAC.Simulated = dryRun
+					if opts.ExposeTraceID {
+						env.HAC.TraceID = tc.TraceID
+					}
+				}
+				envelope = env
 			}
 
 			if err != nil {
+				span.End()
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
 			out, err := json.Marshal(envelope)
 			if err != nil {
+				span.End()
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
+			code := rec.code
+			if opts.Validation != ValidateOff {
+				out, code = validateEnvelope(opts.Validation, r, out, code)
+			}
+			span.SetAttribute("hac.envelope.bytes", len(out))
+			span.End()
+			if opts.Metrics != nil {
+				countRequest(opts.Metrics, OutcomeWrapped, cfg, pattern)
+				labels := map[string]string{"route": pattern, "status_class": statusClass(code)}
+				opts.Metrics.Observe(MetricEnvelopeBytes, labels, float64(len(out)))
+				opts.Metrics.Observe(MetricWrapSeconds, labels, time.Since(wrapStart).Seconds())
+			}
+
 			// Copy headers from recorded response, then override content type
 			for k, vs := range rec.header {
 				for _, v := range vs {
@@ -95,15 +302,66 @@ func Middleware(opts Options) func(http.Handler) http.Handler {
 			}
 			w.Header().Set("Content-Type", MediaType)
 			w.Header().Set("Vary", "Accept")
-
-			if rec.code >= 400 {
-				w.WriteHeader(rec.code)
+			if cfg.DryRun {
+				w.Header().Add("Vary", "Prefer")
+			}
+			if dryRun {
+				w.Header().Set("Preference-Applied", DryRunPreference)
 			}
+
+			w.WriteHeader(code)
 			w.Write(out)
 		})
 	}
 }
 
+// enforceConfirmation enforces confirmation when opts.ConfirmationKey is set and r
+// invokes an action flagged for it. It returns r, possibly marked confirmed,
+// or nil after rejecting the request. Dry runs change nothing and need no
+// confirmation. The returned settle func must be called with the response
+// status, so that a token spent on a failed request can be used again.
+func enforceConfirmation(w http.ResponseWriter, r *http.Request, dryRun bool, opts Options, spent *spentTokens) (*http.Request, func(status int)) {
+	noop := func(int) {}
+	if len(opts.ConfirmationKey) == 0 || dryRun {
+		return r, noop
+	}
+	a, ok := opts.Registry.MatchAction(r.Method, r.URL.Path)
+	if !ok || a.Safety == nil || !a.Safety.ConfirmationRecommended {
+		return r, noop
+	}
+	return requireConfirmation(w, r, a, opts, spent)
+}
+
+// serveSettled serves r with next and passes the response status to settle.
+func serveSettled(next http.Handler, w http.ResponseWriter, r *http.Request, settle func(status int)) {
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	next.ServeHTTP(sw, r)
+	settle(sw.code)
+}
+
+// validateEnvelope checks an outgoing envelope against the spec schemas. In
+// ValidateLog mode violations are logged and the envelope is returned as is;
+// in ValidateFail mode it is replaced with an invalid_envelope error.
+func validateEnvelope(mode ValidationMode, r *http.Request, out []byte, code int) ([]byte, int) {
+	err := Validate(out)
+	if err == nil {
+		return out, code
+	}
+	if mode == ValidateLog {
+		slog.Warn("hac: envelope does not conform to the spec schema",
+			"method", r.Method, "path", r.URL.Path, "error", err)
+		return out, code
+	}
+	replaced, merr := json.Marshal(&ErrorEnvelope{Error: &HACError{
+		Code:    "invalid_envelope",
+		Message: err.Error(),
+	}})
+	if merr != nil {
+		return out, code
+	}
+	return replaced, http.StatusInternalServerError
+}
+
 // responseRecorder captures the status code, headers, and body written by a handler.
 type responseRecorder struct {
 	header http.Header
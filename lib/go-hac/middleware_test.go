@@ -1,10 +1,13 @@
 package hac
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -254,3 +257,56 @@ func TestMiddlewareCustomErrorMapper(t *testing.T) {
 
 // Ensure no body is leaked to the variable to keep the linter happy
 var _ io.Writer = httptest.NewRecorder()
+
+func TestMiddlewareValidation(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1}`))
+	})
+	reg := NewRegistry()
+	reg.Route("GET", "/users/1").
+		Actions(Action{Rel: "fetch", Method: "GET", Href: "/users/1"}).
+		MustRegister()
+	// Register rejects unknown methods, so break the config in place.
+	reg.Lookup("GET", "/users/1").Actions[0].Method = "FETCH"
+	reg.Route("GET", "/users/2").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/2"}).
+		Register()
+
+	serve := func(mode ValidationMode, path string) *httptest.ResponseRecorder {
+		mw := Middleware(Options{Registry: reg, Validation: mode})(handler)
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", MediaType)
+		rec := httptest.NewRecorder()
+		mw.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(ValidateFail, "/users/2"); rec.Code != http.StatusOK {
+		t.Errorf("valid envelope: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec := serve(ValidateFail, "/users/1")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("fail mode: status = %d, want 500", rec.Code)
+	}
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if env.Error.Code != "invalid_envelope" || !strings.Contains(env.Error.Message, "/_hac/actions/0/method") {
+		t.Errorf("error = %+v", env.Error)
+	}
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	rec = serve(ValidateLog, "/users/1")
+	if rec.Code != http.StatusOK {
+		t.Errorf("log mode: status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(logs.String(), "/_hac/actions/0/method") {
+		t.Errorf("log output = %q", logs.String())
+	}
+}
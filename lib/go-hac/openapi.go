@@ -0,0 +1,762 @@
+package hac
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// OpenAPIImportOptions configures ImportOpenAPI.
+type OpenAPIImportOptions struct {
+	// MethodPatterns registers routes under ServeMux-style patterns such as
+	// "GET /users/{id}", as resolved by StdlibPathResolver. By default routes
+	// are registered under the bare OpenAPI path.
+	MethodPatterns bool
+}
+
+// OpenAPIReport describes the outcome of ImportOpenAPI.
+type OpenAPIReport struct {
+	// Imported lists the registered routes as "METHOD /path".
+	Imported []string
+
+	// Unmapped lists the operations that were not registered and why.
+	Unmapped []UnmappedOperation
+}
+
+// UnmappedOperation is an OpenAPI operation that ImportOpenAPI skipped.
+type UnmappedOperation struct {
+	Method      string
+	Path        string
+	OperationID string
+	Reason      string
+}
+
+// openAPIMethods lists the OpenAPI path item operations in import order.
+var openAPIMethods = []string{"get", "head", "options", "post", "put", "patch", "delete", "trace"}
+
+// ImportOpenAPI reads an OpenAPI 3.0 or 3.1 JSON document and registers HAC
+// metadata for its operations in reg, following the defaults of spec §12.2:
+// GET is read_only, DELETE is irreversible and PUT/PATCH are reversible.
+// Fields come from the JSON request body schema, or from query parameters for
+// GET, HEAD and DELETE. A route advertises the other operations on its path,
+// plus the state-changing operations on its static sub-paths, as actions.
+//
+// Operations may refine the defaults with vendor extensions:
+//
+//	x-hac-description    string, replaces summary/description
+//	x-hac-rel            string, the action rel (defaults to operationId)
+//	x-hac-safety         Safety object, overlaid on the method defaults
+//	x-hac-cost           Cost object
+//	x-hac-preconditions  array of strings
+//	x-hac-related        array of RelatedResource objects
+//	x-hac-actions        array of Action objects, replaces the derived actions
+//	x-hac-ignore         true to skip the operation
+//
+// Operations that cannot be mapped, or whose route is already registered, are
+// skipped and listed in the report. An error is returned only when the
+// document itself cannot be read.
+func ImportOpenAPI(reg *Registry, r io.Reader, opts OpenAPIImportOptions) (*OpenAPIReport, error) {
+	var doc map[string]any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("hac: decoding OpenAPI document: %w", err)
+	}
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("hac: unsupported OpenAPI version %q", version)
+	}
+	paths, _ := doc["paths"].(map[string]any)
+
+	type mapped struct {
+		method  string
+		opID    string
+		action  Action
+		related []RelatedResource
+		actions []Action
+		tags    []string
+	}
+	report := &OpenAPIReport{}
+	byPath := make(map[string][]mapped)
+	for _, path := range sortedKeys(paths) {
+		item, ok := resolveRef(doc, paths[path])
+		if !ok {
+			report.unmapped("", path, "", "unresolvable path item $ref")
+			continue
+		}
+		for _, m := range openAPIMethods {
+			op, ok := item[m].(map[string]any)
+			if !ok {
+				continue
+			}
+			method := strings.ToUpper(m)
+			opID, _ := op["operationId"].(string)
+			if ignore, _ := op["x-hac-ignore"].(bool); ignore {
+				report.unmapped(method, path, opID, "x-hac-ignore is set")
+				continue
+			}
+			a, err := openAPIAction(doc, item, op, method, path)
+			var related []RelatedResource
+			var actions []Action
+			if err == nil {
+				err = decodeExtension(op, "x-hac-related", &related)
+			}
+			if err == nil {
+				err = decodeExtension(op, "x-hac-actions", &actions)
+			}
+			if err != nil {
+				report.unmapped(method, path, opID, err.Error())
+				continue
+			}
+			byPath[path] = append(byPath[path], mapped{method: method, opID: opID, action: a, related: related, actions: actions, tags: stringSlice(op["tags"])})
+		}
+	}
+
+	for _, path := range sortedKeys(paths) {
+		for _, o := range byPath[path] {
+			pattern := path
+			if opts.MethodPatterns {
+				pattern = o.method + " " + path
+			}
+			if reg.Lookup(o.method, pattern) != nil {
+				report.unmapped(o.method, path, o.opID, "route is already registered")
+				continue
+			}
+
+			// Unless x-hac-actions lists them, advertise the other operations
+			// on this path, and state-changing operations on static
+			// sub-resources such as /users/{id}/upgrade.
+			actions := o.actions
+			if actions == nil {
+				for _, other := range byPath[path] {
+					if other.method != o.method {
+						actions = append(actions, other.action)
+					}
+				}
+				for _, child := range sortedKeys(paths) {
+					parent, last, _ := cutLast(child)
+					if parent != path || last == "" || strings.ContainsAny(last, "{}") {
+						continue
+					}
+					for _, other := range byPath[child] {
+						if !isSafeMethod(other.method) {
+							actions = append(actions, other.action)
+						}
+					}
+				}
+			}
+
+			err := reg.Route(o.method, pattern).
+				Description(o.action.Description).
+				Actions(actions...).
+				Related(o.related...).
+				Tags(o.tags...).
+				Register()
+			if err != nil {
+				report.unmapped(o.method, path, o.opID, err.Error())
+				continue
+			}
+			report.Imported = append(report.Imported, o.method+" "+path)
+		}
+	}
+	return report, nil
+}
+
+func (rep *OpenAPIReport) unmapped(method, path, opID, reason string) {
+	rep.Unmapped = append(rep.Unmapped, UnmappedOperation{
+		Method:      method,
+		Path:        path,
+		OperationID: opID,
+		Reason:      reason,
+	})
+}
+
+// openAPIAction maps one operation to an action.
+func openAPIAction(doc, item, op map[string]any, method, path string) (Action, error) {
+	a := Action{Method: method, Href: path}
+
+	a.Rel, _ = op["operationId"].(string)
+	if err := decodeExtension(op, "x-hac-rel", &a.Rel); err != nil {
+		return a, err
+	}
+	if a.Rel == "" {
+		a.Rel = strings.ToLower(method) + "-" + deriveRel(path)
+	}
+
+	summary, _ := op["summary"].(string)
+	a.Description, _ = op["description"].(string)
+	if a.Description == "" {
+		a.Description = summary
+	}
+	if err := decodeExtension(op, "x-hac-description", &a.Description); err != nil {
+		return a, err
+	}
+
+	a.Safety = defaultSafety(method)
+	if _, ok := op["x-hac-safety"]; ok {
+		if a.Safety == nil {
+			a.Safety = &Safety{}
+		}
+		if err := decodeExtension(op, "x-hac-safety", a.Safety); err != nil {
+			return a, err
+		}
+	}
+	if _, ok := op["x-hac-cost"]; ok {
+		if a.Safety == nil {
+			a.Safety = &Safety{}
+		}
+		a.Safety.Cost = &Cost{}
+		if err := decodeExtension(op, "x-hac-cost", a.Safety.Cost); err != nil {
+			return a, err
+		}
+	}
+	if err := decodeExtension(op, "x-hac-preconditions", &a.Preconditions); err != nil {
+		return a, err
+	}
+
+	fields, err := openAPIFields(doc, item, op, method)
+	if err != nil {
+		return a, err
+	}
+	a.Fields = fields
+	return a, nil
+}
+
+// defaultSafety returns the spec §12.2 safety defaults for method, or nil
+// when the method has none.
+func defaultSafety(method string) *Safety {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return &Safety{Mutability: ReadOnly}
+	case http.MethodDelete:
+		return &Safety{Mutability: Irreversible}
+	case http.MethodPut, http.MethodPatch:
+		return &Safety{Mutability: Reversible}
+	}
+	return nil
+}
+
+// openAPIFields derives action fields from the JSON request body schema, or
+// from query parameters for methods whose arguments travel in the query.
+func openAPIFields(doc, item, op map[string]any, method string) ([]Field, error) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return openAPIQueryFields(doc, item, op)
+	}
+
+	raw, ok := op["requestBody"]
+	if !ok {
+		return nil, nil
+	}
+	body, ok := resolveRef(doc, raw)
+	if !ok {
+		return nil, fmt.Errorf("unresolvable requestBody $ref")
+	}
+	content, _ := body["content"].(map[string]any)
+	var media map[string]any
+	for _, ct := range sortedKeys(content) {
+		if mt, _, _ := strings.Cut(ct, ";"); mt == "application/json" || strings.HasSuffix(mt, "+json") {
+			media, _ = content[ct].(map[string]any)
+			break
+		}
+	}
+	if media == nil {
+		return nil, fmt.Errorf("request body has no JSON media type")
+	}
+	if media["schema"] == nil {
+		return nil, nil
+	}
+	schema, ok := resolveRef(doc, media["schema"])
+	if !ok {
+		return nil, fmt.Errorf("unresolvable request body schema $ref")
+	}
+	props, required, err := schemaProperties(doc, schema, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]Field, 0, len(props))
+	for _, name := range sortedKeys(props) {
+		prop, ok := resolveRef(doc, props[name])
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref for property %q", name)
+		}
+		f := openAPIField(doc, name, prop, 0)
+		f.Required = required[name]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// openAPIQueryFields maps the query parameters of an operation and its path
+// item to fields. Operation parameters override path item parameters.
+func openAPIQueryFields(doc, item, op map[string]any) ([]Field, error) {
+	var fields []Field
+	index := make(map[string]int)
+	for _, owner := range []map[string]any{item, op} {
+		params, _ := owner["parameters"].([]any)
+		for _, raw := range params {
+			p, ok := resolveRef(doc, raw)
+			if !ok {
+				return nil, fmt.Errorf("unresolvable parameter $ref")
+			}
+			if in, _ := p["in"].(string); in != "query" {
+				continue
+			}
+			name, _ := p["name"].(string)
+			schema, ok := resolveRef(doc, p["schema"])
+			if !ok {
+				schema = map[string]any{}
+			}
+			f := openAPIField(doc, name, schema, 0)
+			if desc, _ := p["description"].(string); desc != "" {
+				f.Description = desc
+			}
+			f.Required, _ = p["required"].(bool)
+			if i, ok := index[name]; ok {
+				fields[i] = f
+				continue
+			}
+			index[name] = len(fields)
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// schemaProperties returns the properties and required names of an object
+// schema, merging allOf members down to maxFieldDepth so that an allOf that
+// refers back to its own schema terminates.
+func schemaProperties(doc, schema map[string]any, depth int) (map[string]any, map[string]bool, error) {
+	props := make(map[string]any)
+	required := make(map[string]bool)
+	if p, ok := schema["properties"].(map[string]any); ok {
+		for k, v := range p {
+			props[k] = v
+		}
+	}
+	for _, name := range stringSlice(schema["required"]) {
+		required[name] = true
+	}
+	if depth >= maxFieldDepth {
+		return props, required, nil
+	}
+	all, _ := schema["allOf"].([]any)
+	for _, raw := range all {
+		sub, ok := resolveRef(doc, raw)
+		if !ok {
+			return nil, nil, fmt.Errorf("unresolvable allOf $ref")
+		}
+		p, r, err := schemaProperties(doc, sub, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range p {
+			props[k] = v
+		}
+		for k := range r {
+			required[k] = true
+		}
+	}
+	return props, required, nil
+}
+
+// maxFieldDepth bounds how deeply nested schemas are mapped to fields, which
+// also stops recursive $refs.
+const maxFieldDepth = 8
+
+// openAPIField maps a property schema to a field, including the items and
+// properties of nested schemas down to maxFieldDepth. Nested schemas whose
+// $ref cannot be resolved are left out.
+func openAPIField(doc map[string]any, name string, schema map[string]any, depth int) Field {
+	f := Field{Name: name, Type: schemaType(schema["type"])}
+	f.Description, _ = schema["description"].(string)
+	if f.Description == "" {
+		f.Description, _ = schema["title"].(string)
+	}
+	f.Enum, _ = schema["enum"].([]any)
+	f.Default = schema["default"]
+	f.Format, _ = schema["format"].(string)
+	f.Pattern, _ = schema["pattern"].(string)
+	f.Minimum = schemaFloat(schema["minimum"])
+	f.Maximum = schemaFloat(schema["maximum"])
+	if n := schemaFloat(schema["minLength"]); n != nil {
+		length := int(*n)
+		f.MinLength = &length
+	}
+	if n := schemaFloat(schema["maxLength"]); n != nil {
+		length := int(*n)
+		f.MaxLength = &length
+	}
+	if f.Type == "" {
+		f.Type = "string"
+	}
+	if depth >= maxFieldDepth {
+		return f
+	}
+
+	switch f.Type {
+	case "array":
+		if items, ok := resolveRef(doc, schema["items"]); ok {
+			item := openAPIField(doc, "", items, depth+1)
+			f.Items = &item
+		}
+	case "object":
+		props, required, err := schemaProperties(doc, schema, depth)
+		if err != nil {
+			break
+		}
+		for _, name := range sortedKeys(props) {
+			prop, ok := resolveRef(doc, props[name])
+			if !ok {
+				continue
+			}
+			p := openAPIField(doc, name, prop, depth+1)
+			p.Required = required[name]
+			f.Properties = append(f.Properties, p)
+		}
+	}
+	return f
+}
+
+// schemaFloat reads a numeric schema keyword.
+func schemaFloat(v any) *float64 {
+	n, ok := v.(float64)
+	if !ok {
+		return nil
+	}
+	return &n
+}
+
+// schemaType reads a schema type, taking the first non-null member of an
+// OpenAPI 3.1 type array.
+func schemaType(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case []any:
+		for _, m := range t {
+			if s, ok := m.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// resolveRef follows local "#/..." references until it reaches an object.
+func resolveRef(doc map[string]any, v any) (map[string]any, bool) {
+	for depth := 0; depth < 32; depth++ {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m, true
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil, false
+		}
+		var cur any = doc
+		for _, tok := range strings.Split(ref[2:], "/") {
+			tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+			obj, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			cur = obj[tok]
+		}
+		v = cur
+	}
+	return nil, false
+}
+
+// decodeExtension decodes the named vendor extension of obj into dst. It is a
+// no-op when the extension is absent.
+func decodeExtension(obj map[string]any, name string, dst any) error {
+	v, ok := obj[name]
+	if !ok {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(raw, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// cutLast splits path at its last slash: "/users/{id}/upgrade" yields
+// "/users/{id}" and "upgrade".
+func cutLast(path string) (parent, last string, ok bool) {
+	i := strings.LastIndexByte(path, '/')
+	if i <= 0 {
+		return "", "", false
+	}
+	return path[:i], path[i+1:], true
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func stringSlice(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// OpenAPIInfo is the info object of an exported OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// ExportOpenAPI generates an OpenAPI 3.1 document from reg. Every registered
+// route, and every relative action href declared on one, becomes an
+// operation. Action fields become query parameters for GET, HEAD and DELETE
+// and a JSON request body otherwise. Safety, cost, preconditions and related
+// resources are emitted as the x-hac-* extensions read by ImportOpenAPI, and
+// the actions a route advertises as x-hac-actions. Each operation documents
+// the HAC media type as an alternate response content type.
+//
+// The result is ready to be marshaled with encoding/json.
+func ExportOpenAPI(reg *Registry, info OpenAPIInfo) map[string]any {
+	type operation struct {
+		method string
+		path   string
+		cfg    *RouteConfig
+		action *Action
+	}
+	var ops []*operation
+	index := make(map[routeKey]*operation)
+	add := func(method, path string) *operation {
+		k := routeKey{method: method, pattern: openAPIPath(path)}
+		if o, ok := index[k]; ok {
+			return o
+		}
+		o := &operation{method: method, path: k.pattern}
+		index[k] = o
+		ops = append(ops, o)
+		return o
+	}
+	for _, pair := range sortedRoutes(reg) {
+		add(pair[0], routePath(pair[1])).cfg = reg.Lookup(pair[0], pair[1])
+	}
+	for _, a := range reg.Actions() {
+		if strings.Contains(a.Href, "://") || !strings.HasPrefix(a.Href, "/") {
+			continue
+		}
+		add(strings.ToUpper(a.Method), a.Href).action = &a
+	}
+
+	paths := make(map[string]any)
+	usedIDs := make(map[string]bool)
+	for _, o := range ops {
+		a := Action{Method: o.method, Href: o.path, Rel: strings.ToLower(o.method) + "-" + deriveRel(o.path)}
+		if o.action != nil {
+			a = *o.action
+		}
+		op := map[string]any{
+			"operationId": uniqueToolName(a, usedIDs),
+			"responses":   openAPIResponses(),
+		}
+		if op["operationId"] != a.Rel {
+			op["x-hac-rel"] = a.Rel
+		}
+		desc := a.Description
+		if o.cfg != nil {
+			if desc == "" {
+				desc = o.cfg.Description
+			}
+			if len(o.cfg.Related) > 0 {
+				op["x-hac-related"] = o.cfg.Related
+			}
+			if len(o.cfg.Tags) > 0 {
+				op["tags"] = o.cfg.Tags
+			}
+			if len(o.cfg.Actions) > 0 {
+				op["x-hac-actions"] = o.cfg.Actions
+			}
+		}
+		if desc != "" {
+			op["description"] = desc
+		}
+		if s := a.Safety; s != nil {
+			safety := *s
+			safety.Cost = nil
+			if safety != (Safety{}) {
+				op["x-hac-safety"] = safety
+			}
+			if s.Cost != nil {
+				op["x-hac-cost"] = s.Cost
+			}
+		}
+		if len(a.Preconditions) > 0 {
+			op["x-hac-preconditions"] = a.Preconditions
+		}
+
+		// Path variables become path parameters; query expressions such as
+		// "{?limit}" and the fields ValidateRequests reads from the query
+		// string become query parameters, and the rest a JSON body.
+		var params []any
+		queryFields, bodyFields := splitFields(a)
+		inQuery := make(map[string]bool)
+		for _, f := range queryFields {
+			inQuery[f.Name] = true
+		}
+		for _, v := range templateVars(a.Href) {
+			switch {
+			case !v.inQuery():
+				params = append(params, map[string]any{
+					"name": v.name, "in": "path", "required": true,
+					"schema": FieldSchema(fieldNamed(a.Fields, v.name)),
+				})
+			case !inQuery[v.name]:
+				queryFields = append(queryFields, Field{Name: v.name, Type: "string"})
+			}
+		}
+		for _, f := range queryFields {
+			p := map[string]any{"name": f.Name, "in": "query", "schema": FieldSchema(f)}
+			if f.Description != "" {
+				p["description"] = f.Description
+			}
+			if f.Required {
+				p["required"] = true
+			}
+			params = append(params, p)
+		}
+		if len(bodyFields) > 0 {
+			schema := FieldsSchema(bodyFields)
+			op["requestBody"] = map[string]any{
+				"required": len(schema.Required) > 0,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schema},
+				},
+			}
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		item, _ := paths[o.path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[o.path] = item
+		}
+		item[strings.ToLower(o.method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info":    info,
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": openAPIEnvelopeSchemas(),
+		},
+	}
+}
+
+// openAPIPath converts a route path or action href to an OpenAPI path
+// template: ServeMux "{name...}" wildcards become "{name}", and the "{$}"
+// anchor and query expressions such as "{?limit}" are dropped.
+func openAPIPath(path string) string {
+	path = strings.ReplaceAll(path, "...}", "}")
+	for _, op := range []string{"{?", "{&"} {
+		for {
+			i := strings.Index(path, op)
+			if i < 0 {
+				break
+			}
+			end := strings.IndexByte(path[i:], '}')
+			if end < 0 {
+				path = path[:i]
+				break
+			}
+			path = path[:i] + path[i+end+1:]
+		}
+	}
+	return strings.TrimSuffix(path, "{$}")
+}
+
+// openAPIResponses documents the plain JSON response alongside the HAC
+// envelope available through content negotiation.
+func openAPIResponses() map[string]any {
+	return map[string]any{
+		"2XX": map[string]any{
+			"description": "Success. Send Accept: " + MediaType + " to receive the HAC envelope.",
+			"content": map[string]any{
+				"application/json": map[string]any{},
+				MediaType: map[string]any{
+					"schema": map[string]any{"$ref": "#/components/schemas/HACSuccessEnvelope"},
+				},
+			},
+		},
+		"default": map[string]any{
+			"description": "Error.",
+			"content": map[string]any{
+				"application/json": map[string]any{},
+				MediaType: map[string]any{
+					"schema": map[string]any{"$ref": "#/components/schemas/HACErrorEnvelope"},
+				},
+			},
+		},
+	}
+}
+
+// openAPIEnvelopeSchemas describes the HAC envelopes referenced by
+// openAPIResponses.
+func openAPIEnvelopeSchemas() map[string]any {
+	str := &Schema{Type: "string"}
+	return map[string]any{
+		"HACSuccessEnvelope": &Schema{
+			Type:     "object",
+			Required: []string{"data", "_hac"},
+			Properties: map[string]*Schema{
+				"data": {Description: "The original response body."},
+				"_hac": {
+					Type:     "object",
+					Required: []string{"version"},
+					Properties: map[string]*Schema{
+						"version":     str,
+						"description": str,
+						"actions":     {Type: "array", Items: &Schema{Type: "object"}},
+						"related":     {Type: "array", Items: &Schema{Type: "object"}},
+					},
+				},
+			},
+		},
+		"HACErrorEnvelope": &Schema{
+			Type:     "object",
+			Required: []string{"error"},
+			Properties: map[string]*Schema{
+				"error": {
+					Type:     "object",
+					Required: []string{"code", "message"},
+					Properties: map[string]*Schema{
+						"code":        str,
+						"message":     str,
+						"retryable":   {Type: "boolean"},
+						"retry_after": {Type: "integer"},
+						"recovery":    {Type: "object"},
+					},
+				},
+			},
+		},
+	}
+}
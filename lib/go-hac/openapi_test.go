@@ -0,0 +1,433 @@
+package hac
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testOpenAPIDoc = `{
+  "openapi": "3.1.0",
+  "info": {"title": "Users", "version": "1.0.0"},
+  "paths": {
+    "/users": {
+      "get": {
+        "operationId": "listUsers",
+        "summary": "List users.",
+        "parameters": [
+          {"name": "limit", "in": "query", "schema": {"type": "integer", "default": 20}},
+          {"name": "X-Trace", "in": "header", "schema": {"type": "string"}}
+        ]
+      },
+      "post": {
+        "operationId": "createUser",
+        "summary": "Create a user.",
+        "requestBody": {"$ref": "#/components/requestBodies/NewUser"}
+      }
+    },
+    "/users/{id}": {
+      "parameters": [
+        {"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}
+      ],
+      "get": {
+        "operationId": "getUser",
+        "description": "A user account.",
+        "x-hac-related": [{"rel": "orders", "href": "/users/{id}/orders"}]
+      },
+      "patch": {
+        "operationId": "updateUser",
+        "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/UserPatch"}}}}
+      },
+      "delete": {
+        "operationId": "deleteUser",
+        "x-hac-description": "Permanently delete this user and their orders.",
+        "x-hac-safety": {"blast_radius": "self_and_associated", "confirmation_recommended": true},
+        "x-hac-preconditions": ["User has no open invoices."]
+      }
+    },
+    "/users/{id}/upgrade": {
+      "post": {
+        "operationId": "upgradeUser",
+        "x-hac-rel": "upgrade",
+        "x-hac-cost": {"amount": 49, "currency": "USD"},
+        "requestBody": {"content": {"application/json": {"schema": {
+          "type": "object",
+          "required": ["plan"],
+          "properties": {"plan": {"type": "string", "enum": ["pro", "enterprise"]}}
+        }}}}
+      }
+    },
+    "/users/{id}/avatar": {
+      "put": {
+        "operationId": "uploadAvatar",
+        "requestBody": {"content": {"image/png": {}}}
+      }
+    },
+    "/internal/reindex": {
+      "post": {"operationId": "reindex", "x-hac-ignore": true}
+    }
+  },
+  "components": {
+    "requestBodies": {
+      "NewUser": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/NewUser"}}}}
+    },
+    "schemas": {
+      "NewUser": {
+        "type": "object",
+        "required": ["email"],
+        "properties": {
+          "email": {"type": "string", "description": "Login email."},
+          "name": {"type": ["string", "null"]}
+        }
+      },
+      "UserPatch": {
+        "allOf": [
+          {"$ref": "#/components/schemas/NewUser"},
+          {"properties": {"role": {"type": "string", "enum": ["admin", "member"]}}}
+        ]
+      }
+    }
+  }
+}`
+
+func TestImportOpenAPI(t *testing.T) {
+	reg := NewRegistry()
+	report, err := ImportOpenAPI(reg, strings.NewReader(testOpenAPIDoc), OpenAPIImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportOpenAPI: %v", err)
+	}
+
+	wantImported := []string{
+		"GET /users", "POST /users",
+		"GET /users/{id}", "PATCH /users/{id}", "DELETE /users/{id}",
+		"POST /users/{id}/upgrade",
+	}
+	if !reflect.DeepEqual(report.Imported, wantImported) {
+		t.Errorf("imported = %v, want %v", report.Imported, wantImported)
+	}
+
+	cfg := reg.Lookup("GET", "/users/{id}")
+	if cfg == nil {
+		t.Fatal("GET /users/{id} not registered")
+	}
+	if cfg.Description != "A user account." {
+		t.Errorf("description = %q", cfg.Description)
+	}
+	if len(cfg.Related) != 1 || cfg.Related[0].Href != "/users/{id}/orders" {
+		t.Errorf("related = %+v", cfg.Related)
+	}
+	if len(cfg.Actions) != 3 {
+		t.Fatalf("actions = %+v, want patch, delete and upgrade", cfg.Actions)
+	}
+
+	patch, del, upgrade := cfg.Actions[0], cfg.Actions[1], cfg.Actions[2]
+	if patch.Rel != "updateUser" || patch.Safety.Mutability != Reversible {
+		t.Errorf("patch action = %+v", patch)
+	}
+	wantFields := []Field{
+		{Name: "email", Type: "string", Description: "Login email.", Required: true},
+		{Name: "name", Type: "string"},
+		{Name: "role", Type: "string", Enum: []any{"admin", "member"}},
+	}
+	if !reflect.DeepEqual(patch.Fields, wantFields) {
+		t.Errorf("patch fields = %+v, want %+v", patch.Fields, wantFields)
+	}
+
+	wantSafety := &Safety{Mutability: Irreversible, BlastRadius: SelfAndAssociated, ConfirmationRecommended: true}
+	if !reflect.DeepEqual(del.Safety, wantSafety) {
+		t.Errorf("delete safety = %+v, want %+v", del.Safety, wantSafety)
+	}
+	if del.Description != "Permanently delete this user and their orders." {
+		t.Errorf("delete description = %q", del.Description)
+	}
+	if len(del.Preconditions) != 1 {
+		t.Errorf("delete preconditions = %v", del.Preconditions)
+	}
+
+	if upgrade.Rel != "upgrade" || upgrade.Safety.Cost == nil || upgrade.Safety.Cost.Amount != 49 {
+		t.Errorf("upgrade action = %+v", upgrade)
+	}
+	if upgrade.Safety.Mutability != "" {
+		t.Errorf("POST mutability = %q, want unset", upgrade.Safety.Mutability)
+	}
+
+	list := reg.Lookup("POST", "/users").Actions
+	if len(list) != 1 || list[0].Rel != "listUsers" || list[0].Safety.Mutability != ReadOnly {
+		t.Fatalf("POST /users actions = %+v", list)
+	}
+	wantQuery := []Field{{Name: "limit", Type: "integer", Default: float64(20)}}
+	if !reflect.DeepEqual(list[0].Fields, wantQuery) {
+		t.Errorf("list fields = %+v, want %+v", list[0].Fields, wantQuery)
+	}
+}
+
+func TestImportOpenAPINested(t *testing.T) {
+	doc := `{
+  "openapi": "3.1.0",
+  "paths": {"/orders": {"get": {"operationId": "listOrders"}, "post": {
+    "operationId": "createOrder",
+    "requestBody": {"content": {"application/json": {"schema": {
+      "type": "object",
+      "properties": {
+        "email": {"type": "string", "format": "email", "maxLength": 254},
+        "lines": {"type": "array", "items": {"$ref": "#/components/schemas/Line"}}
+      }
+    }}}}
+  }}},
+  "components": {"schemas": {"Line": {
+    "type": "object",
+    "required": ["sku"],
+    "properties": {
+      "sku": {"type": "string", "pattern": "^[A-Z]+$"},
+      "qty": {"type": "integer", "minimum": 1, "maximum": 99}
+    }
+  }}}
+}`
+	reg := NewRegistry()
+	if _, err := ImportOpenAPI(reg, strings.NewReader(doc), OpenAPIImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	one, maxQty, maxLen := 1.0, 99.0, 254
+	want := []Field{
+		{Name: "email", Type: "string", Format: "email", MaxLength: &maxLen},
+		{Name: "lines", Type: "array", Items: &Field{Type: "object", Properties: []Field{
+			{Name: "qty", Type: "integer", Minimum: &one, Maximum: &maxQty},
+			{Name: "sku", Type: "string", Pattern: "^[A-Z]+$", Required: true},
+		}}},
+	}
+	got := reg.Lookup("GET", "/orders").Actions[0].Fields
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %+v, want %+v", got, want)
+	}
+}
+
+func TestImportOpenAPIRecursiveAllOf(t *testing.T) {
+	doc := `{
+  "openapi": "3.1.0",
+  "paths": {"/nodes": {"get": {"operationId": "listNodes"}, "post": {
+    "operationId": "createNode",
+    "requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Node"}}}}
+  }}},
+  "components": {"schemas": {"Node": {
+    "type": "object",
+    "properties": {"name": {"type": "string"}},
+    "allOf": [{"$ref": "#/components/schemas/Node"}]
+  }}}
+}`
+	reg := NewRegistry()
+	if _, err := ImportOpenAPI(reg, strings.NewReader(doc), OpenAPIImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got := reg.Lookup("GET", "/nodes").Actions[0].Fields
+	if len(got) != 1 || got[0].Name != "name" {
+		t.Errorf("fields = %+v", got)
+	}
+}
+
+func TestImportOpenAPIExtensions(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("GET /users").Description("Hand-written.").MustRegister()
+
+	report, err := ImportOpenAPI(reg, strings.NewReader(testOpenAPIDoc), OpenAPIImportOptions{MethodPatterns: true})
+	if err != nil {
+		t.Fatalf("ImportOpenAPI: %v", err)
+	}
+	if reg.Lookup("GET", "GET /users/{id}") == nil {
+		t.Error("MethodPatterns: GET /users/{id} not registered under method pattern")
+	}
+	if got := reg.Lookup("GET", "GET /users").Description; got != "Hand-written." {
+		t.Errorf("existing route overwritten: %q", got)
+	}
+
+	reasons := make(map[string]string)
+	for _, u := range report.Unmapped {
+		reasons[u.Method+" "+u.Path] = u.Reason
+	}
+	want := map[string]string{
+		"GET /users":             "route is already registered",
+		"PUT /users/{id}/avatar": "request body has no JSON media type",
+		"POST /internal/reindex": "x-hac-ignore is set",
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("unmapped = %v, want %v", reasons, want)
+	}
+}
+
+func TestImportOpenAPIErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid json": `{`,
+		"swagger 2":    `{"swagger": "2.0", "paths": {}}`,
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ImportOpenAPI(NewRegistry(), strings.NewReader(doc), OpenAPIImportOptions{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestImportOpenAPIInvalidExtension(t *testing.T) {
+	doc := `{"openapi": "3.0.3", "paths": {"/orders": {"delete": {"x-hac-safety": "yes"}}}}`
+	report, err := ImportOpenAPI(NewRegistry(), strings.NewReader(doc), OpenAPIImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unmapped) != 1 || !strings.HasPrefix(report.Unmapped[0].Reason, "invalid x-hac-safety") {
+		t.Errorf("unmapped = %+v", report.Unmapped)
+	}
+}
+
+func TestExportOpenAPI(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("GET /users/{id}").
+		Description("A user account.").
+		Actions(
+			Action{
+				Rel: "delete", Method: "DELETE", Href: "/users/{id}",
+				Description: "Permanently delete this user.",
+				Safety:      &Safety{Mutability: Irreversible, ConfirmationRecommended: true},
+			},
+			Action{
+				Rel: "upgrade", Method: "POST", Href: "/users/{id}/upgrade",
+				Safety:        &Safety{Mutability: Reversible, Cost: &Cost{Amount: 49, Currency: "USD"}},
+				Fields:        []Field{{Name: "plan", Type: "string", Required: true, Enum: []any{"pro"}}},
+				Preconditions: []string{"User is on the free plan."},
+			},
+		).
+		Related(RelatedResource{Rel: "orders", Href: "/users/{id}/orders"}).
+		MustRegister()
+	reg.Get("GET /files/{path...}").Description("A file.").MustRegister()
+	reg.Get("GET /users").Description("All users.").Actions(Action{
+		Rel: "search", Method: "GET", Href: "/users{?q,limit}",
+		Fields: []Field{{Name: "limit", Type: "integer"}},
+	}).MustRegister()
+
+	doc := ExportOpenAPI(reg, OpenAPIInfo{Title: "Users", Version: "1.0.0"})
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var got struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string            `json:"operationId"`
+			Description string            `json:"description"`
+			Parameters  []json.RawMessage `json:"parameters"`
+			RequestBody *struct {
+				Required bool `json:"required"`
+				Content  map[string]struct {
+					Schema Schema `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]struct {
+				Content map[string]json.RawMessage `json:"content"`
+			} `json:"responses"`
+			Safety  *Safety           `json:"x-hac-safety"`
+			Cost    *Cost             `json:"x-hac-cost"`
+			Related []RelatedResource `json:"x-hac-related"`
+			Actions []Action          `json:"x-hac-actions"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q", got.OpenAPI)
+	}
+
+	wantPaths := []string{"/files/{path}", "/users", "/users/{id}", "/users/{id}/upgrade"}
+	var paths []string
+	for p := range got.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("paths = %v, want %v", paths, wantPaths)
+	}
+
+	get := got.Paths["/users/{id}"]["get"]
+	if get.Description != "A user account." || len(get.Related) != 1 || len(get.Actions) != 2 {
+		t.Errorf("get operation = %+v", get)
+	}
+	if len(get.Parameters) != 1 || !strings.Contains(string(get.Parameters[0]), `"in":"path"`) {
+		t.Errorf("get parameters = %s", get.Parameters)
+	}
+	if _, ok := get.Responses["2XX"].Content[MediaType]; !ok {
+		t.Errorf("HAC media type not documented: %+v", get.Responses)
+	}
+
+	search := got.Paths["/users"]["get"]
+	var params []string
+	for _, p := range search.Parameters {
+		var param struct{ Name, In string }
+		json.Unmarshal(p, &param)
+		params = append(params, param.In+" "+param.Name)
+	}
+	if want := []string{"query limit", "query q"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("search parameters = %v, want %v", params, want)
+	}
+
+	del := got.Paths["/users/{id}"]["delete"]
+	if del.OperationID != "delete" || del.Safety == nil || del.Safety.Mutability != Irreversible {
+		t.Errorf("delete operation = %+v", del)
+	}
+
+	upgrade := got.Paths["/users/{id}/upgrade"]["post"]
+	if upgrade.Cost == nil || upgrade.Cost.Amount != 49 {
+		t.Errorf("upgrade cost = %+v", upgrade.Cost)
+	}
+	if upgrade.RequestBody == nil || !upgrade.RequestBody.Required {
+		t.Fatalf("upgrade request body = %+v", upgrade.RequestBody)
+	}
+	body := upgrade.RequestBody.Content["application/json"].Schema
+	if !reflect.DeepEqual(body.Required, []string{"plan"}) || body.Properties["plan"] == nil {
+		t.Errorf("upgrade body schema = %+v", body)
+	}
+}
+
+func TestExportOpenAPIActionsRoundTrip(t *testing.T) {
+	src := NewRegistry()
+	portal := Action{Rel: "billing-portal", Method: "GET", Href: "https://billing.example/portal"}
+	src.Get("/users/{id}").Description("A user.").Actions(portal).MustRegister()
+	out, err := json.Marshal(ExportOpenAPI(src, OpenAPIInfo{Title: "Users", Version: "1.0.0"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewRegistry()
+	if _, err := ImportOpenAPI(dst, bytes.NewReader(out), OpenAPIImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := dst.Lookup("GET", "/users/{id}")
+	if cfg == nil || !reflect.DeepEqual(cfg.Actions, []Action{portal}) {
+		t.Errorf("imported route = %+v, want actions [%+v]", cfg, portal)
+	}
+}
+
+func TestExportOpenAPIRoundTrip(t *testing.T) {
+	src := NewRegistry()
+	if _, err := ImportOpenAPI(src, strings.NewReader(testOpenAPIDoc), OpenAPIImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(ExportOpenAPI(src, OpenAPIInfo{Title: "Users", Version: "1.0.0"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewRegistry()
+	report, err := ImportOpenAPI(dst, bytes.NewReader(out), OpenAPIImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unmapped) != 0 {
+		t.Errorf("unmapped = %+v", report.Unmapped)
+	}
+	if !reflect.DeepEqual(dst.Actions(), src.Actions()) {
+		t.Errorf("round trip changed actions:\n got %+v\nwant %+v", dst.Actions(), src.Actions())
+	}
+}
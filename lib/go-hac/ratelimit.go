@@ -0,0 +1,230 @@
+package hac
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token-bucket limit: Requests tokens are refilled evenly over
+// Per, and up to Burst may be spent at once. Burst defaults to Requests.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// RateLimitOptions configures the AgentRateLimit middleware.
+//
+// The limit for a request is the first that is set of: Routes for its route,
+// the caller's entry in Callers, Mutability for the mutability class of its
+// action, and Default. Each caller has its own bucket per route.
+type RateLimitOptions struct {
+	// Registry is searched for the action a request invokes, which
+	// determines the route and mutability class.
+	Registry *Registry
+
+	// Source, if set, supplies the registry per request and takes precedence
+	// over Registry, as in Options.
+	Source RegistrySource
+
+	// PathResolver names the route of requests that match no action.
+	// Defaults to StdlibPathResolver, falling back to the request path.
+	PathResolver PathResolver
+
+	// Default applies when no more specific limit is set. A zero Default
+	// leaves such requests unlimited.
+	Default RateLimit
+
+	// Routes sets limits per route, keyed by "METHOD href" as in the
+	// action, such as "DELETE /orders/{id}".
+	Routes map[string]RateLimit
+
+	// Mutability sets limits per mutability class, typically stricter for
+	// Irreversible. Safe requests that match no action count as ReadOnly.
+	Mutability map[Mutability]RateLimit
+
+	// Callers replaces Mutability and Default for particular callers.
+	Callers map[string]RateLimit
+
+	// Caller identifies the caller. Defaults to a single shared caller.
+	Caller CallerFunc
+}
+
+// AgentRateLimit returns a middleware that throttles agent traffic with
+// token buckets. Only HAC requests are limited, so human traffic on the same
+// routes is unaffected. Limited responses carry RateLimit-Policy,
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers; a request
+// with no token left is rejected with a retryable 429 HAC error, code
+// "rate_limited", whose retry_after is the time until the next token.
+func AgentRateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	return newRateLimiter(opts).middleware
+}
+
+type rateLimiter struct {
+	opts RateLimitOptions
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func newRateLimiter(opts RateLimitOptions) *rateLimiter {
+	if opts.Registry == nil {
+		opts.Registry = NewRegistry()
+	}
+	if opts.PathResolver == nil {
+		opts.PathResolver = StdlibPathResolver
+	}
+	return &rateLimiter{
+		opts:    opts,
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wantsHAC(r.Header.Get("Accept")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		caller := ""
+		if rl.opts.Caller != nil {
+			caller = rl.opts.Caller(r)
+		}
+		route, limit := rl.limitFor(r, caller)
+		if !limit.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ok, remaining, reset, retry := rl.take(caller+"\x00"+route, limit)
+		h := w.Header()
+		h.Set("RateLimit-Policy", strconv.Itoa(int(limit.burst()))+";w="+strconv.Itoa(int(math.Ceil(limit.Per.Seconds()))))
+		h.Set("RateLimit-Limit", strconv.Itoa(int(limit.burst())))
+		h.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		after := max(1, ceilSeconds(retry))
+		h.Set("Retry-After", strconv.Itoa(after))
+		writeHACError(w, r, http.StatusTooManyRequests, &HACError{
+			Code:       "rate_limited",
+			Message:    "Too many requests to " + route + ".",
+			Retryable:  true,
+			RetryAfter: after,
+			Recovery: &Recovery{
+				Description: "Wait " + strconv.Itoa(after) + "s before retrying, and slow down: this route allows " +
+					strconv.Itoa(limit.Requests) + " requests per " + limit.Per.String() + ".",
+			},
+		})
+	})
+}
+
+// limitFor returns the route a request belongs to and the limit that
+// applies to it.
+func (rl *rateLimiter) limitFor(r *http.Request, caller string) (string, RateLimit) {
+	route := rl.opts.PathResolver(r)
+	if route == "" {
+		route = r.URL.Path
+	}
+	if !strings.Contains(route, " ") {
+		route = r.Method + " " + route
+	}
+	var class Mutability
+	reg := currentRegistry(rl.opts.Source, rl.opts.Registry)
+	if a, ok := reg.MatchAction(r.Method, r.URL.Path); ok {
+		route = a.Method + " " + a.Href
+		if a.Safety != nil {
+			class = a.Safety.Mutability
+		}
+	}
+	if class == "" && isSafeMethod(r.Method) {
+		class = ReadOnly
+	}
+
+	if l, ok := rl.opts.Routes[route]; ok {
+		return route, l
+	}
+	if l, ok := rl.opts.Callers[caller]; ok {
+		return route, l
+	}
+	if l, ok := rl.opts.Mutability[class]; ok && class != "" {
+		return route, l
+	}
+	return route, rl.opts.Default
+}
+
+// take spends a token from the bucket for key. It reports whether a token
+// was available, the whole tokens left, the time until the bucket is full
+// again, and the time until the next token.
+func (rl *rateLimiter) take(key string, limit RateLimit) (ok bool, remaining int, reset, retry time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	now := rl.now()
+	rl.sweep(now)
+
+	// perToken is in nanoseconds, and fractional when Per is shorter than
+	// Requests nanoseconds.
+	burst := limit.burst()
+	perToken := float64(limit.Per) / float64(limit.Requests)
+	b, found := rl.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: burst, updated: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+float64(now.Sub(b.updated))/perToken)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retry = time.Duration((1 - b.tokens) * perToken)
+	}
+	reset = time.Duration((burst - b.tokens) * perToken)
+	b.full = now.Add(reset)
+	return ok, int(b.tokens), reset, retry
+}
+
+// sweep drops buckets that have refilled, at most once a minute.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.swept) < time.Minute {
+		return
+	}
+	rl.swept = now
+	for k, b := range rl.buckets {
+		if !now.Before(b.full) {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,131 @@
+package hac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func rateLimitRegistry(t *testing.T) *Registry {
+	t.Helper()
+	reg := NewRegistry()
+	reg.Get("/orders/{id}").Actions(
+		Action{Rel: "cancel", Method: "POST", Href: "/orders/{id}/cancel", Fields: []Field{{Name: "id", Type: "string"}},
+			Safety: &Safety{Mutability: Reversible, BlastRadius: Self}},
+		Action{Rel: "delete", Method: "DELETE", Href: "/orders/{id}", Fields: []Field{{Name: "id", Type: "string"}},
+			Safety: &Safety{Mutability: Irreversible, BlastRadius: Self}},
+	).MustRegister()
+	return reg
+}
+
+func agentRequest(method, path, caller string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Accept", MediaType)
+	req.Header.Set("X-Caller", caller)
+	return req
+}
+
+func TestAgentRateLimit(t *testing.T) {
+	rl := newRateLimiter(RateLimitOptions{
+		Registry: rateLimitRegistry(t),
+		Default:  RateLimit{Requests: 2, Per: time.Minute},
+		Caller:   func(r *http.Request) string { return r.Header.Get("X-Caller") },
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+	h := rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, want := range []string{"1", "0"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, agentRequest("POST", "/orders/1/cancel", "alice"))
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Remaining") != want {
+			t.Fatalf("call %d: %d remaining=%q", i, rec.Code, rec.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	// Another order shares the route's bucket.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, agentRequest("POST", "/orders/2/cancel", "alice"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want 429", rec.Code)
+	}
+	var env ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Error.Code != "rate_limited" {
+		t.Fatalf("body = %s", rec.Body)
+	}
+	if !env.Error.Retryable || env.Error.RetryAfter != 30 || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("retry after = %d, header %q", env.Error.RetryAfter, rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("RateLimit-Policy") != "2;w=60" || rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("headers = %v", rec.Header())
+	}
+
+	// Other callers, and human traffic, are not affected.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, agentRequest("POST", "/orders/1/cancel", "bob"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("bob: status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/orders/1/cancel", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("human request: %d %v", rec.Code, rec.Header())
+	}
+
+	// A token is back after half a minute.
+	now = now.Add(30 * time.Second)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, agentRequest("POST", "/orders/1/cancel", "alice"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("after refill: status = %d", rec.Code)
+	}
+}
+
+func TestAgentRateLimitPrecedence(t *testing.T) {
+	rl := newRateLimiter(RateLimitOptions{
+		Registry:   rateLimitRegistry(t),
+		Default:    RateLimit{Requests: 100, Per: time.Minute},
+		Routes:     map[string]RateLimit{"POST /orders/{id}/cancel": {Requests: 3, Per: time.Minute}},
+		Mutability: map[Mutability]RateLimit{Irreversible: {Requests: 1, Per: time.Hour}, ReadOnly: {Requests: 50, Per: time.Minute}},
+		Callers:    map[string]RateLimit{"batch": {Requests: 1000, Per: time.Minute}},
+		Caller:     func(r *http.Request) string { return r.Header.Get("X-Caller") },
+	})
+
+	tests := []struct {
+		method, path, caller string
+		wantRoute            string
+		wantRequests         int
+	}{
+		{"POST", "/orders/1/cancel", "", "POST /orders/{id}/cancel", 3},
+		{"POST", "/orders/1/cancel", "batch", "POST /orders/{id}/cancel", 3},
+		{"DELETE", "/orders/1", "", "DELETE /orders/{id}", 1},
+		// A caller's limit takes precedence over class limits.
+		{"DELETE", "/orders/1", "batch", "DELETE /orders/{id}", 1000},
+		{"GET", "/orders/1", "", "GET /orders/1", 50},
+		{"GET", "/orders/1", "batch", "GET /orders/1", 1000},
+		{"PUT", "/orders/1", "", "PUT /orders/1", 100},
+	}
+	for _, tt := range tests {
+		route, l := rl.limitFor(agentRequest(tt.method, tt.path, tt.caller), tt.caller)
+		if route != tt.wantRoute || l.Requests != tt.wantRequests {
+			t.Errorf("%s %s (%s) = %q %+v", tt.method, tt.path, tt.caller, route, l)
+		}
+	}
+}
+
+func TestAgentRateLimitSubNanosecondRefill(t *testing.T) {
+	rl := newRateLimiter(RateLimitOptions{Default: RateLimit{Requests: 10, Per: 5 * time.Nanosecond}})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+	h := rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := range 3 {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, agentRequest("GET", "/orders", ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("call %d: status = %d", i, rec.Code)
+		}
+		now = now.Add(time.Nanosecond)
+	}
+}
@@ -0,0 +1,188 @@
+package hac
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RegistrySource supplies the registry to use for each request. Set the
+// Source field of Options, BudgetOptions, RateLimitOptions and
+// RequestValidationOptions to serve metadata that can change at runtime.
+type RegistrySource interface {
+	Registry() *Registry
+}
+
+// currentRegistry returns the registry src supplies, or reg if src is nil.
+func currentRegistry(src RegistrySource, reg *Registry) *Registry {
+	if src != nil {
+		return src.Registry()
+	}
+	return reg
+}
+
+// ReloadEvent describes one attempt to replace the live registry.
+type ReloadEvent struct {
+	Time time.Time
+
+	// Origin is the watched file path, or "push" for Reloader.Update.
+	Origin string
+
+	// Routes is the number of routes in the new snapshot.
+	Routes int
+
+	// Err is non-nil if the update was rejected and the previous snapshot
+	// kept.
+	Err error
+}
+
+// DefaultReloadInterval is how often Reloader.WatchFile polls when the
+// interval is zero.
+const DefaultReloadInterval = 2 * time.Second
+
+// Reloader holds the live registry snapshot and swaps it atomically. Readers
+// never block: each request sees either the old or the new snapshot in full.
+// An update that fails validation is rejected and the live snapshot is left
+// in place.
+type Reloader struct {
+	current atomic.Pointer[Registry]
+
+	// mu serializes updates and guards subscribers and infer.
+	mu          sync.Mutex
+	subscribers []func(ReloadEvent)
+	infer       bool
+}
+
+// NewReloader creates a Reloader serving initial, which is frozen. initial
+// may be nil to start with an empty registry.
+func NewReloader(initial *Registry) *Reloader {
+	if initial == nil {
+		initial = NewRegistry()
+	}
+	initial.Freeze()
+	rl := &Reloader{}
+	rl.current.Store(initial)
+	return rl
+}
+
+// Registry returns the live snapshot. It implements RegistrySource.
+func (rl *Reloader) Registry() *Registry {
+	return rl.current.Load()
+}
+
+// Subscribe registers fn to be called after every reload attempt, successful
+// or not. Calls are made synchronously, one at a time.
+func (rl *Reloader) Subscribe(fn func(ReloadEvent)) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.subscribers = append(rl.subscribers, fn)
+}
+
+// InferSafety makes rl infer missing action safety metadata (see
+// Registry.InferSafety) on every snapshot it serves: the live one at once,
+// and each later one from Update or WatchFile before it is validated. The
+// inference is applied to a copy, so registries passed to Update are left
+// unchanged.
+func (rl *Reloader) InferSafety() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.infer {
+		return
+	}
+	rl.infer = true
+	rl.current.Store(inferredCopy(rl.current.Load()))
+}
+
+// Update validates reg and, if it is valid, freezes it and makes it the live
+// snapshot. An invalid reg is rejected with the validation error.
+func (rl *Reloader) Update(reg *Registry) error {
+	return rl.update("push", reg, nil)
+}
+
+func (rl *Reloader) update(origin string, reg *Registry, loadErr error) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	err := loadErr
+	switch {
+	case err != nil:
+	case reg == nil:
+		err = errors.New("hac: nil registry")
+	default:
+		if rl.infer {
+			reg = reg.clone()
+			reg.InferSafety() // reg is not frozen yet
+		}
+		err = reg.Validate()
+	}
+	ev := ReloadEvent{Time: time.Now(), Origin: origin, Err: err}
+	if err == nil {
+		reg.Freeze()
+		rl.current.Store(reg)
+		ev.Routes = len(reg.Routes())
+	}
+	for _, fn := range rl.subscribers {
+		fn(ev)
+	}
+	return err
+}
+
+// WatchFile polls the JSON registry document at path (see LoadRegistry)
+// every interval until ctx is done, and reloads it whenever its content
+// changes, starting with the first poll. A document that fails to load is
+// reported through the subscribers and the previous snapshot is kept; a
+// file that cannot be read is retried on the next poll. WatchFile returns
+// ctx.Err().
+func (rl *Reloader) WatchFile(ctx context.Context, path string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	var (
+		lastMod  time.Time
+		lastSize int64 = -1
+		lastSum  [sha256.Size]byte
+	)
+	poll := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			if lastSize != -2 {
+				rl.update(path, nil, err)
+				lastSize = -2 // report a missing file once
+			}
+			return
+		}
+		if info.ModTime().Equal(lastMod) && info.Size() == lastSize {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			rl.update(path, nil, err)
+			return
+		}
+		lastMod, lastSize = info.ModTime(), info.Size()
+		sum := sha256.Sum256(data)
+		if sum == lastSum {
+			return // touched but unchanged
+		}
+		lastSum = sum
+		reg, err := LoadRegistry(bytes.NewReader(data))
+		rl.update(path, reg, err)
+	}
+
+	poll()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			poll()
+		}
+	}
+}
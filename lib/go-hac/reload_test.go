@@ -0,0 +1,185 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloaderUpdate(t *testing.T) {
+	initial := NewRegistry()
+	initial.Get("/users").Description("Version one.").MustRegister()
+	rl := NewReloader(initial)
+
+	var events []ReloadEvent
+	rl.Subscribe(func(ev ReloadEvent) { events = append(events, ev) })
+
+	if err := initial.Get("/late").Register(); !errors.Is(err, ErrRegistryFrozen) {
+		t.Errorf("register into live snapshot: err = %v", err)
+	}
+
+	bad := NewRegistry()
+	bad.Get("/users").Actions(Action{Rel: "x", Method: "GET", Href: "/users"}).MustRegister()
+	bad.Lookup("GET", "/users").Actions[0].Method = "FETCH"
+	if err := rl.Update(bad); err == nil {
+		t.Error("invalid registry accepted")
+	}
+	if rl.Registry() != initial {
+		t.Error("live snapshot replaced by an invalid registry")
+	}
+
+	next := NewRegistry()
+	next.Get("/users").Description("Version two.").MustRegister()
+	next.Get("/orders").Description("Orders.").MustRegister()
+	if err := rl.Update(next); err != nil {
+		t.Fatal(err)
+	}
+	if rl.Registry() != next {
+		t.Error("live snapshot not replaced")
+	}
+
+	if len(events) != 2 || events[0].Err == nil || events[1].Err != nil ||
+		events[1].Routes != 2 || events[1].Origin != "push" {
+		t.Errorf("events = %+v", events)
+	}
+}
+
+func TestMiddlewareSource(t *testing.T) {
+	v1 := NewRegistry()
+	v1.Get("/users").Description("Version one.").MustRegister()
+	rl := NewReloader(v1)
+	h := Middleware(Options{Source: rl})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+
+	describe := func() string {
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("Accept", MediaType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var env SuccessEnvelope
+		json.Unmarshal(rec.Body.Bytes(), &env)
+		return env.HAC.Description
+	}
+	if got := describe(); got != "Version one." {
+		t.Fatalf("description = %q", got)
+	}
+	v2 := NewRegistry()
+	v2.Get("/users").Description("Version two.").MustRegister()
+	rl.Update(v2)
+	if got := describe(); got != "Version two." {
+		t.Errorf("description after reload = %q", got)
+	}
+}
+
+func TestReloaderWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hac.json")
+	write := func(doc string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"routes": [{"pattern": "GET /users", "description": "Version one."}]}`)
+
+	rl := NewReloader(nil)
+	events := make(chan ReloadEvent, 10)
+	rl.Subscribe(func(ev ReloadEvent) { events <- ev })
+	next := func() ReloadEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload event")
+			return ReloadEvent{}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- rl.WatchFile(ctx, path, 10*time.Millisecond) }()
+
+	if ev := next(); ev.Err != nil || ev.Origin != path || ev.Routes != 1 {
+		t.Fatalf("initial load = %+v", ev)
+	}
+
+	// A broken edit is reported and the live snapshot kept.
+	live := rl.Registry()
+	write(`{"routes": [{"pattern": "GET /users", "descripton": "typo"}]}`)
+	var cfgErr *ConfigError
+	if ev := next(); !errors.As(ev.Err, &cfgErr) || rl.Registry() != live {
+		t.Fatalf("broken edit = %+v", ev)
+	}
+
+	write(`{"routes": [{"pattern": "GET /users", "description": "Version two, fixed."}]}`)
+	if ev := next(); ev.Err != nil {
+		t.Fatalf("fixed edit = %+v", ev)
+	}
+	if cfg := rl.Registry().Lookup("GET", "GET /users"); cfg == nil || cfg.Description != "Version two, fixed." {
+		t.Errorf("reloaded route = %+v", cfg)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("WatchFile returned %v", err)
+	}
+}
+
+func TestMiddlewaresFollowSource(t *testing.T) {
+	v1 := NewRegistry()
+	v1.Get("/orders").Actions(Action{Rel: "create", Method: "POST", Href: "/orders",
+		Safety: &Safety{Mutability: Reversible}}).MustRegister()
+	v1.Post("/orders").Description("Created order.").MustRegister()
+	rl := NewReloader(v1)
+
+	h := Middleware(Options{Source: rl})(
+		BudgetGuard(BudgetOptions{Source: rl, Limits: []BudgetLimit{{Currency: "USD", Amount: 1, Window: time.Hour}}})(
+			AgentRateLimit(RateLimitOptions{Source: rl, Mutability: map[Mutability]RateLimit{Irreversible: {Requests: 1, Per: time.Hour}}})(
+				ValidateRequests(RequestValidationOptions{Source: rl})(
+					http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))))
+	post := func() int {
+		req := httptest.NewRequest("POST", "/orders", nil)
+		req.Header.Set("Accept", MediaType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	update := func(s *Safety, fields ...Field) {
+		t.Helper()
+		next := NewRegistry()
+		next.Get("/orders").Actions(Action{Rel: "create", Method: "POST", Href: "/orders", Safety: s, Fields: fields}).MustRegister()
+		next.Post("/orders").Description("Created order.").MustRegister()
+		if err := rl.Update(next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range 2 {
+		if code := post(); code != http.StatusOK {
+			t.Fatalf("v1 request %d: status = %d", i, code)
+		}
+	}
+
+	update(&Safety{Mutability: Reversible, Cost: &Cost{Amount: 5, Currency: "USD"}})
+	if code := post(); code != http.StatusPaymentRequired {
+		t.Errorf("reloaded cost: status = %d, want 402", code)
+	}
+
+	update(&Safety{Mutability: Irreversible})
+	post()
+	if code := post(); code != http.StatusTooManyRequests {
+		t.Errorf("reloaded mutability: status = %d, want 429", code)
+	}
+
+	update(&Safety{Mutability: Reversible}, Field{Name: "item", Type: "string", Required: true})
+	if code := post(); code != http.StatusUnprocessableEntity {
+		t.Errorf("reloaded fields: status = %d, want 422", code)
+	}
+}
@@ -0,0 +1,324 @@
+package hac
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxValidatedBody is the largest body ValidateRequests reads when
+// RequestValidationOptions.MaxBodyBytes is zero.
+const DefaultMaxValidatedBody = 1 << 20
+
+// RequestValidationOptions configures the ValidateRequests middleware.
+type RequestValidationOptions struct {
+	// Registry is searched for the action a request invokes; its Fields are
+	// what the request is checked against.
+	Registry *Registry
+
+	// Source, if set, supplies the registry per request and takes precedence
+	// over Registry, as in Options.
+	Source RegistrySource
+
+	// HACOnly validates only HAC requests, so other clients see no change.
+	// Any client can skip validation by not asking for HAC, so HACOnly
+	// suits rolling validation out, not protecting handlers.
+	HACOnly bool
+
+	// MaxBodyBytes caps the body read for validation. Larger bodies are
+	// rejected with 413. Defaults to DefaultMaxValidatedBody.
+	MaxBodyBytes int64
+}
+
+// ValidateRequests returns a middleware that checks requests against the
+// fields of the action they invoke, so the metadata agents read is also
+// enforced. Each field is checked for type, presence when required, enum
+// membership and the constraints of nested fields, including formats.
+//
+// Fields that are path variables of the action href are skipped. Fields
+// named in a query expression such as "{?limit}", and all fields of GET,
+// HEAD, DELETE and OPTIONS actions, are read from the query string; the rest
+// from the body. The body is read as JSON, or as a form when its
+// Content-Type is application/x-www-form-urlencoded. Any other body of an
+// action with body fields is rejected with a 415 HAC error, code
+// "unsupported_media_type".
+//
+// An invalid request is rejected with a 422 HAC error, code
+// "invalid_request", that lists every violation in x-violations and whose
+// recovery repeats the action with its fields. A body that is not JSON is
+// rejected the same way with 400.
+//
+// Place it inside Middleware, as with BudgetGuard:
+//
+//	hac.Middleware(opts)(hac.ValidateRequests(validationOpts)(mux))
+func ValidateRequests(opts RequestValidationOptions) func(http.Handler) http.Handler {
+	if opts.Registry == nil {
+		opts.Registry = NewRegistry()
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxValidatedBody
+	}
+
+	var cache atomic.Pointer[schemaCache]
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.HACOnly && !wantsHAC(r.Header.Get("Accept")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			reg := currentRegistry(opts.Source, opts.Registry)
+			a, ok := reg.MatchAction(r.Method, r.URL.Path)
+			if !ok || len(a.Fields) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c := cache.Load()
+			if c == nil || c.reg != reg {
+				c = &schemaCache{reg: reg}
+				cache.Store(c)
+			}
+			s := c.schemas(a)
+			if s.err != nil {
+				writeInvalidRequest(w, r, http.StatusInternalServerError, a, []Violation{{Message: "invalid field metadata: " + s.err.Error()}})
+				return
+			}
+			violations := checkFields(s.querySchema, queryInstance(s.query, r.URL.Query()))
+
+			if len(s.body) > 0 {
+				ct := r.Header.Get("Content-Type")
+				form := formContent(ct)
+				if !form && !jsonContent(ct) {
+					writeHACError(w, r, http.StatusUnsupportedMediaType, &HACError{
+						Code:    "unsupported_media_type",
+						Message: fmt.Sprintf("The request body has Content-Type %q; action %q accepts JSON.", ct, a.Rel),
+						Recovery: &Recovery{
+							Description: "Send the body as JSON with Content-Type: application/json.",
+							Actions:     []Action{a},
+						},
+					})
+					return
+				}
+				body, err := io.ReadAll(io.LimitReader(r.Body, opts.MaxBodyBytes+1))
+				if err != nil {
+					http.Error(w, "Bad Request", http.StatusBadRequest)
+					return
+				}
+				if int64(len(body)) > opts.MaxBodyBytes {
+					writeHACError(w, r, http.StatusRequestEntityTooLarge, &HACError{
+						Code:    "request_too_large",
+						Message: fmt.Sprintf("The request body exceeds %d bytes.", opts.MaxBodyBytes),
+					})
+					return
+				}
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{bytes.NewReader(body), r.Body}
+
+				var doc any = map[string]any{}
+				switch {
+				case form:
+					values, err := url.ParseQuery(string(body))
+					if err != nil {
+						writeInvalidRequest(w, r, http.StatusBadRequest, a, []Violation{{Message: "body is not a valid form: " + err.Error()}})
+						return
+					}
+					doc = queryInstance(s.body, values)
+				case len(bytes.TrimSpace(body)) > 0:
+					dec := json.NewDecoder(bytes.NewReader(body))
+					dec.UseNumber()
+					if err := dec.Decode(&doc); err != nil {
+						writeInvalidRequest(w, r, http.StatusBadRequest, a, []Violation{{Message: "body is not valid JSON: " + err.Error()}})
+						return
+					}
+				}
+				violations = append(violations, checkFields(s.bodySchema, doc)...)
+			}
+
+			if len(violations) > 0 {
+				writeInvalidRequest(w, r, http.StatusUnprocessableEntity, a, violations)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// splitFields sorts the fields of a into those read from the query string
+// and those read from the body, leaving out path variables.
+func splitFields(a Action) (query, body []Field) {
+	inPath := make(map[string]bool)
+	inQuery := make(map[string]bool)
+	for _, v := range templateVars(a.Href) {
+		if v.inQuery() {
+			inQuery[v.name] = true
+		} else {
+			inPath[v.name] = true
+		}
+	}
+	queryMethod := false
+	switch strings.ToUpper(a.Method) {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodOptions:
+		queryMethod = true
+	}
+	for _, f := range a.Fields {
+		switch {
+		case inPath[f.Name]:
+		case inQuery[f.Name] || queryMethod:
+			query = append(query, f)
+		default:
+			body = append(body, f)
+		}
+	}
+	return query, body
+}
+
+// schemaCache holds the compiled field schemas of the actions of one
+// registry, keyed by the first element of each action's Fields.
+type schemaCache struct {
+	reg      *Registry
+	byFields sync.Map // *Field -> *actionSchemas
+}
+
+// actionSchemas are an action's query and body fields with the schemas the
+// validator walks. err is set if the fields cannot be compiled.
+type actionSchemas struct {
+	query, body             []Field
+	querySchema, bodySchema map[string]any
+	err                     error
+}
+
+// schemas returns the compiled schemas of a, which has fields, compiling
+// them on first use.
+func (c *schemaCache) schemas(a Action) *actionSchemas {
+	key := &a.Fields[0] // shared with the registry, so stable per action
+	if s, ok := c.byFields.Load(key); ok {
+		return s.(*actionSchemas)
+	}
+	s := &actionSchemas{}
+	s.query, s.body = splitFields(a)
+	if s.querySchema, s.err = compileFields(s.query); s.err == nil {
+		s.bodySchema, s.err = compileFields(s.body)
+	}
+	actual, _ := c.byFields.LoadOrStore(key, s)
+	return actual.(*actionSchemas)
+}
+
+// compileFields converts the object schema of fields to the generic form the
+// validator walks. It returns nil if there are no fields.
+func compileFields(fields []Field) (map[string]any, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(FieldsSchema(fields))
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]any
+	err = json.Unmarshal(raw, &schema)
+	return schema, err
+}
+
+// queryInstance collects the values named by fields, from a query string or
+// form, into a JSON object, converting values to the fields' types where
+// they parse.
+func queryInstance(fields []Field, q url.Values) map[string]any {
+	obj := make(map[string]any)
+	for _, f := range fields {
+		if vals, ok := q[f.Name]; ok && len(vals) > 0 {
+			obj[f.Name] = queryValue(f, vals)
+		}
+	}
+	return obj
+}
+
+// queryValue converts query parameter values to f's type. Values that do not
+// parse are kept as strings and fail the type check.
+func queryValue(f Field, vals []string) any {
+	if f.Type == "array" {
+		item := Field{Type: "string"}
+		if f.Items != nil {
+			item = *f.Items
+		}
+		out := make([]any, len(vals))
+		for i, s := range vals {
+			out[i] = queryValue(item, []string{s})
+		}
+		return out
+	}
+	s := vals[0]
+	switch f.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+// checkFields validates instance against a schema from compileFields.
+// Missing required fields are reported at the field's own path.
+func checkFields(schema map[string]any, instance any) []Violation {
+	if schema == nil {
+		return nil
+	}
+	v := &validator{formats: true}
+	v.validate("", schema, instance, "")
+	for i, vi := range v.violations {
+		quoted, ok := strings.CutPrefix(vi.Message, "missing required property ")
+		if name, err := strconv.Unquote(quoted); ok && err == nil {
+			v.violations[i] = Violation{Path: vi.Path + "/" + escapePointer(name), Message: "is required"}
+		}
+	}
+	return v.violations
+}
+
+// jsonContent reports whether a request body with Content-Type ct is JSON.
+// A missing Content-Type is treated as JSON.
+func jsonContent(ct string) bool {
+	mt, _, _ := strings.Cut(ct, ";")
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	return mt == "" || mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// formContent reports whether a request body with Content-Type ct is a
+// URL-encoded form.
+func formContent(ct string) bool {
+	mt, _, _ := strings.Cut(ct, ";")
+	return strings.EqualFold(strings.TrimSpace(mt), "application/x-www-form-urlencoded")
+}
+
+// writeInvalidRequest rejects a request whose input does not match the
+// fields of action a.
+func writeInvalidRequest(w http.ResponseWriter, r *http.Request, status int, a Action, violations []Violation) {
+	msgs := make([]string, len(violations))
+	for i, v := range violations {
+		if v.Path == "" {
+			msgs[i] = v.Message
+		} else {
+			msgs[i] = v.Path + ": " + v.Message
+		}
+	}
+	writeHACError(w, r, status, &HACError{
+		Code:       "invalid_request",
+		Message:    fmt.Sprintf("The request does not match the fields of action %q: %s.", a.Rel, strings.Join(msgs, "; ")),
+		Violations: violations,
+		Recovery: &Recovery{
+			Description: "Correct the listed fields and send the request again. The action below describes every accepted field.",
+			Actions:     []Action{a},
+		},
+	})
+}
@@ -0,0 +1,199 @@
+package hac
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testValidatedRegistry() *Registry {
+	maxSeats := 10.0
+	reg := NewRegistry()
+	reg.Get("/users/{id}").Actions(
+		Action{Rel: "upgrade", Method: "POST", Href: "/users/{id}/upgrade{?notify}", Fields: []Field{
+			{Name: "id", Type: "string", Required: true},
+			{Name: "notify", Type: "boolean"},
+			{Name: "plan", Type: "string", Required: true, Enum: []any{"pro", "enterprise"}},
+			{Name: "seats", Type: "integer", Maximum: &maxSeats},
+			{Name: "billing", Type: "object", Properties: []Field{
+				{Name: "email", Type: "string", Required: true, Format: FormatEmail},
+			}},
+		}},
+		Action{Rel: "orders", Method: "GET", Href: "/users/{id}/orders", Fields: []Field{
+			{Name: "limit", Type: "integer"},
+			{Name: "status", Type: "array", Items: &Field{Type: "string", Enum: []any{"open", "paid"}}},
+		}},
+	).MustRegister()
+	return reg
+}
+
+func TestValidateRequests(t *testing.T) {
+	var gotBody string
+	h := ValidateRequests(RequestValidationOptions{Registry: testValidatedRegistry()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			gotBody = string(b)
+			w.Write([]byte(`{}`))
+		}))
+
+	tests := []struct {
+		name, method, target, body, contentType string
+		accept                                  string
+		wantStatus                              int
+		wantPaths                               []string
+	}{
+		{name: "valid body", method: "POST", target: "/users/7/upgrade?notify=true",
+			body: `{"plan":"pro","seats":5,"billing":{"email":"ops@example.com"}}`, wantStatus: 200},
+		{name: "body violations", method: "POST", target: "/users/7/upgrade?notify=maybe",
+			body: `{"seats":11,"billing":{"email":"not-an-email"},"extra":1}`, wantStatus: 422,
+			wantPaths: []string{"/notify", "/plan", "/billing/email", "/seats"}},
+		{name: "wrong enum and type", method: "POST", target: "/users/7/upgrade",
+			body: `{"plan":"free","seats":"2"}`, wantStatus: 422, wantPaths: []string{"/plan", "/seats"}},
+		{name: "empty body", method: "POST", target: "/users/7/upgrade", wantStatus: 422, wantPaths: []string{"/plan"}},
+		{name: "malformed body", method: "POST", target: "/users/7/upgrade", body: `{"plan":`, wantStatus: 400, wantPaths: []string{""}},
+		{name: "valid form", method: "POST", target: "/users/7/upgrade", body: `plan=pro&seats=3`,
+			contentType: "application/x-www-form-urlencoded", wantStatus: 200},
+		{name: "form violations", method: "POST", target: "/users/7/upgrade", body: `plan=free&seats=many`,
+			contentType: "application/x-www-form-urlencoded; charset=utf-8", wantStatus: 422, wantPaths: []string{"/plan", "/seats"}},
+		{name: "valid query", method: "GET", target: "/users/7/orders?limit=5&status=open&status=paid", wantStatus: 200},
+		{name: "query violations", method: "GET", target: "/users/7/orders?limit=five&status=lost", wantStatus: 422,
+			wantPaths: []string{"/limit", "/status/0"}},
+		{name: "non-HAC request", method: "POST", target: "/users/7/upgrade", accept: "application/json", wantStatus: 422,
+			wantPaths: []string{"/plan"}},
+		{name: "no matching action", method: "POST", target: "/other", wantStatus: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.accept == "" {
+				tt.accept = MediaType
+			}
+			req.Header.Set("Accept", tt.accept)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			gotBody = ""
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == 200 {
+				if gotBody != tt.body {
+					t.Errorf("handler read body %q, want %q", gotBody, tt.body)
+				}
+				return
+			}
+			var env ErrorEnvelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, v := range env.Error.Violations {
+				paths = append(paths, v.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("violation paths = %q, want %q\n%s", paths, tt.wantPaths, env.Error.Message)
+			}
+			if env.Error.Code != "invalid_request" || env.Error.Recovery == nil ||
+				len(env.Error.Recovery.Actions) != 1 || len(env.Error.Recovery.Actions[0].Fields) == 0 {
+				t.Errorf("error = %+v", env.Error)
+			}
+		})
+	}
+}
+
+func TestValidateRequestsInMiddleware(t *testing.T) {
+	reg := testValidatedRegistry()
+	reg.Post("/users/{id}/upgrade").Description("Upgrade a user.").MustRegister()
+	resolve := func(*http.Request) string { return "/users/{id}/upgrade" }
+	h := Middleware(Options{Registry: reg, PathResolver: resolve})(ValidateRequests(RequestValidationOptions{Registry: reg})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("handler called for an invalid request")
+		})))
+
+	req := httptest.NewRequest("POST", "/users/7/upgrade", strings.NewReader(`{"plan":"free"}`))
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	want := `"x-violations":[{"path":"/plan","message":"must be one of [\"pro\",\"enterprise\"]"}]`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("body = %s\nwant it to contain %s", rec.Body, want)
+	}
+	if err := Validate(rec.Body.Bytes()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateRequestsUnsupportedMediaType(t *testing.T) {
+	called := false
+	h := ValidateRequests(RequestValidationOptions{Registry: testValidatedRegistry()})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	req := httptest.NewRequest("POST", "/users/7/upgrade", strings.NewReader(`{"plan":"free"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var env ErrorEnvelope
+	json.Unmarshal(rec.Body.Bytes(), &env)
+	if rec.Code != http.StatusUnsupportedMediaType || called || env.Error == nil || env.Error.Code != "unsupported_media_type" {
+		t.Errorf("status = %d, handler called = %v, body = %s", rec.Code, called, rec.Body)
+	}
+}
+
+func TestValidateRequestsHACOnly(t *testing.T) {
+	h := ValidateRequests(RequestValidationOptions{Registry: testValidatedRegistry(), HACOnly: true})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for accept, want := range map[string]int{"application/json": 200, MediaType: 422} {
+		req := httptest.NewRequest("POST", "/users/7/upgrade", strings.NewReader(`{}`))
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Accept %s: status = %d, want %d", accept, rec.Code, want)
+		}
+	}
+}
+
+func TestValidateRequestsBodyLimit(t *testing.T) {
+	h := ValidateRequests(RequestValidationOptions{Registry: testValidatedRegistry(), MaxBodyBytes: 8})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("POST", "/users/7/upgrade", strings.NewReader(`{"plan":"pro"}`))
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d", rec.Code)
+	}
+}
+
+func TestValidFormat(t *testing.T) {
+	tests := []struct {
+		format, value string
+		want          bool
+	}{
+		{FormatEmail, "ops@example.com", true},
+		{FormatEmail, "Ops <ops@example.com>", false},
+		{FormatURI, "https://example.com/a", true},
+		{FormatURI, "/relative", false},
+		{FormatDateTime, "2026-10-18T09:30:00Z", true},
+		{FormatDateTime, "2026-10-18", false},
+		{FormatUUID, "5f0c2f4e-8a5b-4c1e-9d2a-3b4c5d6e7f80", true},
+		{FormatUUID, "5f0c2f4e", false},
+		{"hostname", "anything", true},
+	}
+	for _, tt := range tests {
+		if got := validFormat(tt.format, tt.value); got != tt.want {
+			t.Errorf("validFormat(%q, %q) = %v", tt.format, tt.value, got)
+		}
+	}
+}
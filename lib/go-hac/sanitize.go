@@ -0,0 +1,302 @@
+package hac
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// DefaultMaxDescriptionLength is the rune limit applied by a Sanitizer whose
+// MaxLength is zero.
+const DefaultMaxDescriptionLength = 1000
+
+// DefaultInjectionThreshold is the score at or above which a Sanitizer flags a
+// description as a likely prompt-injection attempt.
+const DefaultInjectionThreshold = 0.5
+
+// Sanitizer cleans untrusted HAC text before it is handed to an LLM. Spec §9.3
+// requires agents to treat every description as untrusted data; a Sanitizer
+// strips control characters, invisible Unicode and markdown/HTML markup,
+// enforces a length limit, and scores each text for instruction-like phrasing.
+//
+// The zero value is ready to use.
+type Sanitizer struct {
+	// MaxLength caps each text in runes. Defaults to DefaultMaxDescriptionLength.
+	MaxLength int
+
+	// Threshold is the injection score at or above which a finding is flagged.
+	// Defaults to DefaultInjectionThreshold.
+	Threshold float64
+}
+
+// SanitizeFinding reports what a Sanitizer did to a single text value.
+type SanitizeFinding struct {
+	// Path locates the value, e.g. "actions[0].fields[1].description".
+	Path string `json:"path"`
+
+	// Modified is true if control characters, invisible Unicode or markup
+	// were removed.
+	Modified bool `json:"modified,omitempty"`
+
+	// Truncated is true if the text exceeded MaxLength.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Score estimates how instruction-like the text is, from 0 to 1.
+	Score float64 `json:"score,omitempty"`
+
+	// Matches names the injection heuristics that contributed to Score.
+	Matches []string `json:"matches,omitempty"`
+
+	// Flagged is true if Score reached the Sanitizer's threshold.
+	Flagged bool `json:"flagged,omitempty"`
+}
+
+// Meta sanitizes every description and precondition in meta in place and
+// returns a finding for each value that was changed or scored above zero.
+func (s *Sanitizer) Meta(meta *HACMeta) []SanitizeFinding {
+	if meta == nil {
+		return nil
+	}
+	w := s.walker()
+	w.text("description", &meta.Description)
+	w.actions("actions", meta.Actions)
+	for i := range meta.Related {
+		w.text(fmt.Sprintf("related[%d].description", i), &meta.Related[i].Description)
+	}
+	return w.findings
+}
+
+// Error sanitizes the message and recovery guidance of e in place.
+func (s *Sanitizer) Error(e *HACError) []SanitizeFinding {
+	if e == nil {
+		return nil
+	}
+	w := s.walker()
+	w.text("error.message", &e.Message)
+	if e.Recovery != nil {
+		w.text("error.recovery.description", &e.Recovery.Description)
+		w.actions("error.recovery.actions", e.Recovery.Actions)
+	}
+	return w.findings
+}
+
+// Discovery sanitizes the API and resource descriptions of d in place.
+func (s *Sanitizer) Discovery(d *DiscoveryMeta) []SanitizeFinding {
+	if d == nil {
+		return nil
+	}
+	w := s.walker()
+	w.text("description", &d.Description)
+	for i := range d.Resources {
+		w.text(fmt.Sprintf("resources[%d].description", i), &d.Resources[i].Description)
+	}
+	return w.findings
+}
+
+// Text returns text with control characters, invisible Unicode and markup
+// removed, whitespace collapsed, and the result truncated to MaxLength.
+func (s *Sanitizer) Text(text string) string {
+	out, _, _ := s.clean(text)
+	return out
+}
+
+func (s *Sanitizer) maxLength() int {
+	if s.MaxLength > 0 {
+		return s.MaxLength
+	}
+	return DefaultMaxDescriptionLength
+}
+
+func (s *Sanitizer) threshold() float64 {
+	if s.Threshold > 0 {
+		return s.Threshold
+	}
+	return DefaultInjectionThreshold
+}
+
+// clean sanitizes text and reports whether anything besides whitespace was
+// removed and whether the result was truncated.
+func (s *Sanitizer) clean(text string) (out string, modified, truncated bool) {
+	out = collapseSpace(stripMarkup(stripInvisible(text)))
+	modified = out != collapseSpace(text)
+
+	if runes := []rune(out); len(runes) > s.maxLength() {
+		out = strings.TrimSpace(string(runes[:s.maxLength()-1])) + "…"
+		truncated = true
+	}
+	return out, modified, truncated
+}
+
+func (s *Sanitizer) walker() *sanitizeWalker {
+	return &sanitizeWalker{s: s}
+}
+
+// sanitizeWalker accumulates findings while sanitizing nested structures.
+type sanitizeWalker struct {
+	s        *Sanitizer
+	findings []SanitizeFinding
+}
+
+func (w *sanitizeWalker) text(path string, p *string) {
+	if *p == "" {
+		return
+	}
+	score, matches := InjectionScore(*p)
+	out, modified, truncated := w.s.clean(*p)
+	*p = out
+	if !modified && !truncated && score == 0 {
+		return
+	}
+	w.findings = append(w.findings, SanitizeFinding{
+		Path:      path,
+		Modified:  modified,
+		Truncated: truncated,
+		Score:     score,
+		Matches:   matches,
+		Flagged:   score >= w.s.threshold(),
+	})
+}
+
+func (w *sanitizeWalker) actions(path string, actions []Action) {
+	for i := range actions {
+		a := &actions[i]
+		prefix := fmt.Sprintf("%s[%d]", path, i)
+		w.text(prefix+".description", &a.Description)
+		if a.Safety != nil && a.Safety.Cost != nil {
+			w.text(prefix+".safety.cost.description", &a.Safety.Cost.Description)
+		}
+		w.fields(prefix+".fields", a.Fields)
+		for j := range a.Preconditions {
+			w.text(fmt.Sprintf("%s.preconditions[%d]", prefix, j), &a.Preconditions[j])
+		}
+	}
+}
+
+// fields sanitizes field descriptions, descending into array items and
+// object properties.
+func (w *sanitizeWalker) fields(path string, fields []Field) {
+	for i := range fields {
+		w.field(fmt.Sprintf("%s[%d]", path, i), &fields[i])
+	}
+}
+
+func (w *sanitizeWalker) field(path string, f *Field) {
+	w.text(path+".description", &f.Description)
+	if f.Items != nil {
+		w.field(path+".items", f.Items)
+	}
+	w.fields(path+".properties", f.Properties)
+}
+
+// stripInvisible removes control characters (other than newlines), format
+// characters such as zero-width spaces and bidi overrides, variation
+// selectors, and private-use code points.
+func stripInvisible(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t' || r == '\r':
+			return ' '
+		case unicode.IsControl(r),
+			unicode.Is(unicode.Cf, r),
+			unicode.Is(unicode.Co, r),
+			unicode.Is(unicode.Variation_Selector, r),
+			r == unicode.ReplacementChar:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+var (
+	htmlCommentRe = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlTagRe     = regexp.MustCompile(`</?[a-zA-Z][^<>]*>`)
+	mdImageRe     = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkRe      = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdEmphasisRe  = regexp.MustCompile("\\*\\*|__|~~|`+")
+	mdLineStartRe = regexp.MustCompile(`(?m)^\s*(?:#{1,6}\s+|>\s*|[-*+]\s+)`)
+)
+
+// stripMarkup removes HTML tags and comments and reduces markdown to its
+// plain-text content. Entities are decoded first so encoded tags are stripped
+// too.
+func stripMarkup(s string) string {
+	s = html.UnescapeString(s)
+	s = htmlCommentRe.ReplaceAllString(s, " ")
+	s = htmlTagRe.ReplaceAllString(s, " ")
+	s = mdImageRe.ReplaceAllString(s, "$1")
+	s = mdLinkRe.ReplaceAllString(s, "$1")
+	s = mdLineStartRe.ReplaceAllString(s, "")
+	s = mdEmphasisRe.ReplaceAllString(s, "")
+	return s
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// injectionRule is a weighted heuristic for instruction-like phrasing.
+// Rules marked multiline match against the text with line breaks preserved.
+type injectionRule struct {
+	name      string
+	weight    float64
+	multiline bool
+	re        *regexp.Regexp
+}
+
+var injectionRules = []injectionRule{
+	{"override-instructions", 0.9, false, regexp.MustCompile(`(?i)\b(ignore|disregard|override|forget)\b.{0,30}\b(previous|prior|above|earlier|all|your|system)\b.{0,20}\b(instructions?|prompts?|rules|guidelines|context)\b`)},
+	{"role-reassignment", 0.6, false, regexp.MustCompile(`(?i)\b(you are now|from now on,? you|act as|pretend (to be|you are)|roleplay as)\b`)},
+	{"prompt-reference", 0.6, false, regexp.MustCompile(`(?i)\b(system prompt|developer message|hidden instructions?|new instructions?)\b`)},
+	{"role-marker", 0.8, true, regexp.MustCompile(`(?im)^\s*(system|assistant|user)\s*:|<\|im_start\|>|\[/?INST\]`)},
+	{"conceal-from-user", 0.7, false, regexp.MustCompile(`(?i)\b(do not|don't|never)\s+(tell|inform|notify|ask|show)\s+(the\s+)?user\b`)},
+	{"skip-confirmation", 0.6, false, regexp.MustCompile(`(?i)\bwithout\s+(asking|confirming|confirmation|user (confirmation|approval)|approval)\b`)},
+	{"imperative-invoke", 0.4, false, regexp.MustCompile(`(?i)\b(you must|always|immediately)\s+(call|invoke|execute|run|send|delete|transfer)\b`)},
+	{"code-execution", 0.7, false, regexp.MustCompile(`(?i)\b(execute|run|eval)\s+(this|the following)\s+(code|command|script)\b`)},
+	{"exfiltration", 0.8, false, regexp.MustCompile(`(?i)\b(send|post|forward|upload|exfiltrate|reveal)\b.{0,40}\b(credentials?|api[ _-]?keys?|tokens?|passwords?|secrets?)\b`)},
+}
+
+// InjectionScore estimates how strongly text reads as instructions to an
+// agent rather than a description of an API. It returns a score from 0 to 1
+// and the names of the heuristics that matched. Invisible characters are
+// removed before matching so they cannot be used to split trigger phrases.
+func InjectionScore(text string) (float64, []string) {
+	lines := stripInvisible(text)
+	flat := collapseSpace(lines)
+	miss := 1.0
+	var matches []string
+	for _, rule := range injectionRules {
+		target := flat
+		if rule.multiline {
+			target = lines
+		}
+		if rule.re.MatchString(target) {
+			miss *= 1 - rule.weight
+			matches = append(matches, rule.name)
+		}
+	}
+	return 1 - miss, matches
+}
+
+// QuoteForPrompt wraps untrusted text in clearly delimited quoting so it can
+// be placed in an LLM prompt as data. The label identifies where the text came
+// from. Delimiter sequences inside text and label are neutralized so the
+// quoted block cannot be closed early.
+func QuoteForPrompt(label, text string) string {
+	neutral := strings.NewReplacer("<<<", "‹‹‹", ">>>", "›››")
+	label = neutral.Replace(collapseSpace(stripInvisible(label)))
+	text = neutral.Replace(text)
+
+	var b strings.Builder
+	b.WriteString("<<<UNTRUSTED HAC TEXT")
+	if label != "" {
+		fmt.Fprintf(&b, " source=%q", label)
+	}
+	b.WriteString(">>>\n")
+	b.WriteString(text)
+	b.WriteString("\n<<<END UNTRUSTED HAC TEXT>>>")
+	return b.String()
+}
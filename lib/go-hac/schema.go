@@ -0,0 +1,57 @@
+package hac
+
+// Schema is the subset of JSON Schema used to describe action inputs to
+// tool-calling models and other schema-driven consumers.
+type Schema struct {
+	Type        string             `json:"type,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	Default     any                `json:"default,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Minimum     *float64           `json:"minimum,omitempty"`
+	Maximum     *float64           `json:"maximum,omitempty"`
+	MinLength   *int               `json:"minLength,omitempty"`
+	MaxLength   *int               `json:"maxLength,omitempty"`
+}
+
+// FieldSchema converts a single Field, including its items and properties,
+// to JSON Schema. The field's Required flag is not part of the result; it
+// belongs to the enclosing object.
+func FieldSchema(f Field) *Schema {
+	s := &Schema{
+		Type:        f.Type,
+		Description: f.Description,
+		Enum:        f.Enum,
+		Default:     f.Default,
+		Format:      f.Format,
+		Pattern:     f.Pattern,
+		Minimum:     f.Minimum,
+		Maximum:     f.Maximum,
+		MinLength:   f.MinLength,
+		MaxLength:   f.MaxLength,
+	}
+	if f.Items != nil {
+		s.Items = FieldSchema(*f.Items)
+	}
+	if len(f.Properties) > 0 {
+		obj := FieldsSchema(f.Properties)
+		s.Properties, s.Required = obj.Properties, obj.Required
+	}
+	return s
+}
+
+// FieldsSchema builds an object schema whose properties are the given fields.
+func FieldsSchema(fields []Field) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema, len(fields))}
+	for _, f := range fields {
+		s.Properties[f.Name] = FieldSchema(f)
+		if f.Required {
+			s.Required = append(s.Required, f.Name)
+		}
+	}
+	return s
+}
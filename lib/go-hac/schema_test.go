@@ -0,0 +1,44 @@
+package hac
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFieldsSchema(t *testing.T) {
+	s := FieldsSchema([]Field{
+		{Name: "plan", Type: "string", Required: true, Enum: []any{"pro", "enterprise"}, Description: "Target plan."},
+		{Name: "seats", Type: "integer", Default: 1},
+	})
+
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"type":"object","properties":{"plan":{"type":"string","description":"Target plan.","enum":["pro","enterprise"]},"seats":{"type":"integer","default":1}},"required":["plan"]}`
+	if string(out) != want {
+		t.Errorf("schema = %s\nwant     %s", out, want)
+	}
+}
+
+func TestFieldsSchemaNested(t *testing.T) {
+	one := 1
+	s := FieldsSchema([]Field{
+		{Name: "lines", Type: "array", Required: true, Items: &Field{Type: "object", Properties: []Field{
+			{Name: "sku", Type: "string", Required: true, Pattern: "^[A-Z]+$"},
+			{Name: "qty", Type: "integer", Minimum: new(float64)},
+		}}},
+		{Name: "email", Type: "string", Format: FormatEmail, MinLength: &one},
+	})
+
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"type":"object","properties":{"email":{"type":"string","format":"email","minLength":1},` +
+		`"lines":{"type":"array","items":{"type":"object","properties":{"qty":{"type":"integer","minimum":0},` +
+		`"sku":{"type":"string","pattern":"^[A-Z]+$"}},"required":["sku"]}}},"required":["lines"]}`
+	if string(out) != want {
+		t.Errorf("schema = %s\nwant     %s", out, want)
+	}
+}
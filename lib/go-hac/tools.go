@@ -0,0 +1,233 @@
+package hac
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tool is an LLM function-calling tool definition derived from a HAC action.
+// It marshals to the name/description/parameters shape used by most
+// tool-calling APIs.
+type Tool struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Parameters  *Schema `json:"parameters"`
+
+	// Action is the HAC action the tool invokes. Path parameters named in
+	// PathParams are expanded into Action.Href; the remaining arguments
+	// belong in the query string for GET, HEAD and DELETE, or in the JSON body
+	// otherwise.
+	Action Action `json:"-"`
+
+	// PathParams lists the href template variables that must be expanded
+	// into the path.
+	PathParams []string `json:"-"`
+}
+
+// ToolsFromRegistry exports every action declared in reg as a tool. Routes
+// that no action describes are exported too, so an endpoint registered with
+// only a description is still callable.
+func ToolsFromRegistry(reg *Registry) []Tool {
+	actions := reg.Actions()
+	covered := make(map[routeKey]bool, len(actions))
+	for _, a := range actions {
+		covered[routeKey{method: a.Method, pattern: a.Href}] = true
+	}
+	for _, pair := range sortedRoutes(reg) {
+		method, path := pair[0], routePath(pair[1])
+		if covered[routeKey{method: method, pattern: path}] {
+			continue
+		}
+		covered[routeKey{method: method, pattern: path}] = true
+		a := Action{
+			Rel:    strings.ToLower(method) + "-" + deriveRel(path),
+			Method: method,
+			Href:   path,
+		}
+		if cfg := reg.Lookup(pair[0], pair[1]); cfg != nil {
+			a.Description = cfg.Description
+		}
+		actions = append(actions, a)
+	}
+	return ToolsFromActions(actions)
+}
+
+// ToolsFromMeta exports the actions in a fetched HAC envelope as tools so an
+// agent can hand live actions to a model.
+func ToolsFromMeta(meta *HACMeta) []Tool {
+	if meta == nil {
+		return nil
+	}
+	return ToolsFromActions(meta.Actions)
+}
+
+// ToolsFromActions converts actions to tools. Tool names are derived from
+// each action's rel and made unique within the returned slice.
+func ToolsFromActions(actions []Action) []Tool {
+	tools := make([]Tool, 0, len(actions))
+	used := make(map[string]bool, len(actions))
+	for _, a := range actions {
+		t := actionTool(a)
+		t.Name = uniqueToolName(a, used)
+		tools = append(tools, t)
+	}
+	return tools
+}
+
+func actionTool(a Action) Tool {
+	params := FieldsSchema(a.Fields)
+	var pathParams []string
+	for _, v := range templateVars(a.Href) {
+		if !v.inQuery() {
+			pathParams = append(pathParams, v.name)
+		}
+		if _, ok := params.Properties[v.name]; !ok {
+			params.Properties[v.name] = &Schema{
+				Type:        "string",
+				Description: fmt.Sprintf("Value for {%s} in %s.", v.name, a.Href),
+			}
+		}
+		if !v.inQuery() && !slices.Contains(params.Required, v.name) {
+			params.Required = append(params.Required, v.name)
+		}
+	}
+
+	return Tool{
+		Description: toolDescription(a),
+		Parameters:  params,
+		Action:      a,
+		PathParams:  pathParams,
+	}
+}
+
+// toolDescription combines the action description with its safety metadata,
+// cost and preconditions so the model sees them when choosing tools.
+func toolDescription(a Action) string {
+	var b strings.Builder
+	if a.Description != "" {
+		b.WriteString(a.Description)
+	} else {
+		fmt.Fprintf(&b, "%s %s", a.Method, a.Href)
+	}
+
+	if s := a.Safety; s != nil {
+		var parts []string
+		if s.Mutability != "" {
+			parts = append(parts, "mutability="+string(s.Mutability))
+		}
+		if s.BlastRadius != "" {
+			parts = append(parts, "blast_radius="+string(s.BlastRadius))
+		}
+		if s.ReversibleWithin != "" {
+			parts = append(parts, "reversible_within="+s.ReversibleWithin)
+		}
+		if len(parts) > 0 {
+			b.WriteString("\n\nSafety: " + strings.Join(parts, "; ") + ".")
+		}
+		if s.ConfirmationRecommended {
+			b.WriteString("\nConfirm with the user before calling this tool.")
+		}
+		if c := s.Cost; c != nil {
+			fmt.Fprintf(&b, "\nCost: %s %s", strconv.FormatFloat(c.Amount, 'f', -1, 64), c.Currency)
+			if c.Description != "" {
+				fmt.Fprintf(&b, " (%s)", c.Description)
+			}
+			b.WriteString(". Do not call without user authorization for this spend.")
+		}
+	} else if !isSafeMethod(a.Method) {
+		b.WriteString("\n\nSafety: unspecified; treat as state-changing.")
+	}
+
+	if len(a.Preconditions) > 0 {
+		b.WriteString("\nPreconditions: " + strings.Join(a.Preconditions, "; ") + ".")
+	}
+	if a.Idempotent {
+		b.WriteString("\nSend a unique " + IdempotencyKeyHeader + " header and reuse it when retrying.")
+	}
+	return b.String()
+}
+
+// uniqueToolName derives a tool name from a's rel that matches the common
+// ^[a-zA-Z0-9_-]{1,64}$ constraint and is not yet in used.
+func uniqueToolName(a Action, used map[string]bool) string {
+	base := toolNameToken(a.Rel)
+	if base == "" {
+		base = strings.ToLower(a.Method)
+	}
+	candidates := []string{base}
+	if resource := toolNameToken(strings.Join(staticSegments(a.Href), "_")); resource != "" {
+		candidates = append(candidates, base+"_"+resource)
+	}
+	for _, c := range candidates {
+		c = truncateToolName(c)
+		if !used[c] {
+			used[c] = true
+			return c
+		}
+	}
+	last := candidates[len(candidates)-1]
+	for i := 2; ; i++ {
+		suffix := "_" + strconv.Itoa(i)
+		c := truncateToolName(last[:min(len(last), 64-len(suffix))] + suffix)
+		if !used[c] {
+			used[c] = true
+			return c
+		}
+	}
+}
+
+// toolNameToken replaces characters not allowed in tool names with
+// underscores and trims leading and trailing separators. A rel that is a URI
+// contributes only its last path segment.
+func toolNameToken(s string) string {
+	if strings.Contains(s, "://") {
+		s = s[strings.LastIndexByte(strings.TrimSuffix(s, "/"), '/')+1:]
+	}
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+	return strings.Trim(s, "_-")
+}
+
+func truncateToolName(s string) string {
+	if len(s) > 64 {
+		return s[:64]
+	}
+	return s
+}
+
+// staticSegments returns the non-template path segments of href.
+func staticSegments(href string) []string {
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	if i := strings.Index(href, "://"); i >= 0 {
+		href = href[i+3:]
+		if j := strings.IndexByte(href, '/'); j >= 0 {
+			href = href[j:]
+		}
+	}
+	var segs []string
+	for _, seg := range strings.Split(href, "/") {
+		if seg != "" && !strings.ContainsAny(seg, "{}") {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
+}
+
+// isSafeMethod reports whether method is safe per RFC 9110 §9.2.1.
+func isSafeMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
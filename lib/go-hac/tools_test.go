@@ -0,0 +1,158 @@
+package hac
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestToolsFromActions(t *testing.T) {
+	tools := ToolsFromActions([]Action{{
+		Rel:         "upgrade",
+		Method:      "POST",
+		Href:        "/users/{id}/subscription/upgrade",
+		Description: "Upgrade the user's subscription.",
+		Safety: &Safety{
+			Mutability:              Reversible,
+			ReversibleWithin:        "P14D",
+			BlastRadius:             Self,
+			ConfirmationRecommended: true,
+			Cost:                    &Cost{Amount: 29.99, Currency: "USD", Description: "Monthly Pro plan"},
+		},
+		Fields: []Field{
+			{Name: "plan", Type: "string", Required: true, Enum: []any{"pro", "enterprise"}},
+		},
+		Preconditions: []string{"User must have a payment method"},
+	}})
+
+	if len(tools) != 1 {
+		t.Fatalf("tools count = %d, want 1", len(tools))
+	}
+	tool := tools[0]
+	if tool.Name != "upgrade" {
+		t.Errorf("name = %q", tool.Name)
+	}
+	for _, want := range []string{
+		"Upgrade the user's subscription.",
+		"mutability=reversible",
+		"reversible_within=P14D",
+		"Confirm with the user",
+		"Cost: 29.99 USD (Monthly Pro plan)",
+		"Preconditions: User must have a payment method.",
+	} {
+		if !strings.Contains(tool.Description, want) {
+			t.Errorf("description missing %q:\n%s", want, tool.Description)
+		}
+	}
+
+	p := tool.Parameters
+	if p.Type != "object" {
+		t.Errorf("parameters type = %q", p.Type)
+	}
+	if p.Properties["id"] == nil || p.Properties["id"].Type != "string" {
+		t.Errorf("missing path parameter schema: %+v", p.Properties["id"])
+	}
+	if len(p.Required) != 2 || p.Required[0] != "plan" || p.Required[1] != "id" {
+		t.Errorf("required = %v, want [plan id]", p.Required)
+	}
+	if len(tool.PathParams) != 1 || tool.PathParams[0] != "id" {
+		t.Errorf("path params = %v", tool.PathParams)
+	}
+
+	out, err := json.Marshal(tool)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var parsed map[string]any
+	json.Unmarshal(out, &parsed)
+	if _, ok := parsed["parameters"]; !ok {
+		t.Error("marshaled tool missing parameters")
+	}
+	if len(parsed) != 3 {
+		t.Errorf("marshaled tool keys = %v, want name/description/parameters", parsed)
+	}
+}
+
+func TestToolsFromActionsUniqueNames(t *testing.T) {
+	tools := ToolsFromActions([]Action{
+		{Rel: "delete", Method: "DELETE", Href: "/users/{id}"},
+		{Rel: "delete", Method: "DELETE", Href: "/orders/{id}"},
+		{Rel: "delete", Method: "DELETE", Href: "/orders/{id}?hard=true"},
+		{Rel: "https://api.example.com/rels/deactivate", Method: "POST", Href: "/users/{id}/deactivate"},
+	})
+
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Name
+	}
+	want := []string{"delete", "delete_orders", "delete_orders_2", "deactivate"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("names = %v, want %v", names, want)
+			break
+		}
+	}
+}
+
+func TestToolsUnspecifiedSafety(t *testing.T) {
+	tools := ToolsFromActions([]Action{
+		{Rel: "self", Method: "GET", Href: "/users/1"},
+		{Rel: "purge", Method: "POST", Href: "/purge"},
+	})
+	if strings.Contains(tools[0].Description, "Safety") {
+		t.Errorf("GET without safety should not be flagged: %q", tools[0].Description)
+	}
+	if !strings.Contains(tools[1].Description, "treat as state-changing") {
+		t.Errorf("POST without safety should be flagged: %q", tools[1].Description)
+	}
+}
+
+func TestToolsIdempotent(t *testing.T) {
+	tools := ToolsFromActions([]Action{{Rel: "pay", Method: "POST", Href: "/payments", Idempotent: true}})
+	if !strings.Contains(tools[0].Description, "Idempotency-Key") {
+		t.Errorf("description = %q, want Idempotency-Key guidance", tools[0].Description)
+	}
+}
+
+func TestToolsFromRegistry(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users/{id}").
+		Description("A user.").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"}).
+		MustRegister()
+	reg.Get("/orders/{id}").
+		Description("An order.").
+		Actions(Action{Rel: "delete", Method: "DELETE", Href: "/users/{id}"}).
+		MustRegister()
+	reg.Route("POST", "POST /orders").Description("Create an order.").MustRegister()
+
+	tools := ToolsFromRegistry(reg)
+
+	byName := make(map[string]Tool)
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+	if len(tools) != 4 {
+		t.Errorf("tools = %v, want 4 (1 deduplicated action + 3 routes)", byName)
+	}
+	if _, ok := byName["delete"]; !ok {
+		t.Error("missing delete tool")
+	}
+	create, ok := byName["post-orders"]
+	if !ok {
+		t.Fatalf("missing route-derived tool, have %v", byName)
+	}
+	if create.Action.Href != "/orders" || create.Description != "Create an order.\n\nSafety: unspecified; treat as state-changing." {
+		t.Errorf("route tool = %+v", create)
+	}
+}
+
+func TestToolsFromMeta(t *testing.T) {
+	if ToolsFromMeta(nil) != nil {
+		t.Error("expected nil for nil meta")
+	}
+	tools := ToolsFromMeta(&HACMeta{Actions: []Action{{Rel: "edit", Method: "PATCH", Href: "/users/1"}}})
+	if len(tools) != 1 || tools[0].Name != "edit" {
+		t.Errorf("tools = %+v", tools)
+	}
+}
@@ -0,0 +1,194 @@
+package hac
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// W3C Trace Context headers.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// Span names used by Middleware.
+const (
+	// SpanHandler covers the wrapped handler.
+	SpanHandler = "hac.handler"
+
+	// SpanEnvelope covers building, encoding and validating the envelope.
+	SpanEnvelope = "hac.envelope"
+)
+
+// TraceContext is a W3C Trace Context: the traceparent fields and the
+// opaque tracestate.
+type TraceContext struct {
+	// TraceID is 32 lowercase hex digits.
+	TraceID string
+
+	// ParentID is the 16-hex-digit ID of the caller's span.
+	ParentID string
+
+	Flags byte
+
+	// State is the tracestate header, forwarded as is.
+	State string
+}
+
+// ParseTraceparent parses traceparent and tracestate header values. It
+// reports false if traceparent is missing or malformed, in which case the
+// trace must be restarted.
+func ParseTraceparent(traceparent, tracestate string) (TraceContext, bool) {
+	tp := strings.TrimSpace(traceparent)
+	if len(tp) < 55 || (len(tp) > 55 && tp[55] != '-') {
+		return TraceContext{}, false
+	}
+	version, traceID, parentID, flags := tp[0:2], tp[3:35], tp[36:52], tp[53:55]
+	if tp[2] != '-' || tp[35] != '-' || tp[52] != '-' {
+		return TraceContext{}, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(tp) != 55) {
+		return TraceContext{}, false
+	}
+	if !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		!isLowerHex(parentID) || parentID == strings.Repeat("0", 16) ||
+		!isLowerHex(flags) {
+		return TraceContext{}, false
+	}
+	f, _ := hex.DecodeString(flags)
+	return TraceContext{
+		TraceID:  traceID,
+		ParentID: parentID,
+		Flags:    f[0],
+		State:    strings.TrimSpace(tracestate),
+	}, true
+}
+
+// NewTraceContext starts a new sampled trace with random IDs.
+func NewTraceContext() TraceContext {
+	return TraceContext{
+		TraceID:  randomHex(16),
+		ParentID: randomHex(8),
+		Flags:    1,
+	}
+}
+
+// Sampled reports whether the sampled flag is set.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&1 != 0
+}
+
+// Traceparent formats the traceparent header value.
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tc.TraceID, tc.ParentID, tc.Flags)
+}
+
+// Inject sets the traceparent and tracestate headers on h, for forwarding
+// the trace on an outgoing request.
+func (tc TraceContext) Inject(h http.Header) {
+	h.Set(TraceparentHeader, tc.Traceparent())
+	if tc.State != "" {
+		h.Set(TracestateHeader, tc.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+type traceKey struct{}
+
+// TraceContextFrom returns the trace context the middleware extracted from
+// or started for the request. Handlers forward it on outgoing calls with
+// Inject.
+func TraceContextFrom(r *http.Request) (TraceContext, bool) {
+	return TraceContextFromContext(r.Context())
+}
+
+// TraceContextFromContext returns the trace context carried by ctx.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceKey{}).(TraceContext)
+	return tc, ok
+}
+
+// ContextWithTraceContext returns ctx carrying tc. Tracers use it to make
+// their span the parent of calls the handler forwards.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceKey{}, tc)
+}
+
+// Tracer starts spans around the middleware's work. It is an adapter point
+// for any tracing library; the parent trace context is available from ctx
+// via TraceContextFromContext.
+type Tracer interface {
+	// Start begins a span named name and returns a context carrying it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a unit of work started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value any)
+	End()
+}
+
+// startSpan starts a span with t, or a no-op span if t is nil.
+func startSpan(t Tracer, ctx context.Context, name string) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) End()                     {}
+
+// requestTraceContext returns r with the trace context from its headers, or
+// a new one when the headers are missing or malformed and start is set.
+func requestTraceContext(r *http.Request, start bool) (*http.Request, TraceContext) {
+	tc, ok := ParseTraceparent(r.Header.Get(TraceparentHeader), r.Header.Get(TracestateHeader))
+	if !ok {
+		if !start {
+			return r, TraceContext{}
+		}
+		tc = NewTraceContext()
+	}
+	return r.WithContext(ContextWithTraceContext(r.Context(), tc)), tc
+}
+
+type exposeTraceKey struct{}
+
+// withExposedTraceID marks ctx so that HAC errors written for the request
+// carry its trace ID.
+func withExposedTraceID(ctx context.Context) context.Context {
+	return context.WithValue(ctx, exposeTraceKey{}, true)
+}
+
+// exposedTraceID returns the trace ID of r if the middleware exposes it, or
+// "".
+func exposedTraceID(r *http.Request) string {
+	if expose, _ := r.Context().Value(exposeTraceKey{}).(bool); !expose {
+		return ""
+	}
+	tc, _ := TraceContextFrom(r)
+	return tc.TraceID
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
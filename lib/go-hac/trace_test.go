@@ -0,0 +1,196 @@
+package hac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{testTraceparent, true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future", true},
+		{"", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ParseTraceparent(tt.in, ""); ok != tt.want {
+			t.Errorf("ParseTraceparent(%q) ok = %v, want %v", tt.in, ok, tt.want)
+		}
+	}
+
+	tc, _ := ParseTraceparent(testTraceparent, "congo=t61rcWkgMzE")
+	if tc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || tc.ParentID != "00f067aa0ba902b7" || !tc.Sampled() {
+		t.Errorf("tc = %+v", tc)
+	}
+	h := http.Header{}
+	tc.Inject(h)
+	if h.Get(TraceparentHeader) != testTraceparent || h.Get(TracestateHeader) != "congo=t61rcWkgMzE" {
+		t.Errorf("injected = %v", h)
+	}
+	if _, ok := ParseTraceparent(NewTraceContext().Traceparent(), ""); !ok {
+		t.Error("NewTraceContext produced an invalid traceparent")
+	}
+}
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]any
+	ended bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordingSpan{name: name, attrs: make(map[string]any)}
+	t.spans = append(t.spans, s)
+	if tc, ok := TraceContextFromContext(ctx); ok {
+		tc.ParentID = "1111111111111111"
+		ctx = ContextWithTraceContext(ctx, tc)
+	}
+	return ctx, s
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *recordingSpan) End()                               { s.ended = true }
+
+func TestMiddlewareTracing(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users").Description("List of users.").MustRegister()
+
+	var forwarded http.Header
+	tracer := &recordingTracer{}
+	h := Middleware(Options{Registry: reg, Tracer: tracer, ExposeTraceID: true})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = http.Header{}
+			if tc, ok := TraceContextFrom(r); ok {
+				tc.Inject(forwarded)
+			}
+			if r.URL.Query().Get("fail") != "" {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte(`[]`))
+		}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", MediaType)
+	req.Header.Set(TraceparentHeader, testTraceparent)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var env SuccessEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.HAC.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("x-trace-id = %q", env.HAC.TraceID)
+	}
+	if got := forwarded.Get(TraceparentHeader); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-1111111111111111-01" {
+		t.Errorf("forwarded traceparent = %q", got)
+	}
+	if len(tracer.spans) != 2 || tracer.spans[0].name != SpanHandler || tracer.spans[1].name != SpanEnvelope {
+		t.Fatalf("spans = %+v", tracer.spans)
+	}
+	for _, s := range tracer.spans {
+		if !s.ended {
+			t.Errorf("span %s not ended", s.name)
+		}
+	}
+	if tracer.spans[0].attrs["http.response.status_code"] != http.StatusOK {
+		t.Errorf("handler span attrs = %v", tracer.spans[0].attrs)
+	}
+
+	// Without a traceparent a new trace is started, and errors carry its ID.
+	req = httptest.NewRequest("GET", "/users?fail=1", nil)
+	req.Header.Set("Accept", MediaType)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var errEnv ErrorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &errEnv); err != nil {
+		t.Fatal(err)
+	}
+	if len(errEnv.Error.TraceID) != 32 || errEnv.Error.TraceID == env.HAC.TraceID {
+		t.Errorf("error x-trace-id = %q", errEnv.Error.TraceID)
+	}
+}
+
+func TestMiddlewareTraceIDOff(t *testing.T) {
+	reg := NewRegistry()
+	reg.Get("/users").Description("List of users.").MustRegister()
+	h := Middleware(Options{Registry: reg})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := TraceContextFrom(r); ok {
+			t.Error("trace context started without a traceparent, tracer or ExposeTraceID")
+		}
+		w.Write([]byte(`[]`))
+	}))
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Accept", MediaType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if strings.Contains(rec.Body.String(), "x-trace-id") {
+		t.Errorf("body = %s", rec.Body)
+	}
+}
+
+func TestMiddlewareTraceIDOnDirectErrors(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736" // from testTraceparent
+	reg := NewRegistry()
+	reg.Get("/orders/{id}").Actions(
+		Action{Rel: "delete", Method: "DELETE", Href: "/orders/{id}", Safety: &Safety{ConfirmationRecommended: true}},
+		Action{Rel: "refresh", Method: "POST", Href: "/orders/{id}/refresh"},
+	).MustRegister()
+	reg.Delete("/orders/{id}").Description("Deleted order.").MustRegister()
+	reg.Post("/orders/{id}/refresh").Description("Refreshed order.").MustRegister()
+	limited := AgentRateLimit(RateLimitOptions{Registry: reg, Default: RateLimit{Requests: 1, Per: time.Hour}})
+	h := Middleware(Options{Registry: reg, ConfirmationKey: []byte("k"), ExposeTraceID: true, PathResolver: func(r *http.Request) string {
+		if r.Method == "POST" {
+			return "/orders/{id}/refresh"
+		}
+		return "/orders/{id}"
+	}})(limited(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name, method, path, accept string
+		wantCode                   string
+	}{
+		{"confirmation", "DELETE", "/orders/1", MediaType, "confirmation_required"},
+		{"confirmation for a plain client", "DELETE", "/orders/1", "application/json", "confirmation_required"},
+		{"dry run unsupported", "POST", "/orders/1/refresh?dry_run=1", MediaType, "dry_run_unsupported"},
+		{"rate limit", "POST", "/orders/1/refresh", MediaType, ""},
+		{"rate limited", "POST", "/orders/1/refresh", MediaType, "rate_limited"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		req.Header.Set(TraceparentHeader, testTraceparent)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if tt.wantCode == "" {
+			continue
+		}
+		var env ErrorEnvelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Error == nil {
+			t.Fatalf("%s: body = %s", tt.name, rec.Body)
+		}
+		if env.Error.Code != tt.wantCode || env.Error.TraceID != traceID {
+			t.Errorf("%s: error = %+v, want code %q with trace ID", tt.name, env.Error, tt.wantCode)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package hac
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// templateVar is a variable in an RFC 6570 URI template (or a Go 1.22
+// ServeMux wildcard, which uses the same brace syntax).
+type templateVar struct {
+	name string
+	// op is the expression operator: 0 for simple expansion, or one of
+	// '+', '#', '.', '/', ';', '?', '&'.
+	op byte
+}
+
+// inQuery reports whether the variable expands into the query string rather
+// than the path.
+func (v templateVar) inQuery() bool {
+	return v.op == '?' || v.op == '&'
+}
+
+// templateVars returns the variables in href in order of appearance, without
+// duplicates. Explode and prefix modifiers are dropped, "{name...}" is read as
+// name, and the ServeMux "{$}" anchor is ignored.
+func templateVars(href string) []templateVar {
+	var vars []templateVar
+	seen := make(map[string]bool)
+	for {
+		open := strings.IndexByte(href, '{')
+		if open < 0 {
+			return vars
+		}
+		end := strings.IndexByte(href[open:], '}')
+		if end < 0 {
+			return vars
+		}
+		expr := href[open+1 : open+end]
+		href = href[open+end+1:]
+
+		var op byte
+		if expr != "" && strings.IndexByte("+#./;?&", expr[0]) >= 0 {
+			op = expr[0]
+			expr = expr[1:]
+		}
+		for _, name := range strings.Split(expr, ",") {
+			name = strings.TrimSuffix(name, "...")
+			name = strings.TrimSuffix(name, "*")
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				name = name[:i]
+			}
+			if name == "" || name == "$" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			vars = append(vars, templateVar{name: name, op: op})
+		}
+	}
+}
+
+// expandTemplate substitutes values from vars into the template expressions
+// of href. Simple expressions are path-escaped; query expressions ({?a,b} and
+// {&a}) become query parameters. Variables without a value expand to nothing.
+// It returns the expanded href and the set of variable names it consumed.
+func expandTemplate(href string, vars map[string]any) (string, map[string]bool) {
+	used := make(map[string]bool)
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(href, '{')
+		end := -1
+		if open >= 0 {
+			end = strings.IndexByte(href[open:], '}')
+		}
+		if open < 0 || end < 0 {
+			b.WriteString(href)
+			return b.String(), used
+		}
+		b.WriteString(href[:open])
+		expr := href[open+1 : open+end]
+		href = href[open+end+1:]
+
+		var op byte
+		if expr != "" && strings.IndexByte("+#./;?&", expr[0]) >= 0 {
+			op = expr[0]
+			expr = expr[1:]
+		}
+		var parts []string
+		for _, name := range strings.Split(expr, ",") {
+			name = strings.TrimSuffix(strings.TrimSuffix(name, "..."), "*")
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				name = name[:i]
+			}
+			v, ok := vars[name]
+			if !ok || v == nil {
+				continue
+			}
+			used[name] = true
+			s := templateValue(v)
+			switch op {
+			case '+', '#':
+				parts = append(parts, s)
+			case ';', '?', '&':
+				parts = append(parts, url.QueryEscape(name)+"="+url.QueryEscape(s))
+			default:
+				parts = append(parts, url.PathEscape(s))
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		switch op {
+		case 0, '+':
+			b.WriteString(strings.Join(parts, ","))
+		case '#':
+			b.WriteByte(op)
+			b.WriteString(strings.Join(parts, ","))
+		case '.', '/', ';':
+			b.WriteByte(op)
+			b.WriteString(strings.Join(parts, string(op)))
+		case '?', '&':
+			b.WriteByte(op)
+			b.WriteString(strings.Join(parts, "&"))
+		}
+	}
+}
+
+// templateValue formats a decoded JSON value for substitution into a URI.
+func templateValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// matchTemplate reports whether the request path matches the path of href,
+// an action href that may contain template variables. A simple "{name}"
+// expression matches one non-empty segment and a trailing "{name...}" or
+// "{/name*}" matches the rest of the path; query expressions and any scheme
+// and host in href are ignored.
+func matchTemplate(href, path string) bool {
+	if i := strings.Index(href, "://"); i >= 0 {
+		href = href[i+3:]
+		j := strings.IndexByte(href, '/')
+		if j < 0 {
+			return path == "/" || path == ""
+		}
+		href = href[j:]
+	}
+	if i := strings.Index(href, "{?"); i >= 0 {
+		href = href[:i]
+	}
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	href = strings.TrimSuffix(href, "{$}")
+	// Rewrite path-segment expansions: "{/name}" as "/{name}" and
+	// "{/name*}" as "/{name...}".
+	for {
+		i := strings.Index(href, "{/")
+		if i < 0 {
+			break
+		}
+		end := strings.IndexByte(href[i:], '}')
+		if end < 0 {
+			break
+		}
+		name := href[i+2 : i+end]
+		if n, ok := strings.CutSuffix(name, "*"); ok {
+			name = n + "..."
+		}
+		href = href[:i] + "/{" + name + "}" + href[i+end+1:]
+	}
+
+	tsegs := strings.Split(strings.Trim(href, "/"), "/")
+	psegs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, t := range tsegs {
+		if strings.HasPrefix(t, "{") && (strings.HasSuffix(t, "...}") || strings.HasSuffix(t, "*}")) && i == len(tsegs)-1 {
+			return len(psegs) >= i
+		}
+		if i >= len(psegs) {
+			return false
+		}
+		if !matchSegment(t, psegs[i]) {
+			return false
+		}
+	}
+	return len(tsegs) == len(psegs)
+}
+
+// matchSegment matches one template segment, which may mix literal text and
+// simple expressions such as "{id}.json", against a path segment.
+func matchSegment(tmpl, seg string) bool {
+	for tmpl != "" {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			return tmpl == seg
+		}
+		if !strings.HasPrefix(seg, tmpl[:open]) {
+			return false
+		}
+		seg = seg[open:]
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			return false
+		}
+		tmpl = tmpl[open+end+1:]
+		// The variable extends to the next literal, or to the end.
+		next := tmpl
+		if i := strings.IndexByte(next, '{'); i >= 0 {
+			next = next[:i]
+		}
+		if next == "" {
+			if tmpl == "" {
+				return seg != ""
+			}
+			continue
+		}
+		i := strings.Index(seg, next)
+		if i <= 0 {
+			return false
+		}
+		seg = seg[i:]
+	}
+	return seg == ""
+}
@@ -0,0 +1,82 @@
+package hac
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateVars(t *testing.T) {
+	tests := []struct {
+		href string
+		want []templateVar
+	}{
+		{"/users", nil},
+		{"/users/{id}", []templateVar{{name: "id"}}},
+		{"/users/{id}/orders/{orderId}", []templateVar{{name: "id"}, {name: "orderId"}}},
+		{"/search{?q,limit}", []templateVar{{name: "q", op: '?'}, {name: "limit", op: '?'}}},
+		{"/files/{path...}", []templateVar{{name: "path"}}},
+		{"/{$}", nil},
+		{"/x/{+rest*}/{id:3}/{id}", []templateVar{{name: "rest", op: '+'}, {name: "id"}}},
+		{"/broken/{id", nil},
+	}
+	for _, tt := range tests {
+		if got := templateVars(tt.href); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("templateVars(%q) = %+v, want %+v", tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		href string
+		vars map[string]any
+		want string
+		used []string
+	}{
+		{"/users/{id}", map[string]any{"id": float64(42)}, "/users/42", []string{"id"}},
+		{"/users/{id}", map[string]any{"id": "a b/c"}, "/users/a%20b%2Fc", []string{"id"}},
+		{"/search{?q,limit}", map[string]any{"q": "x&y", "limit": 10}, "/search?q=x%26y&limit=10", []string{"q", "limit"}},
+		{"/search{?q,limit}", map[string]any{"limit": true}, "/search?limit=true", []string{"limit"}},
+		{"/files{/dir,name}", map[string]any{"dir": "a", "name": "b"}, "/files/a/b", []string{"dir", "name"}},
+		{"/docs{#section,line}", map[string]any{"section": "intro", "line": 3}, "/docs#intro,3", []string{"section", "line"}},
+		{"/users/{id}", nil, "/users/", nil},
+	}
+	for _, tt := range tests {
+		got, used := expandTemplate(tt.href, tt.vars)
+		if got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", tt.href, got, tt.want)
+		}
+		if len(used) != len(tt.used) {
+			t.Errorf("expandTemplate(%q) used = %v, want %v", tt.href, used, tt.used)
+		}
+		for _, name := range tt.used {
+			if !used[name] {
+				t.Errorf("expandTemplate(%q) did not mark %q as used", tt.href, name)
+			}
+		}
+	}
+}
+
+func TestMatchTemplate(t *testing.T) {
+	tests := []struct {
+		href, path string
+		want       bool
+	}{
+		{"/users/{id}", "/users/1", true},
+		{"/users/{id}", "/users/1/orders", false},
+		{"/users/{id}", "/users/", false},
+		{"/users/{id}/orders{?status}", "/users/1/orders", true},
+		{"/files/{path...}", "/files/a/b/c", true},
+		{"/files{/path*}", "/files/a/b", true},
+		{"/reports/{id}.json", "/reports/7.json", true},
+		{"/reports/{id}.json", "/reports/7.csv", false},
+		{"https://api.example.com/users/{id}", "/users/9", true},
+		{"/users", "/users/", true},
+		{"/users", "/orders", false},
+	}
+	for _, tt := range tests {
+		if got := matchTemplate(tt.href, tt.path); got != tt.want {
+			t.Errorf("matchTemplate(%q, %q) = %v, want %v", tt.href, tt.path, got, tt.want)
+		}
+	}
+}
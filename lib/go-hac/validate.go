@@ -0,0 +1,459 @@
+package hac
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The spec schemas under spec/schema, embedded so validation needs no
+// network or filesystem access. Keep the copies in schemas/ in sync.
+//
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+// Names of the embedded spec schemas, for ValidateAs.
+const (
+	EnvelopeSchema  = "hac-envelope.schema.json"
+	ErrorSchema     = "hac-error.schema.json"
+	DiscoverySchema = "hac-discovery.schema.json"
+)
+
+// ValidationMode controls how the middleware treats envelopes that do not
+// conform to the spec schemas.
+type ValidationMode int
+
+const (
+	// ValidateOff skips validation. This is the default.
+	ValidateOff ValidationMode = iota
+
+	// ValidateLog logs violations through slog and sends the response
+	// unchanged.
+	ValidateLog
+
+	// ValidateFail replaces a non-conforming response with a 500 HAC error
+	// whose code is "invalid_envelope".
+	ValidateFail
+)
+
+// Violation is a single schema violation.
+type Violation struct {
+	// Path is the JSON Pointer of the offending value in the document.
+	Path string `json:"path"`
+
+	// Message describes the violated constraint.
+	Message string `json:"message"`
+}
+
+// ValidationError lists the violations found in a document.
+type ValidationError struct {
+	Schema     string
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		p := v.Path
+		if p == "" {
+			p = "/"
+		}
+		msgs[i] = p + ": " + v.Message
+	}
+	return fmt.Sprintf("hac: document does not conform to %s: %s", e.Schema, strings.Join(msgs, "; "))
+}
+
+// Validate checks a HAC document against the spec schema matching its shape:
+// a document with an "error" member is checked as an error envelope, one with
+// a "data" member as a success envelope, and any other document with a "_hac"
+// member as a discovery response. It returns a *ValidationError listing every
+// violation, or an error if doc is not a JSON object.
+func Validate(doc []byte) error {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &probe); err != nil {
+		return fmt.Errorf("hac: decoding document: %w", err)
+	}
+	switch {
+	case probe["error"] != nil:
+		return ValidateAs(ErrorSchema, doc)
+	case probe["data"] != nil:
+		return ValidateAs(EnvelopeSchema, doc)
+	case probe["_hac"] != nil:
+		return ValidateAs(DiscoverySchema, doc)
+	}
+	return ValidateAs(EnvelopeSchema, doc)
+}
+
+// ValidateAs checks doc against the named embedded schema, one of
+// EnvelopeSchema, ErrorSchema or DiscoverySchema.
+func ValidateAs(schema string, doc []byte) error {
+	schemas, err := loadSchemas()
+	if err != nil {
+		return err
+	}
+	root, ok := schemas[schema]
+	if !ok {
+		return fmt.Errorf("hac: unknown schema %q", schema)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	var instance any
+	if err := dec.Decode(&instance); err != nil {
+		return fmt.Errorf("hac: decoding document: %w", err)
+	}
+
+	v := &validator{schemas: schemas}
+	v.validate(schema, root, instance, "")
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Schema: schema, Violations: v.violations}
+}
+
+var (
+	schemasOnce sync.Once
+	schemasByID map[string]map[string]any
+	schemasErr  error
+)
+
+// loadSchemas decodes the embedded schemas once, keyed by file name.
+func loadSchemas() (map[string]map[string]any, error) {
+	schemasOnce.Do(func() {
+		entries, err := schemaFS.ReadDir("schemas")
+		if err != nil {
+			schemasErr = err
+			return
+		}
+		schemasByID = make(map[string]map[string]any, len(entries))
+		for _, e := range entries {
+			raw, err := schemaFS.ReadFile(path.Join("schemas", e.Name()))
+			if err != nil {
+				schemasErr = err
+				return
+			}
+			var s map[string]any
+			if err := json.Unmarshal(raw, &s); err != nil {
+				schemasErr = fmt.Errorf("hac: decoding embedded schema %s: %w", e.Name(), err)
+				return
+			}
+			schemasByID[e.Name()] = s
+		}
+	})
+	return schemasByID, schemasErr
+}
+
+// validator evaluates the JSON Schema 2020-12 keywords used by the spec
+// schemas: $ref, type, enum, const, required, properties,
+// additionalProperties, items, pattern, minimum, maximum, minLength,
+// maxLength, minItems, maxItems, allOf, anyOf and oneOf. Annotations such as
+// format, description and examples are ignored unless formats is set, in
+// which case the email, uri, date-time and uuid formats are asserted.
+type validator struct {
+	schemas    map[string]map[string]any
+	formats    bool
+	violations []Violation
+}
+
+func (v *validator) fail(ptr, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: ptr, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate checks instance against schema, where file names the schema
+// document that relative $refs resolve against.
+func (v *validator) validate(file string, schema map[string]any, instance any, ptr string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		refFile, target, err := v.resolve(file, ref)
+		if err != nil {
+			v.fail(ptr, "%v", err)
+			return
+		}
+		v.validate(refFile, target, instance, ptr)
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, instance) {
+		v.fail(ptr, "must be of type %s, got %s", typeList(t), jsonType(instance))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsJSON(enum, instance) {
+		v.fail(ptr, "must be one of %s", compactJSON(enum))
+	}
+	if c, ok := schema["const"]; ok && !equalJSON(c, instance) {
+		v.fail(ptr, "must equal %s", compactJSON(c))
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subs, ok := schema[key].([]any)
+		if !ok {
+			continue
+		}
+		passed := 0
+		for _, s := range subs {
+			sub, _ := s.(map[string]any)
+			trial := &validator{schemas: v.schemas, formats: v.formats}
+			trial.validate(file, sub, instance, ptr)
+			if len(trial.violations) == 0 {
+				passed++
+			} else if key == "allOf" {
+				v.violations = append(v.violations, trial.violations...)
+			}
+		}
+		switch {
+		case key == "anyOf" && passed == 0:
+			v.fail(ptr, "must match at least one schema in anyOf")
+		case key == "oneOf" && passed != 1:
+			v.fail(ptr, "must match exactly one schema in oneOf, matched %d", passed)
+		}
+	}
+
+	switch inst := instance.(type) {
+	case map[string]any:
+		v.validateObject(file, schema, inst, ptr)
+	case []any:
+		if n, ok := schemaInt(schema, "minItems"); ok && len(inst) < n {
+			v.fail(ptr, "must have at least %d items", n)
+		}
+		if n, ok := schemaInt(schema, "maxItems"); ok && len(inst) > n {
+			v.fail(ptr, "must have at most %d items", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range inst {
+				v.validate(file, items, item, ptr+"/"+strconv.Itoa(i))
+			}
+		}
+	case string:
+		n := len([]rune(inst))
+		if min, ok := schemaInt(schema, "minLength"); ok && n < min {
+			v.fail(ptr, "must be at least %d characters", min)
+		}
+		if max, ok := schemaInt(schema, "maxLength"); ok && n > max {
+			v.fail(ptr, "must be at most %d characters", max)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			re, err := compilePattern(p)
+			if err != nil {
+				v.fail(ptr, "invalid pattern %q in schema: %v", p, err)
+			} else if !re.MatchString(inst) {
+				v.fail(ptr, "must match pattern %s", p)
+			}
+		}
+		if f, ok := schema["format"].(string); ok && v.formats && !validFormat(f, inst) {
+			v.fail(ptr, "must be a valid %s", f)
+		}
+	case json.Number:
+		f, _ := inst.Float64()
+		if min, ok := schema["minimum"].(float64); ok && f < min {
+			v.fail(ptr, "must be >= %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && f > max {
+			v.fail(ptr, "must be <= %v", max)
+		}
+	}
+}
+
+func (v *validator) validateObject(file string, schema, obj map[string]any, ptr string) {
+	for _, name := range stringSlice(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			v.fail(ptr, "missing required property %q", name)
+		}
+	}
+	props, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := ptr + "/" + escapePointer(k)
+		if p, ok := props[k].(map[string]any); ok {
+			v.validate(file, p, obj[k], child)
+			continue
+		}
+		switch ap := schema["additionalProperties"].(type) {
+		case bool:
+			if !ap {
+				v.fail(child, "unexpected property")
+			}
+		case map[string]any:
+			v.validate(file, ap, obj[k], child)
+		}
+	}
+}
+
+// resolve finds the schema a $ref points to. It supports references within
+// the current document ("#/$defs/X") and to other embedded schemas by file
+// name ("hac-envelope.schema.json#/$defs/Action").
+func (v *validator) resolve(file, ref string) (string, map[string]any, error) {
+	target, fragment, _ := strings.Cut(ref, "#")
+	if target == "" {
+		target = file
+	} else {
+		target = path.Base(target)
+	}
+	doc, ok := v.schemas[target]
+	if !ok {
+		return "", nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	var cur any = doc
+	if fragment != "" {
+		for _, tok := range strings.Split(strings.TrimPrefix(fragment, "/"), "/") {
+			tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+			m, ok := cur.(map[string]any)
+			if !ok {
+				return "", nil, fmt.Errorf("unresolvable $ref %q", ref)
+			}
+			cur = m[tok]
+		}
+	}
+	s, ok := cur.(map[string]any)
+	if !ok {
+		return "", nil, fmt.Errorf("unresolvable $ref %q", ref)
+	}
+	return target, s, nil
+}
+
+var patternCache sync.Map // string -> *regexp.Regexp
+
+func compilePattern(p string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(p); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return nil, err
+	}
+	patternCache.Store(p, re)
+	return re, nil
+}
+
+// matchesType reports whether instance has the JSON Schema type t, which is
+// a type name or an array of names.
+func matchesType(t, instance any) bool {
+	switch t := t.(type) {
+	case string:
+		return isJSONType(t, instance)
+	case []any:
+		for _, name := range t {
+			if s, ok := name.(string); ok && isJSONType(s, instance) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func isJSONType(name string, instance any) bool {
+	switch name {
+	case "integer":
+		n, ok := instance.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "number":
+		_, ok := instance.(json.Number)
+		return ok
+	}
+	return jsonType(instance) == name
+}
+
+// jsonType returns the JSON Schema type name of a decoded value.
+func jsonType(instance any) string {
+	switch instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", instance)
+}
+
+func typeList(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, n := range list {
+			names = append(names, fmt.Sprint(n))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validFormat reports whether s conforms to format. Formats other than
+// email, uri, date-time and uuid are not checked.
+func validFormat(format, s string) bool {
+	switch format {
+	case FormatEmail:
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	case FormatURI:
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	case FormatDateTime:
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil
+	case FormatUUID:
+		return uuidPattern.MatchString(s)
+	}
+	return true
+}
+
+func schemaInt(schema map[string]any, key string) (int, bool) {
+	f, ok := schema[key].(float64)
+	return int(f), ok
+}
+
+func containsJSON(list []any, v any) bool {
+	for _, item := range list {
+		if equalJSON(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// equalJSON compares two decoded JSON values by their canonical encoding, so
+// that numbers decoded as float64 and json.Number compare equal.
+func equalJSON(a, b any) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+func compactJSON(v any) string {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			v = f
+		}
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
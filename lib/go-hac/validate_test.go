@@ -0,0 +1,155 @@
+package hac
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []string // expected violation paths
+	}{
+		{
+			name: "valid envelope",
+			doc: `{"data":{"id":1},"_hac":{"version":"1.0","actions":[{"rel":"delete","method":"DELETE","href":"/users/1",
+				"safety":{"mutability":"irreversible","reversible_within":"P30D","cost":{"amount":9.99,"currency":"USD"}},
+				"fields":[{"name":"reason","type":"string","enum":["a","b"]}]}]}}`,
+		},
+		{
+			name: "nested fields",
+			doc: `{"data":{},"_hac":{"version":"1.0","actions":[{"rel":"order","method":"POST","href":"/orders",
+				"fields":[{"name":"lines","type":"array","items":{"type":"object","properties":[
+					{"name":"sku","type":"string","pattern":"^[A-Z]+$","minLength":3},
+					{"name":"qty","type":"integer","minimum":1}]}},
+					{"name":"email","type":"string","format":"email"}]}]}}`,
+		},
+		{
+			name: "nested field violations",
+			doc: `{"data":{},"_hac":{"version":"1.0","actions":[{"rel":"order","method":"POST","href":"/orders",
+				"fields":[{"name":"lines","type":"array","items":{"properties":[{"type":"integer","maxLength":-1}]}}]}]}}`,
+			want: []string{
+				"/_hac/actions/0/fields/0/items",
+				"/_hac/actions/0/fields/0/items/properties/0/maxLength",
+				"/_hac/actions/0/fields/0/items/properties/0",
+			},
+		},
+		{
+			name: "null data",
+			doc:  `{"data":null,"_hac":{"version":"1.0"}}`,
+		},
+		{
+			name: "envelope violations",
+			doc: `{"data":[],"_hac":{"actions":[{"rel":"x","method":"FETCH","href":"/x",
+				"safety":{"reversible_within":"30 days","cost":{"amount":"9.99","currency":"usd"}},
+				"fields":[{"name":"n","type":"text"}]}]}}`,
+			want: []string{
+				"/_hac",
+				"/_hac/actions/0/fields/0/type",
+				"/_hac/actions/0/method",
+				"/_hac/actions/0/safety/cost/amount",
+				"/_hac/actions/0/safety/cost/currency",
+				"/_hac/actions/0/safety/reversible_within",
+			},
+		},
+		{
+			name: "valid error",
+			doc: `{"error":{"code":"active_subscriptions","message":"Cancel first.","retryable":false,
+				"recovery":{"description":"Cancel subscriptions.","actions":[{"rel":"cancel","method":"POST","href":"/subscriptions/1/cancel"}]}}}`,
+		},
+		{
+			name: "error violations",
+			doc:  `{"error":{"code":"x","retry_after":-1,"recovery":{"actions":[{"rel":"cancel","method":"POST"}]}}}`,
+			want: []string{"/error", "/error/recovery", "/error/recovery/actions/0", "/error/retry_after"},
+		},
+		{
+			name: "valid discovery",
+			doc:  `{"_hac":{"name":"Acme API","resources":[{"rel":"users","href":"/users","methods":["GET","POST"]}]}}`,
+		},
+		{
+			name: "discovery violations",
+			doc:  `{"_hac":{"name":1,"resources":[{"rel":"users","methods":["GRAB"]}]}}`,
+			want: []string{"/_hac/name", "/_hac/resources/0", "/_hac/resources/0/methods/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.doc))
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v, want *ValidationError", err)
+			}
+			var got []string
+			for _, v := range verr.Violations {
+				got = append(got, v.Path)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("violation paths = %v, want %v\n%v", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateAs(t *testing.T) {
+	if err := ValidateAs(DiscoverySchema, []byte(`{"data":null,"_hac":{"version":"1.0"}}`)); err == nil {
+		t.Error("envelope validated as discovery: want error")
+	}
+	if err := ValidateAs("nope.json", []byte(`{}`)); err == nil {
+		t.Error("unknown schema: want error")
+	}
+	if err := Validate([]byte(`[1]`)); err == nil {
+		t.Error("non-object document: want error")
+	}
+}
+
+func TestValidateGeneratedEnvelopes(t *testing.T) {
+	docs := []any{
+		&SuccessEnvelope{Data: []byte(`{"id":1}`), HAC: &HACMeta{
+			Version: SpecVersion,
+			Actions: []Action{{Rel: "delete", Method: "DELETE", Href: "/users/{id}", Safety: &Safety{Mutability: Irreversible}}},
+			Related: []RelatedResource{{Rel: "orders", Href: "/users/1/orders"}},
+		}},
+		&ErrorEnvelope{Error: defaultErrorMapping(503, nil)},
+		&DiscoveryResponse{HAC: &DiscoveryMeta{Name: "API", Resources: []ResourceEntry{{Rel: "users", Href: "/users"}}}},
+	}
+	for _, d := range docs {
+		out, err := json.Marshal(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Validate(out); err != nil {
+			t.Errorf("Validate(%s): %v", out, err)
+		}
+	}
+}
+
+// The embedded schemas are copies of spec/schema; fail if they drift.
+func TestEmbeddedSchemasMatchSpec(t *testing.T) {
+	specDir := filepath.Join("..", "..", "spec", "schema")
+	for _, name := range []string{EnvelopeSchema, ErrorSchema, DiscoverySchema} {
+		spec, err := os.ReadFile(filepath.Join(specDir, name))
+		if err != nil {
+			t.Skipf("spec schemas not available: %v", err)
+		}
+		embedded, err := schemaFS.ReadFile("schemas/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(spec, embedded) {
+			t.Errorf("schemas/%s differs from spec/schema/%s", name, name)
+		}
+	}
+}